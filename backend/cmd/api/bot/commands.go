@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/lines"
+	"github.com/bwmarrin/discordgo"
+)
+
+var commands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "search",
+		Description: "Search past service alerts",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "query",
+				Description: "Words to look for, e.g. \"G suspended Hoyt\"",
+				Required:    true,
+			},
+		},
+	},
+}
+
+type commandHandler func(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error
+
+var commandHandlers = map[string]commandHandler{
+	"search":         handleSearchCommand,
+	"alerts-channel": handleAlertsChannelCommand,
+	"line-role":      handleLineRoleCommand,
+	"roles":          handleRolesCommand,
+}
+
+// componentHandlers handle button presses, keyed by custom ID prefix.
+var componentHandlers = map[string]commandHandler{
+	roleButtonPrefix: handleRoleButton,
+}
+
+func registerCommands(dg *discordgo.Session, database *db.DB) error {
+	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		var name string
+		var h commandHandler
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			name = i.ApplicationCommandData().Name
+			h = commandHandlers[name]
+		case discordgo.InteractionMessageComponent:
+			id := i.MessageComponentData().CustomID
+			for prefix, ch := range componentHandlers {
+				if strings.HasPrefix(id, prefix) {
+					name, h = id, ch
+				}
+			}
+		}
+		if h == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := h(ctx, database, s, i); err != nil {
+			log.Printf("bot: /%s failed: %v", name, err)
+			_ = respondEphemeral(s, i, "Something went wrong, try again in a bit.")
+		}
+	})
+
+	_, err := dg.ApplicationCommandBulkOverwrite(dg.State.User.ID, "", append(commands, guildCommands...))
+	return err
+}
+
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func optionString(i *discordgo.InteractionCreate, name string) string {
+	for _, o := range i.ApplicationCommandData().Options {
+		if o.Name == name {
+			return strings.TrimSpace(o.StringValue())
+		}
+	}
+	return ""
+}
+
+func handleSearchCommand(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	query := optionString(i, "query")
+	if query == "" {
+		return respondEphemeral(s, i, "Give me something to search for.")
+	}
+
+	results, err := database.Alerts().Search(ctx, query, 5)
+	if err != nil {
+		return err
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:  truncate("Alerts matching “"+query+"”", 256),
+		Color:  lines.Color("ALL"),
+		Footer: &discordgo.MessageEmbedFooter{Text: "nyctcord • best matches first"},
+	}
+	if len(results) == 0 {
+		embed.Description = "No past alerts matched."
+	}
+
+	for _, r := range results {
+		name := fmt.Sprintf("%s • Line %s", r.CreatedAt.UTC().Format("Jan 2, 2006 15:04 UTC"), r.LineID)
+		if v := deref(r.NewStatus); v != "" {
+			name += " • " + v
+		}
+		value := strings.TrimSpace(r.Snippet)
+		if value == "" {
+			value = deref(r.Header)
+		}
+		if value == "" {
+			value = "(no text)"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  truncate(name, 256),
+			Value: truncate(value, 1024),
+		})
+	}
+
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+		},
+	})
+}
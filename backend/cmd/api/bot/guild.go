@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/poller"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildPoster posts queued alerts to each server's alerts channel, pinging
+// the line's role when the alert is severe enough.
+type guildPoster struct {
+	DB        *db.DB
+	Session   *discordgo.Session
+	Templates *templates.Set
+
+	// unmarked holds deliveries that were posted but couldn't be marked
+	// sent, with their message ids. Leaving them pending would repost the
+	// alert, and ping its role again, on every tick.
+	unmarked map[int64]string
+}
+
+// guildBatchSize caps how many posts go out per run.
+const guildBatchSize = 25
+
+func (g *guildPoster) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		g.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *guildPoster) RunOnce(ctx context.Context) {
+	store := g.DB.Guilds()
+	g.markUnmarked(ctx)
+
+	// Unmarked posts are still pending; fetch enough past them for a full
+	// batch.
+	pending, err := store.Pending(ctx, guildBatchSize+len(g.unmarked))
+	if err != nil {
+		log.Printf("bot: load pending guild posts error: %v", err)
+		return
+	}
+
+	batch := 0
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, ok := g.unmarked[p.ID]; ok {
+			continue
+		}
+		if batch == guildBatchSize {
+			break
+		}
+		batch++
+
+		id, err := g.post(ctx, p)
+		if err != nil {
+			log.Printf("bot: guild post failed delivery_id=%d guild_id=%s err=%v", p.ID, p.GuildID, err)
+			if err := store.MarkFailed(ctx, p.ID, err.Error()); err != nil {
+				log.Printf("bot: mark guild post failed delivery_id=%d err=%v", p.ID, err)
+			}
+			continue
+		}
+		if err := store.MarkSent(ctx, p.ID, id, time.Now()); err != nil {
+			log.Printf("bot: mark guild post sent delivery_id=%d err=%v", p.ID, err)
+			if g.unmarked == nil {
+				g.unmarked = map[int64]string{}
+			}
+			g.unmarked[p.ID] = id
+		}
+	}
+}
+
+// markUnmarked retries marking posts that went out on an earlier run but
+// couldn't be recorded then.
+func (g *guildPoster) markUnmarked(ctx context.Context) {
+	store := g.DB.Guilds()
+	for id, messageID := range g.unmarked {
+		if err := store.MarkSent(ctx, id, messageID, time.Now()); err != nil {
+			log.Printf("bot: mark guild post sent delivery_id=%d err=%v", id, err)
+			continue
+		}
+		delete(g.unmarked, id)
+	}
+}
+
+// post sends p to its guild. Posts about a GTFS-RT alert go into that
+// alert's thread, opened from the first post in the channel; a resolution
+// goes into every open thread for the line and archives the threads with
+// nothing left unresolved.
+func (g *guildPoster) post(ctx context.Context, p db.PendingGuildDelivery) (string, error) {
+	d := templates.FromAlert(p.Alert)
+	r, err := g.Templates.Render(templates.ChannelGuild, d.Kind, d)
+	if err != nil {
+		return "", err
+	}
+
+	msg := &discordgo.MessageSend{
+		Embeds:          []*discordgo.MessageEmbed{buildEmbed(d.Line, d.Effect, r)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if role := deref(p.RoleID); role != "" && shouldPing(d.Effect, p.MinSeverity) {
+		msg.Content = "<@&" + role + ">"
+		msg.AllowedMentions.Roles = []string{role}
+	} else {
+		msg.Flags = discordgo.MessageFlagsSuppressNotifications
+	}
+
+	if d.Kind == templates.KindResolved {
+		return g.postResolution(ctx, p, msg)
+	}
+
+	store := g.DB.Guilds()
+	alertID := strings.TrimSpace(p.Alert.AlertID)
+	if alertID == "" {
+		return g.send(ctx, p.ChannelID, msg)
+	}
+
+	threadID, err := store.Thread(ctx, p.GuildID, alertID)
+	switch {
+	case err == nil:
+		id, err := g.send(ctx, threadID, msg)
+		if err == nil {
+			// The alert may have spread to another line since the thread
+			// was opened.
+			return id, store.AddThread(ctx, p.GuildID, alertID, p.Alert.LineID, threadID, time.Now())
+		}
+		if !isUnknownChannel(err) {
+			return "", err
+		}
+		// Someone deleted the thread; start over with a new one.
+		if err := store.DeleteThread(ctx, threadID); err != nil {
+			return "", err
+		}
+	case err != db.ErrNotFound:
+		return "", err
+	}
+
+	id, err := g.send(ctx, p.ChannelID, msg)
+	if err != nil {
+		return "", err
+	}
+
+	thread, err := g.Session.MessageThreadStart(p.ChannelID, id, threadName(d.Line, r.Title), 1440, discordgo.WithContext(ctx))
+	if err != nil {
+		// The alert is posted; later updates will just land in the channel.
+		log.Printf("bot: start thread guild_id=%s alert_id=%s err=%v", p.GuildID, alertID, err)
+		return id, nil
+	}
+	return id, store.AddThread(ctx, p.GuildID, alertID, p.Alert.LineID, thread.ID, time.Now())
+}
+
+func (g *guildPoster) postResolution(ctx context.Context, p db.PendingGuildDelivery, msg *discordgo.MessageSend) (string, error) {
+	store := g.DB.Guilds()
+
+	threads, err := store.OpenThreads(ctx, p.GuildID, p.Alert.LineID)
+	if err != nil {
+		return "", err
+	}
+
+	var id string
+	for _, threadID := range threads {
+		sent, err := g.send(ctx, threadID, msg)
+		if isUnknownChannel(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		id = sent
+	}
+
+	var done []string
+	err = g.DB.WithTx(ctx, func(tx *db.Tx) error {
+		var err error
+		done, err = tx.Guilds().ResolveLine(ctx, p.GuildID, p.Alert.LineID, time.Now())
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	archived := true
+	for _, threadID := range done {
+		if _, err := g.Session.ChannelEdit(threadID, &discordgo.ChannelEdit{Archived: &archived}, discordgo.WithContext(ctx)); err != nil && !isUnknownChannel(err) {
+			log.Printf("bot: archive thread %s err=%v", threadID, err)
+		}
+	}
+
+	if id == "" {
+		// No thread to resolve: the line's alert predates threads or
+		// the thread is gone.
+		return g.send(ctx, p.ChannelID, msg)
+	}
+	return id, nil
+}
+
+func (g *guildPoster) send(ctx context.Context, channelID string, msg *discordgo.MessageSend) (string, error) {
+	sent, err := g.Session.ChannelMessageSendComplex(channelID, msg, discordgo.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	return sent.ID, nil
+}
+
+func threadName(line, title string) string {
+	if line == "" {
+		return truncate(title, 100)
+	}
+	return truncate(line+" • "+title, 100)
+}
+
+// isUnknownChannel reports whether Discord said the channel or thread no
+// longer exists. A bare 404 isn't enough: Discord also answers 404 for an
+// unknown message or webhook, which says nothing about the thread.
+func isUnknownChannel(err error) bool {
+	var rest *discordgo.RESTError
+	return errors.As(err, &rest) && rest.Message != nil && rest.Message.Code == discordgo.ErrCodeUnknownChannel
+}
+
+// shouldPing reports whether an alert with effect is at least as severe as
+// minSeverity. Resolutions have no effect and never ping.
+func shouldPing(effect, minSeverity string) bool {
+	if effect == "" {
+		return false
+	}
+	return poller.SeverityRank(effect) >= poller.SeverityRank(minSeverity)
+}
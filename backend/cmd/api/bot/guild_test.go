@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestShouldPing(t *testing.T) {
+	tests := []struct {
+		effect, minSeverity string
+		want                bool
+	}{
+		// No threshold: every alert pings.
+		{"MODIFIED_SERVICE", "", true},
+		{"OTHER_EFFECT", "", true},
+		{"NO_SERVICE", "", true},
+
+		{"SIGNIFICANT_DELAYS", "SIGNIFICANT_DELAYS", true},
+		{"REDUCED_SERVICE", "SIGNIFICANT_DELAYS", true},
+		{"NO_SERVICE", "SIGNIFICANT_DELAYS", true},
+		{"DETOUR", "SIGNIFICANT_DELAYS", false},
+		{"MODIFIED_SERVICE", "SIGNIFICANT_DELAYS", false},
+
+		{"NO_SERVICE", "NO_SERVICE", true},
+		{"REDUCED_SERVICE", "NO_SERVICE", false},
+
+		// Resolutions never ping.
+		{"", "", false},
+		{"", "NO_SERVICE", false},
+	}
+	for _, tt := range tests {
+		if got := shouldPing(tt.effect, tt.minSeverity); got != tt.want {
+			t.Errorf("shouldPing(%q, %q) = %v, want %v", tt.effect, tt.minSeverity, got, tt.want)
+		}
+	}
+}
+
+func TestThreadName(t *testing.T) {
+	if got := threadName("F", "Delays"); got != "F • Delays" {
+		t.Errorf("threadName = %q", got)
+	}
+	if got := threadName("", "Delays"); got != "Delays" {
+		t.Errorf("threadName without a line = %q", got)
+	}
+	long := threadName("F", string(make([]byte, 200)))
+	if n := len([]rune(long)); n != 100 {
+		t.Errorf("threadName is %d runes, want Discord's 100 limit", n)
+	}
+}
+
+func TestIsUnknownChannel(t *testing.T) {
+	restError := func(status, code int) error {
+		err := &discordgo.RESTError{Response: &http.Response{StatusCode: status}}
+		if code != 0 {
+			err.Message = &discordgo.APIErrorMessage{Code: code}
+		}
+		return fmt.Errorf("send: %w", err)
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unknown channel", restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel), true},
+		{"unknown message", restError(http.StatusNotFound, discordgo.ErrCodeUnknownMessage), false},
+		{"bare 404", restError(http.StatusNotFound, 0), false},
+		{"missing access", restError(http.StatusForbidden, discordgo.ErrCodeMissingAccess), false},
+		{"not a REST error", errors.New("connection reset"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isUnknownChannel(tt.err); got != tt.want {
+			t.Errorf("%s: isUnknownChannel = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/notify"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+	"github.com/bwmarrin/discordgo"
+)
+
+// dmNotifier delivers notifications as embeds in the user's Discord DMs.
+type dmNotifier struct {
+	Session   *discordgo.Session
+	Templates *templates.Set
+}
+
+func (d *dmNotifier) Send(ctx context.Context, n notify.Notification) (notify.Receipt, error) {
+	ch, err := d.Session.UserChannelCreate(n.DiscordID, discordgo.WithContext(ctx))
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+	r, err := d.Templates.Notification(n)
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+	msg, err := d.Session.ChannelMessageSendEmbed(ch.ID, buildEmbed(n.LineID, deref(n.Effect), r), discordgo.WithContext(ctx))
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+	return notify.Receipt{ExternalID: msg.ID}, nil
+}
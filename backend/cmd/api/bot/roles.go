@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/bwmarrin/discordgo"
+)
+
+const roleButtonPrefix = "lineroles:"
+
+var lineIDPattern = regexp.MustCompile(`^[A-Z0-9]{1,4}$`)
+
+// severityChoices are the thresholds offered by /line-role set, mildest
+// first. "any" pings for every alert except resolutions.
+var severityChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "any alert", Value: "any"},
+	{Name: "modified service", Value: "MODIFIED_SERVICE"},
+	{Name: "detour", Value: "DETOUR"},
+	{Name: "significant delays", Value: "SIGNIFICANT_DELAYS"},
+	{Name: "reduced service", Value: "REDUCED_SERVICE"},
+	{Name: "no service", Value: "NO_SERVICE"},
+}
+
+var (
+	manageGuild = int64(discordgo.PermissionManageGuild)
+	manageRoles = int64(discordgo.PermissionManageRoles)
+	noDM        = false
+)
+
+var guildCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:                     "alerts-channel",
+		Description:              "Choose where this server gets service alerts",
+		DefaultMemberPermissions: &manageGuild,
+		DMPermission:             &noDM,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Post alerts in a channel",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Channel to post in",
+						Required:     true,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "all_lines",
+						Description: "Post every line, not just lines with a role (default: yes)",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "off",
+				Description: "Stop posting alerts in this server",
+			},
+		},
+	},
+	{
+		Name:                     "line-role",
+		Description:              "Map lines to roles that get pinged for their alerts",
+		DefaultMemberPermissions: &manageRoles,
+		DMPermission:             &noDM,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Ping a role for a line's alerts",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "line",
+						Description: "Line, e.g. F, or ALL for lines without their own role",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionRole,
+						Name:        "role",
+						Description: "Role to ping",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "min_severity",
+						Description: "Only ping at or above this; milder alerts post silently (default: any alert)",
+						Choices:     severityChoices,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Stop pinging a role for a line",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "line",
+						Description: "Line, e.g. F",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "Show this server's alerts channel and line roles",
+			},
+		},
+	},
+	{
+		Name:         "roles",
+		Description:  "Pick the line roles you want to be pinged with",
+		DMPermission: &noDM,
+	},
+}
+
+// subcommand returns the invoked subcommand and its options, or "" and the
+// top-level options for commands without subcommands.
+func subcommand(i *discordgo.InteractionCreate) (string, []*discordgo.ApplicationCommandInteractionDataOption) {
+	opts := i.ApplicationCommandData().Options
+	if len(opts) > 0 && opts[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+		return opts[0].Name, opts[0].Options
+	}
+	return "", opts
+}
+
+func findOption(opts []*discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, o := range opts {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+func handleAlertsChannelCommand(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if i.GuildID == "" {
+		return respondEphemeral(s, i, "This only works in a server.")
+	}
+
+	name, opts := subcommand(i)
+	switch name {
+	case "set":
+		channel := findOption(opts, "channel").ChannelValue(nil)
+		allLines := true
+		if o := findOption(opts, "all_lines"); o != nil {
+			allLines = o.BoolValue()
+		}
+
+		err := database.Guilds().SetChannel(ctx, db.GuildChannel{GuildID: i.GuildID, ChannelID: channel.ID, AllLines: allLines})
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Service alerts for every line will be posted in <#%s>.", channel.ID)
+		if !allLines {
+			msg = fmt.Sprintf("Service alerts for lines with a role will be posted in <#%s>.", channel.ID)
+		}
+		return respondEphemeral(s, i, msg)
+
+	case "off":
+		if err := database.Guilds().DeleteChannel(ctx, i.GuildID); err != nil {
+			return err
+		}
+		return respondEphemeral(s, i, "Service alerts are off for this server. Line roles are kept.")
+	}
+	return respondEphemeral(s, i, "Unknown subcommand.")
+}
+
+func handleLineRoleCommand(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if i.GuildID == "" {
+		return respondEphemeral(s, i, "This only works in a server.")
+	}
+
+	name, opts := subcommand(i)
+	switch name {
+	case "set":
+		line := normalizeLine(findOption(opts, "line").StringValue())
+		if !lineIDPattern.MatchString(line) {
+			return respondEphemeral(s, i, "That doesn't look like a line. Try something like F, 7 or ALL.")
+		}
+		role := findOption(opts, "role").RoleValue(nil, "")
+		if role.ID == i.GuildID {
+			return respondEphemeral(s, i, "Pick a role other than @everyone.")
+		}
+
+		minSeverity := ""
+		if o := findOption(opts, "min_severity"); o != nil && o.StringValue() != "any" {
+			minSeverity = o.StringValue()
+		}
+
+		err := database.Guilds().SetLineRole(ctx, db.GuildLineRole{GuildID: i.GuildID, LineID: line, RoleID: role.ID, MinSeverity: minSeverity})
+		if err != nil {
+			return err
+		}
+
+		msg := fmt.Sprintf("Line %s alerts will ping <@&%s>", line, role.ID)
+		if minSeverity != "" {
+			msg += " when they're at least " + severityName(minSeverity)
+		}
+		return respondEphemeral(s, i, msg+".")
+
+	case "remove":
+		line := normalizeLine(findOption(opts, "line").StringValue())
+		err := database.Guilds().DeleteLineRole(ctx, i.GuildID, line)
+		if err == db.ErrNotFound {
+			return respondEphemeral(s, i, "Line "+line+" has no role.")
+		}
+		if err != nil {
+			return err
+		}
+		return respondEphemeral(s, i, "Line "+line+" alerts won't ping anyone now.")
+
+	case "list":
+		return handleLineRoleList(ctx, database, s, i)
+	}
+	return respondEphemeral(s, i, "Unknown subcommand.")
+}
+
+func handleLineRoleList(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	var b strings.Builder
+
+	ch, err := database.Guilds().Channel(ctx, i.GuildID)
+	switch {
+	case err == db.ErrNotFound:
+		b.WriteString("No alerts channel set; use /alerts-channel set.\n")
+	case err != nil:
+		return err
+	case ch.AllLines:
+		fmt.Fprintf(&b, "Alerts for every line post in <#%s>.\n", ch.ChannelID)
+	default:
+		fmt.Fprintf(&b, "Alerts for lines with a role post in <#%s>.\n", ch.ChannelID)
+	}
+
+	roles, err := database.Guilds().LineRoles(ctx, i.GuildID)
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		b.WriteString("No line roles yet; use /line-role set.")
+	}
+	for _, r := range roles {
+		fmt.Fprintf(&b, "\n**%s** → <@&%s>", r.LineID, r.RoleID)
+		if r.MinSeverity != "" {
+			b.WriteString(" (" + severityName(r.MinSeverity) + " and up)")
+		}
+	}
+
+	return respondEphemeral(s, i, truncate(b.String(), 2000))
+}
+
+func handleRolesCommand(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if i.GuildID == "" || i.Member == nil {
+		return respondEphemeral(s, i, "This only works in a server.")
+	}
+
+	roles, err := database.Guilds().LineRoles(ctx, i.GuildID)
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return respondEphemeral(s, i, "This server hasn't set up any line roles yet.")
+	}
+
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    "Tap a line to get pinged for its alerts; tap again to stop.",
+			Components: rolePanel(roles, i.Member.Roles),
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// handleRoleButton toggles the role behind a /roles button and redraws the
+// panel.
+func handleRoleButton(ctx context.Context, database *db.DB, s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if i.GuildID == "" || i.Member == nil {
+		return nil
+	}
+	roleID := strings.TrimPrefix(i.MessageComponentData().CustomID, roleButtonPrefix)
+
+	roles, err := database.Guilds().LineRoles(ctx, i.GuildID)
+	if err != nil {
+		return err
+	}
+	// Only roles mapped to a line can be self-assigned.
+	if !slices.ContainsFunc(roles, func(r db.GuildLineRole) bool { return r.RoleID == roleID }) {
+		return respondEphemeral(s, i, "That role isn't a line role any more.")
+	}
+
+	member := i.Member.Roles
+	if slices.Contains(member, roleID) {
+		err = s.GuildMemberRoleRemove(i.GuildID, i.Member.User.ID, roleID, discordgo.WithContext(ctx))
+		member = slices.DeleteFunc(slices.Clone(member), func(r string) bool { return r == roleID })
+	} else {
+		err = s.GuildMemberRoleAdd(i.GuildID, i.Member.User.ID, roleID, discordgo.WithContext(ctx))
+		member = append(slices.Clone(member), roleID)
+	}
+	if err != nil {
+		return respondEphemeral(s, i, "I couldn't change your roles. An admin needs to give me Manage Roles and put my role above the line roles.")
+	}
+
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    "Tap a line to get pinged for its alerts; tap again to stop.",
+			Components: rolePanel(roles, member),
+		},
+	})
+}
+
+// rolePanel lays out one button per role, labelled with the lines it
+// covers and highlighted when the member already has it. Discord allows
+// at most 25 buttons.
+func rolePanel(roles []db.GuildLineRole, memberRoles []string) []discordgo.MessageComponent {
+	order := make([]string, 0)
+	lines := map[string][]string{}
+	for _, r := range roles {
+		if _, ok := lines[r.RoleID]; !ok {
+			order = append(order, r.RoleID)
+		}
+		lines[r.RoleID] = append(lines[r.RoleID], r.LineID)
+	}
+	if len(order) > 25 {
+		order = order[:25]
+	}
+
+	rows := make([]discordgo.MessageComponent, 0, 5)
+	var row discordgo.ActionsRow
+	for _, roleID := range order {
+		style := discordgo.SecondaryButton
+		if slices.Contains(memberRoles, roleID) {
+			style = discordgo.SuccessButton
+		}
+		row.Components = append(row.Components, discordgo.Button{
+			Label:    truncate(strings.Join(lines[roleID], " "), 80),
+			Style:    style,
+			CustomID: roleButtonPrefix + roleID,
+		})
+		if len(row.Components) == 5 {
+			rows = append(rows, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func normalizeLine(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+func severityName(effect string) string {
+	for _, c := range severityChoices {
+		if c.Value == effect {
+			return c.Name
+		}
+	}
+	return effect
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/bwmarrin/discordgo"
+)
+
+func panelButtons(t *testing.T, rows []discordgo.MessageComponent) [][]discordgo.Button {
+	t.Helper()
+	out := make([][]discordgo.Button, 0, len(rows))
+	for _, c := range rows {
+		row, ok := c.(discordgo.ActionsRow)
+		if !ok {
+			t.Fatalf("component %T, want ActionsRow", c)
+		}
+		buttons := make([]discordgo.Button, 0, len(row.Components))
+		for _, b := range row.Components {
+			buttons = append(buttons, b.(discordgo.Button))
+		}
+		out = append(out, buttons)
+	}
+	return out
+}
+
+func TestRolePanel(t *testing.T) {
+	roles := []db.GuildLineRole{
+		{LineID: "A", RoleID: "r-ace"},
+		{LineID: "B", RoleID: "r-bdfm"},
+		{LineID: "C", RoleID: "r-ace"},
+		{LineID: "D", RoleID: "r-bdfm"},
+		{LineID: "E", RoleID: "r-ace"},
+		{LineID: "G", RoleID: "r-g"},
+	}
+	rows := panelButtons(t, rolePanel(roles, []string{"r-g", "unrelated"}))
+
+	if len(rows) != 1 || len(rows[0]) != 3 {
+		t.Fatalf("got %d rows %v, want one row of 3 buttons", len(rows), rows)
+	}
+	want := []struct {
+		label, id string
+		style     discordgo.ButtonStyle
+	}{
+		{"A C E", "lineroles:r-ace", discordgo.SecondaryButton},
+		{"B D", "lineroles:r-bdfm", discordgo.SecondaryButton},
+		{"G", "lineroles:r-g", discordgo.SuccessButton},
+	}
+	for i, w := range want {
+		b := rows[0][i]
+		if b.Label != w.label || b.CustomID != w.id || b.Style != w.style {
+			t.Errorf("button %d = %q %q style %d, want %q %q style %d", i, b.Label, b.CustomID, b.Style, w.label, w.id, w.style)
+		}
+	}
+}
+
+func TestRolePanelLimits(t *testing.T) {
+	roles := make([]db.GuildLineRole, 0, 30)
+	for i := range 30 {
+		roles = append(roles, db.GuildLineRole{LineID: fmt.Sprint(i), RoleID: fmt.Sprintf("r%d", i)})
+	}
+	rows := panelButtons(t, rolePanel(roles, nil))
+
+	// Discord allows 5 rows of 5 buttons.
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows, want 5", len(rows))
+	}
+	for i, row := range rows {
+		if len(row) != 5 {
+			t.Errorf("row %d has %d buttons, want 5", i, len(row))
+		}
+	}
+	if last := rows[4][4].CustomID; last != "lineroles:r24" {
+		t.Errorf("last button = %q, want the 25th role", last)
+	}
+
+	// Seven buttons wrap onto a second row.
+	rows = panelButtons(t, rolePanel(roles[:7], nil))
+	if len(rows) != 2 || len(rows[0]) != 5 || len(rows[1]) != 2 {
+		t.Errorf("7 roles laid out as %v", rows)
+	}
+
+	// Labels fit Discord's 80 character limit.
+	many := make([]db.GuildLineRole, 0, 40)
+	for i := range 40 {
+		many = append(many, db.GuildLineRole{LineID: fmt.Sprintf("L%02d", i), RoleID: "r"})
+	}
+	rows = panelButtons(t, rolePanel(many, nil))
+	label := rows[0][0].Label
+	if n := len([]rune(label)); n != 80 || !strings.HasPrefix(label, "L00 L01") {
+		t.Errorf("label %q is %d runes, want 80", label, n)
+	}
+}
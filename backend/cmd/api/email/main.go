@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/email"
+	"github.com/Ryley4/NYCTcord/backend/internal/notify"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+func main() {
+	dsn := flag.String("db", db.DSNFromEnv(), "sqlite path or postgres:// DSN (default $NYCTCORD_DB)")
+	every := flag.Duration("every", 10*time.Second, "how often to send pending email notifications")
+	flag.Parse()
+
+	cfg := email.ConfigFromEnv()
+	if err := cfg.Check(); err != nil {
+		log.Fatal(err)
+	}
+
+	database, err := db.Open(*dsn)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	registry := notify.NewRegistry()
+	registry.Register(db.ChannelEmail, &email.Notifier{DB: database, Sender: email.NewSender(cfg), Templates: templates.FromEnv()})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("email: sending through %s:%d", cfg.Host, cfg.Port)
+	notify.NewDispatcher(database, registry).Run(ctx, *every)
+	log.Println("email: shutting down")
+}
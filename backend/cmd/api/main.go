@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"time"
@@ -10,15 +11,24 @@ import (
 )
 
 func main() {
-	database, err := db.Open("nyctcord.db")
+	database, err := db.Open(db.DSNFromEnv())
 	if err != nil {
 		log.Fatalf("open db: %v", err)
 	}
 	defer database.Close()
 
 	server := api.NewServer(database)
+	// Email is optional, but half-configured email would send unsubscribe
+	// links that can't be verified.
+	if cfg := server.Mailer.Config; cfg.Host != "" {
+		if err := cfg.Check(); err != nil {
+			log.Fatalf("email: %v", err)
+		}
+	}
 	router := server.Router()
 
+	go server.Broker.Run(context.Background())
+
 	srv := &http.Server{
 		Addr:         ":8080",
 		Handler:      router,
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+const usage = `usage: nyctcord [-db dsn] <command> [args]
+
+commands:
+  migrate status        show applied and pending migrations
+  migrate up            apply all pending migrations
+  migrate down [-n N]   revert the newest N migrations (default 1)
+  prune [flags]         delete old notifications and alerts (see prune -h)
+  backup <dest>         copy the live database to dest (SQLite only)
+  restore <src>         replace the database with the backup at src (SQLite only;
+                        restart the other processes afterwards)
+`
+
+func main() {
+	dsn := flag.String("db", db.DSNFromEnv(), "sqlite path or postgres:// DSN (default $NYCTCORD_DB)")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "migrate":
+		err = runMigrate(*dsn, args[1:])
+	case "prune":
+		err = runPrune(*dsn, args[1:])
+	case "backup":
+		err = runBackup(*dsn, args[1:])
+	case "restore":
+		err = runRestore(*dsn, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("nyctcord %s: %v", args[0], err)
+	}
+}
+
+func runMigrate(dsn string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing subcommand (status, up, down)")
+	}
+
+	database, err := db.Connect(dsn)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		states, err := database.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", st.Version, st.Name, applied)
+		}
+		return nil
+
+	case "up":
+		n, err := database.MigrateUp(ctx)
+		fmt.Printf("applied %d migrations\n", n)
+		return err
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("n", 1, "number of migrations to revert")
+		fs.Parse(args[1:])
+
+		n, err := database.MigrateDown(ctx, *steps)
+		fmt.Printf("reverted %d migrations\n", n)
+		return err
+
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func runPrune(dsn string, args []string) error {
+	def := db.DefaultRetentionPolicy()
+
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting it")
+	sentDays := fs.Int("keep-sent-days", days(def.SentNotifications), "days to keep sent notifications (0 keeps forever)")
+	failedDays := fs.Int("keep-failed-days", days(def.FailedNotifications), "days to keep failed notifications (0 keeps forever)")
+	alertDays := fs.Int("keep-alerts-days", days(def.Alerts), "days to keep alerts before folding them into daily rollups (0 keeps forever)")
+	vacuum := fs.String("vacuum", string(db.VacuumIncremental), "vacuum after pruning: none, incremental or full (full also converts old SQLite files to incremental; stop the other processes first)")
+	fs.Parse(args)
+
+	database, err := db.Open(dsn)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	policy := db.RetentionPolicy{
+		SentNotifications:   time.Duration(*sentDays) * 24 * time.Hour,
+		FailedNotifications: time.Duration(*failedDays) * 24 * time.Hour,
+		Alerts:              time.Duration(*alertDays) * 24 * time.Hour,
+	}
+
+	report, err := database.Prune(ctx, policy, time.Now(), *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+
+	if *dryRun {
+		return nil
+	}
+	return database.Vacuum(ctx, db.VacuumMode(*vacuum))
+}
+
+func days(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
+
+func runBackup(dsn string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: nyctcord backup <dest>")
+	}
+
+	database, err := db.Connect(dsn)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.Backup(context.Background(), args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("backed up to %s\n", args[0])
+	return nil
+}
+
+func runRestore(dsn string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: nyctcord restore <src>")
+	}
+
+	database, err := db.Connect(dsn)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.Restore(context.Background(), args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("restored from %s\n", args[0])
+	return nil
+}
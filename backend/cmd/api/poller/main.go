@@ -2,40 +2,53 @@ package main
 
 import (
 	"context"
-	"crypto/sha256"
-	"database/sql"
-	"encoding/hex"
-	"fmt"
-	"io"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
-	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
 	"github.com/Ryley4/NYCTcord/backend/internal/db"
-	"google.golang.org/protobuf/proto"
+	"github.com/Ryley4/NYCTcord/backend/internal/poller"
+	"github.com/Ryley4/NYCTcord/backend/internal/stats"
 )
 
 var defaultFeeds = []string{
 	"https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/camsys%2Fsubway-alerts",
 }
 
-type bestAlert struct {
-	effect string
-	header string
-	body   string
-	hash   string
-}
-
 func main() {
-	database, err := db.Open("nyctcord.db")
+	dsn := flag.String("db", db.DSNFromEnv(), "sqlite path or postgres:// DSN (default $NYCTCORD_DB)")
+	replayDir := flag.String("replay", "", "replay .pb snapshots from this directory instead of fetching feeds")
+	recordDir := flag.String("record", "", "save every fetched feed as a .pb snapshot in this directory")
+	rollupEvery := flag.Duration("rollup-every", time.Hour, "how often to compute daily stats rollups for finished days (0 disables)")
+	pruneEvery := flag.Duration("prune-every", 24*time.Hour, "how often to apply the retention policy (0 disables)")
+	backupDir := flag.String("backup-dir", "", "write periodic SQLite backups into this directory")
+	backupEvery := flag.Duration("backup-every", 6*time.Hour, "how often to back up when -backup-dir is set")
+	backupKeep := flag.Int("backup-keep", 7, "number of periodic backups to keep (0 keeps all)")
+	flag.Parse()
+
+	database, err := db.Open(*dsn)
 	if err != nil {
 		log.Fatalf("open db: %v", err)
 	}
 	defer database.Close()
 
+	if *replayDir != "" {
+		if err := replay(database, *replayDir); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		return
+	}
+
+	if *recordDir != "" {
+		if err := os.MkdirAll(*recordDir, 0o755); err != nil {
+			log.Fatalf("record dir: %v", err)
+		}
+	}
+
 	feeds := defaultFeeds
 	if v := strings.TrimSpace(os.Getenv("MTA_FEEDS")); v != "" {
 		parts := strings.Split(v, ",")
@@ -52,258 +65,140 @@ func main() {
 	}
 
 	client := &http.Client{Timeout: 15 * time.Second}
+	proc := poller.NewProcessor(database)
 
-	runOnce(database, client, feeds)
-
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		runOnce(database, client, feeds)
+	if *recordDir != "" {
+		proc.Recorder = &poller.Recorder{Dir: *recordDir}
 	}
-}
-
-func runOnce(database *db.DB, client *http.Client, feeds []string) {
-	log.Printf("poller: fetching %d feeds", len(feeds))
-
-	bestByLine := map[string]bestAlert{}
-	now := uint64(time.Now().Unix())
 
+	sources := make([]poller.FeedSource, 0, len(feeds))
 	for _, url := range feeds {
-		msg, err := fetchFeed(client, url)
-		if err != nil {
-			log.Printf("poller: fetch error (%s): %v", url, err)
-			continue
-		}
-
-		for _, ent := range msg.GetEntity() {
-			alert := ent.GetAlert()
-			if alert == nil {
-				continue
-			}
-			if !isActiveNow(alert, now) {
-				continue
-			}
-
-			effect := alert.GetEffect().String()
-			header := firstTranslation(alert.GetHeaderText())
-			body := firstTranslation(alert.GetDescriptionText())
-			h := contentHash(effect, header, body)
-
-			cand := bestAlert{
-				effect: effect,
-				header: header,
-				body:   body,
-				hash:   h,
-			}
+		sources = append(sources, &poller.HTTPSource{Client: client, URL: url})
+	}
 
-			for _, ie := range alert.GetInformedEntity() {
-				lineID := strings.TrimSpace(ie.GetRouteId())
-				if lineID == "" {
-					continue
-				}
+	runOnce(proc, sources)
 
-				cur, ok := bestByLine[lineID]
-				if !ok || severityRank(cand.effect) > severityRank(cur.effect) {
-					bestByLine[lineID] = cand
-				}
-			}
-		}
+	var rollupC <-chan time.Time
+	if *rollupEvery > 0 {
+		rollup(database)
+		rollupTicker := time.NewTicker(*rollupEvery)
+		defer rollupTicker.Stop()
+		rollupC = rollupTicker.C
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
 
-	changedCount := 0
-	for lineID, a := range bestByLine {
-		status := statusFromEffect(a.effect)
-
-		changed, err := upsertLineStatusIfChanged(
-			ctx,
-			database,
-			lineID,
-			status,
-			a.header,
-			a.body,
-			a.effect,
-			a.hash,
-		)
-		if err != nil {
-			log.Printf("poller: upsert error for line %s: %v", lineID, err)
-			continue
-		}
-		if changed {
-			changedCount++
+	var pruneC <-chan time.Time
+	if *pruneEvery > 0 {
+		pruneTicker := time.NewTicker(*pruneEvery)
+		defer pruneTicker.Stop()
+		pruneC = pruneTicker.C
+	}
+
+	var backupC <-chan time.Time
+	if *backupDir != "" && *backupEvery > 0 {
+		backupTicker := time.NewTicker(*backupEvery)
+		defer backupTicker.Stop()
+		backupC = backupTicker.C
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			runOnce(proc, sources)
+		case <-rollupC:
+			rollup(database)
+		case <-pruneC:
+			prune(database)
+		case <-backupC:
+			backup(database, *backupDir, *backupKeep)
 		}
 	}
-
-	log.Printf("poller: changed %d lines", changedCount)
 }
 
-func fetchFeed(client *http.Client, url string) (*gtfsrt.FeedMessage, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func backup(database *db.DB, dir string, keep int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
 
-	b, err := io.ReadAll(resp.Body)
+	dest, err := database.BackupRotate(ctx, dir, keep, time.Now())
 	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		snippet := string(b)
-		if len(snippet) > 200 {
-			snippet = snippet[:200]
-		}
-		return nil, fmt.Errorf("HTTP %d from %s: %q", resp.StatusCode, url, snippet)
+		log.Printf("poller: backup error: %v", err)
+		return
 	}
-
-	var msg gtfsrt.FeedMessage
-	if err := proto.Unmarshal(b, &msg); err != nil {
-		return nil, fmt.Errorf("unmarshal failed (content-type=%q bytes=%d): %w",
-			resp.Header.Get("Content-Type"), len(b), err)
-	}
-	return &msg, nil
+	log.Printf("poller: backed up to %s", dest)
 }
 
-func isActiveNow(a *gtfsrt.Alert, now uint64) bool {
-	aps := a.GetActivePeriod()
-	if len(aps) == 0 {
-		return true
-	}
-	for _, ap := range aps {
-		start := ap.GetStart()
-		end := ap.GetEnd()
-		if (start == 0 || now >= start) && (end == 0 || now <= end) {
-			return true
-		}
-	}
-	return false
-}
+// rollup computes the stats rollups of any finished days that don't have
+// them yet. The first run after an upgrade backfills every day on file.
+func rollup(database *db.DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
 
-func firstTranslation(t *gtfsrt.TranslatedString) string {
-	if t == nil || len(t.GetTranslation()) == 0 {
-		return ""
+	if err := stats.EnsureRollups(ctx, database, time.Now()); err != nil {
+		log.Printf("poller: rollup error: %v", err)
 	}
-	return t.GetTranslation()[0].GetText()
 }
 
-func contentHash(effect, header, body string) string {
-	sum := sha256.Sum256([]byte(effect + "\n" + header + "\n" + body))
-	return hex.EncodeToString(sum[:])
-}
+func prune(database *db.DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
 
-func severityRank(effect string) int {
-	switch effect {
-	case "NO_SERVICE":
-		return 5
-	case "REDUCED_SERVICE":
-		return 4
-	case "SIGNIFICANT_DELAYS":
-		return 3
-	case "DETOUR":
-		return 2
-	case "MODIFIED_SERVICE":
-		return 1
-	default:
-		return 0
+	report, err := database.Prune(ctx, db.DefaultRetentionPolicy(), time.Now(), false)
+	if err != nil {
+		log.Printf("poller: prune error: %v", err)
+		return
 	}
-}
+	log.Printf("poller: prune %s", report)
 
-func statusFromEffect(effect string) string {
-	switch effect {
-	case "NO_SERVICE":
-		return "No Service"
-	case "REDUCED_SERVICE":
-		return "Reduced Service"
-	case "SIGNIFICANT_DELAYS":
-		return "Delays"
-	case "DETOUR", "MODIFIED_SERVICE":
-		return "Service Change"
-	default:
-		return "Alert"
+	// Only ever incremental here: a full VACUUM would lock out the api
+	// and bot for as long as it takes.
+	err = database.Vacuum(ctx, db.VacuumIncremental)
+	if errors.Is(err, db.ErrNotIncremental) {
+		log.Printf("poller: WARNING: space freed by pruning isn't being reclaimed: %v", err)
+	} else if err != nil {
+		log.Printf("poller: vacuum error: %v", err)
 	}
 }
 
-func nullIfEmpty(s string) any {
-	if strings.TrimSpace(s) == "" {
-		return nil
-	}
-	return s
-}
+func runOnce(proc *poller.Processor, sources []poller.FeedSource) {
+	log.Printf("poller: fetching %d feeds", len(sources))
 
-func upsertLineStatusIfChanged(
-	ctx context.Context,
-	database *db.DB,
-	lineID,
-	status,
-	header,
-	body,
-	effect,
-	hash string,
-) (bool, error) {
-	var existingHash sql.NullString
-	var existingStatus sql.NullString
-
-	err := database.QueryRowContext(ctx,
-		`SELECT content_hash, status FROM line_status WHERE line_id = ?`,
-		lineID,
-	).Scan(&existingHash, &existingStatus)
-
-	if err != nil && err != sql.ErrNoRows {
-		return false, err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	if err != sql.ErrNoRows && existingHash.Valid && existingHash.String == hash {
-		return false, nil
+	transitions, err := proc.Run(ctx, sources)
+	if err != nil {
+		log.Printf("poller: run error: %v", err)
+		return
 	}
 
-	oldStatus := ""
-	if existingStatus.Valid {
-		oldStatus = existingStatus.String
-	}
+	log.Printf("poller: changed %d lines", len(transitions))
+}
 
-	res, err := database.ExecContext(ctx, `
-		INSERT INTO alerts (alert_id, line_id, old_status, new_status, header, body, effect, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'))
-	`, "", lineID, oldStatus, status, nullIfEmpty(header), nullIfEmpty(body), nullIfEmpty(effect))
+func replay(database *db.DB, dir string) error {
+	groups, skipped, err := poller.LoadSnapshots(dir)
 	if err != nil {
-		return false, err
+		return err
+	}
+	for _, name := range skipped {
+		log.Printf("poller: replay skipping %s (expected <unix>-<index>.pb)", name)
 	}
 
-	alertRowID, _ := res.LastInsertId()
+	log.Printf("poller: replaying %d polls from %s", len(groups), dir)
 
-	_, err = database.ExecContext(ctx, `
-		INSERT INTO notifications (user_id, alert_id, line_id, channel_type, status, created_at)
-		SELECT s.user_id, ?, ?, 'dm', 'pending', datetime('now')
-		FROM subscriptions s
-		WHERE s.line_id = ? OR s.line_id = 'ALL'
-	`, alertRowID, lineID, lineID)
-	if err != nil {
-		return false, err
-	}
+	proc := poller.NewProcessor(database)
+	for _, g := range groups {
+		at := g.At
+		proc.Now = func() time.Time { return at }
 
-	_, err = database.ExecContext(ctx, `
-		INSERT INTO line_status (line_id, status, header, body, effect, content_hash, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, datetime('now'))
-		ON CONFLICT(line_id) DO UPDATE SET
-			status       = excluded.status,
-			header       = excluded.header,
-			body         = excluded.body,
-			effect       = excluded.effect,
-			content_hash = excluded.content_hash,
-			updated_at   = excluded.updated_at
-	`, lineID, status, nullIfEmpty(header), nullIfEmpty(body), nullIfEmpty(effect), hash)
-	if err != nil {
-		return false, err
+		transitions, err := proc.Run(context.Background(), g.Sources)
+		if err != nil {
+			return err
+		}
+		log.Printf("poller: replay tick %s (%d feeds): changed %d lines",
+			at.UTC().Format(time.RFC3339), len(g.Sources), len(transitions))
 	}
 
-	return true, nil
+	return nil
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/notify"
+	"github.com/Ryley4/NYCTcord/backend/internal/slack"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+func main() {
+	dsn := flag.String("db", db.DSNFromEnv(), "sqlite path or postgres:// DSN (default $NYCTCORD_DB)")
+	every := flag.Duration("every", 10*time.Second, "how often to send pending Slack notifications")
+	flag.Parse()
+
+	database, err := db.Open(*dsn)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	client := slack.NewClient()
+	if v := strings.TrimSpace(os.Getenv("SLACK_API_URL")); v != "" {
+		client.BaseURL = v
+	}
+	registry := notify.NewRegistry()
+	registry.Register(db.ChannelSlack, &slack.Notifier{DB: database, Client: client, Templates: templates.FromEnv()})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Println("slack: sender started")
+	notify.NewDispatcher(database, registry).Run(ctx, *every)
+	log.Println("slack: shutting down")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/webhook"
+)
+
+func main() {
+	dsn := flag.String("db", db.DSNFromEnv(), "sqlite path or postgres:// DSN (default $NYCTCORD_DB)")
+	every := flag.Duration("every", 5*time.Second, "how often to look for due deliveries")
+	flag.Parse()
+
+	database, err := db.Open(*dsn)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("webhook: delivering every %s", *every)
+	webhook.NewWorker(database).Run(ctx, *every)
+	log.Println("webhook: shutting down")
+}
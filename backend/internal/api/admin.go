@@ -0,0 +1,96 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+func adminTokenFromEnv() string {
+	return strings.TrimSpace(os.Getenv("NYCTCORD_ADMIN_TOKEN"))
+}
+
+// requireAdmin checks for "Authorization: Bearer $NYCTCORD_ADMIN_TOKEN".
+// Without a token configured the admin API doesn't exist.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(s.AdminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type previewTemplateRequest struct {
+	Channel string `json:"channel"`
+	// Kind defaults to the kind of the alert.
+	Kind    string `json:"kind"`
+	AlertID int64  `json:"alert_id"`
+	// Template is optional source parsed over the configured templates.
+	Template string `json:"template"`
+}
+
+type previewTemplateResponse struct {
+	Channel string `json:"channel"`
+	Kind    string `json:"kind"`
+	templates.Rendered
+}
+
+// handlePreviewTemplate serves POST /api/admin/templates/preview.
+func (s *Server) handlePreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	var req previewTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	channel := strings.ToLower(strings.TrimSpace(req.Channel))
+	if !slices.Contains(templates.Channels, channel) {
+		http.Error(w, "channel must be one of "+strings.Join(templates.Channels, ", "), http.StatusBadRequest)
+		return
+	}
+
+	if req.AlertID <= 0 {
+		http.Error(w, "alert_id required", http.StatusBadRequest)
+		return
+	}
+	a, err := s.DB.Alerts().Get(r.Context(), req.AlertID)
+	if err == db.ErrNotFound {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	data := templates.FromAlert(a)
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	switch {
+	case kind == "":
+		kind = data.Kind
+	case !slices.Contains(templates.Kinds, kind):
+		http.Error(w, "kind must be one of "+strings.Join(templates.Kinds, ", "), http.StatusBadRequest)
+		return
+	}
+
+	out, err := s.Templates.Preview(channel, kind, data, req.Template)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	writeJSON(w, previewTemplateResponse{Channel: channel, Kind: kind, Rendered: out})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+type alertPage struct {
+	Alerts     []db.Alert `json:"alerts"`
+	NextCursor *string    `json:"next_cursor"`
+}
+
+// handleListAlerts serves GET /api/alerts, newest first.
+//
+// Query parameters:
+//
+//	line    line ID, comma-separated for several
+//	effect  GTFS-RT effect (NO_SERVICE, ...), comma-separated for several
+//	status  new status after the transition ("Delays", "No Service", ...)
+//	from    inclusive start, RFC 3339 or YYYY-MM-DD (UTC)
+//	to      exclusive end, same formats
+//	q       case-insensitive text to find in the header or body
+//	cursor  next_cursor from the previous page
+//	limit   page size, default 50, max 200
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f := db.AlertFilter{
+		LineIDs: splitList(q.Get("line")),
+		Effects: splitList(q.Get("effect")),
+		Status:  strings.TrimSpace(q.Get("status")),
+		Query:   q.Get("q"),
+		Limit:   parseLimit(r, 50, 200),
+	}
+
+	var err error
+	if f.From, err = parseTimeParam(q.Get("from")); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if f.To, err = parseTimeParam(q.Get("to")); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if c := q.Get("cursor"); c != "" {
+		f.Before, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || f.Before <= 0 {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	alerts, err := s.DB.Alerts().List(r.Context(), f)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	page := alertPage{Alerts: alerts}
+	if len(alerts) == f.Limit {
+		next := strconv.FormatInt(alerts[len(alerts)-1].ID, 10)
+		page.NextCursor = &next
+	}
+
+	writeJSON(w, page)
+}
+
+func splitList(v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	out := make([]string, 0)
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// handleSearchAlerts serves GET /api/alerts/search?q=...&limit=..., a
+// full-text search over alert headers and bodies with highlighted snippets,
+// best matches first.
+func (s *Server) handleSearchAlerts(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+
+	results, err := s.DB.Alerts().Search(r.Context(), q, parseLimit(r, 20, 100))
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, results)
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+const (
+	EventAlert      = "alert"
+	EventLineStatus = "line_status"
+)
+
+// Event is one change pushed to streaming clients. ID is the alerts.id that
+// caused it, so clients can resume from the last ID they saw.
+type Event struct {
+	ID     int64  `json:"id"`
+	Type   string `json:"type"`
+	LineID string `json:"line_id"`
+	Data   any    `json:"data"`
+
+	// final marks the last event for its alert. Only it carries an SSE
+	// id, so a client's Last-Event-ID moves past an alert once all of
+	// its events are through.
+	final bool
+}
+
+// Broker fans out new alerts and the line status they produced to
+// subscribers. The poller runs in another process, so the broker finds
+// changes by polling the alerts table for IDs it hasn't seen yet.
+type Broker struct {
+	DB       *db.DB
+	Interval time.Duration
+
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	lastID int64
+}
+
+func NewBroker(database *db.DB) *Broker {
+	return &Broker{
+		DB:       database,
+		Interval: 2 * time.Second,
+		subs:     map[chan Event]struct{}{},
+	}
+}
+
+// Run polls for new alerts until ctx is cancelled.
+func (b *Broker) Run(ctx context.Context) {
+	lastID, err := b.DB.Alerts().MaxID(ctx)
+	if err != nil {
+		log.Printf("broker: initial max id: %v", err)
+	}
+	b.mu.Lock()
+	b.lastID = lastID
+	b.mu.Unlock()
+
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.closeAll()
+			return
+		case <-ticker.C:
+			if err := b.pollOnce(ctx); err != nil {
+				log.Printf("broker: poll error: %v", err)
+			}
+		}
+	}
+}
+
+func (b *Broker) pollOnce(ctx context.Context) error {
+	b.mu.Lock()
+	after := b.lastID
+	b.mu.Unlock()
+
+	for {
+		alerts, err := b.DB.Alerts().Since(ctx, after, 200)
+		if err != nil {
+			return err
+		}
+		if len(alerts) == 0 {
+			return nil
+		}
+
+		events, err := EventsForAlerts(ctx, b.DB, alerts)
+		if err != nil {
+			return err
+		}
+		b.Publish(events...)
+
+		after = alerts[len(alerts)-1].ID
+		b.mu.Lock()
+		b.lastID = after
+		b.mu.Unlock()
+	}
+}
+
+// EventsForAlerts turns alerts into an alert event followed by a
+// line_status event with the line's current state.
+func EventsForAlerts(ctx context.Context, database *db.DB, alerts []db.Alert) ([]Event, error) {
+	events := make([]Event, 0, 2*len(alerts))
+	for _, a := range alerts {
+		events = append(events, Event{ID: a.ID, Type: EventAlert, LineID: a.LineID, Data: a})
+
+		ls, err := database.Lines().Get(ctx, a.LineID)
+		if err != nil && err != db.ErrNotFound {
+			return nil, err
+		}
+		if err == nil {
+			events = append(events, Event{ID: a.ID, Type: EventLineStatus, LineID: a.LineID, Data: ls})
+		}
+		events[len(events)-1].final = true
+	}
+	return events, nil
+}
+
+// Subscribe registers a subscriber with a buffer of size events. The
+// channel is closed when the broker stops or when the subscriber falls
+// behind and its buffer fills; callers should treat a closed channel as a
+// cue to resume from the last ID they handled.
+func (b *Broker) Subscribe(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() { b.unsubscribe(ch) }
+}
+
+func (b *Broker) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Publish delivers events to every subscriber without blocking. It also
+// serves as the notify hook for writers living in the same process.
+func (b *Broker) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			default:
+				delete(b.subs, ch)
+				close(ch)
+			}
+			if _, ok := b.subs[ch]; !ok {
+				break
+			}
+		}
+	}
+}
+
+func (b *Broker) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
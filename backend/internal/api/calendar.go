@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const calendarHorizon = 60 * 24 * time.Hour
+
+type calendarTokenResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// handleGetCalendarToken serves GET /api/calendar/token, creating the
+// user's token on first use. POST rotates it.
+func (s *Server) handleGetCalendarToken(w http.ResponseWriter, r *http.Request) {
+	s.writeCalendarToken(w, r, false)
+}
+
+func (s *Server) handleRotateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	s.writeCalendarToken(w, r, true)
+}
+
+func (s *Server) writeCalendarToken(w http.ResponseWriter, r *http.Request, rotate bool) {
+	token, err := s.DB.Users().CalendarToken(r.Context(), s.currentUserID(r), rotate)
+	if err == db.ErrNotFound {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, calendarTokenResponse{
+		Token: token,
+		URL:   s.PublicURL + "/api/calendar/" + token + ".ics",
+	})
+}
+
+// handleCalendar serves GET /api/calendar/{token}.ics, an iCalendar feed of
+// current and upcoming planned work on the token owner's subscribed lines.
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutSuffix(chi.URLParam(r, "name"), ".ics")
+	if !ok || token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := s.DB.Users().GetByCalendarToken(r.Context(), token)
+	if err == db.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	subs, err := s.DB.Subscriptions().ListForUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	var lines []string
+	all := false
+	for _, sub := range subs {
+		if sub.LineID == "ALL" {
+			all = true
+		}
+		lines = append(lines, sub.LineID)
+	}
+
+	items := []db.PlannedWork{}
+	if all || len(lines) > 0 {
+		if all {
+			lines = nil
+		}
+		now := time.Now().UTC()
+		items, err = s.DB.PlannedWork().Overlapping(r.Context(), lines, now.Add(-24*time.Hour), now.Add(calendarHorizon))
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(s.renderICS(items))
+}
+
+func (s *Server) renderICS(items []db.PlannedWork) []byte {
+	var b bytes.Buffer
+	line := func(name, value string) {
+		foldICS(&b, name+":"+value)
+	}
+
+	stamp := time.Now().UTC().Format(icsTime)
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//NYCTcord//Planned Work//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", "NYCTcord planned work")
+
+	for _, pw := range items {
+		summary := pw.LineID + ": planned work"
+		if pw.Header != nil && strings.TrimSpace(*pw.Header) != "" {
+			summary = pw.LineID + ": " + strings.TrimSpace(*pw.Header)
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("%s-%s-%d@%s", pw.AlertID, pw.LineID, pw.StartsAt.Unix(), s.tagHost()))
+		line("DTSTAMP", stamp)
+		line("LAST-MODIFIED", pw.LastSeenAt.UTC().Format(icsTime))
+		line("DTSTART", pw.StartsAt.UTC().Format(icsTime))
+		if pw.EndsAt != nil {
+			line("DTEND", pw.EndsAt.UTC().Format(icsTime))
+		}
+		line("SUMMARY", escapeICS(summary))
+		if pw.Body != nil && strings.TrimSpace(*pw.Body) != "" {
+			line("DESCRIPTION", escapeICS(strings.TrimSpace(*pw.Body)))
+		}
+		if pw.Effect != nil {
+			line("CATEGORIES", escapeICS(*pw.Effect))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return b.Bytes()
+}
+
+const icsTime = "20060102T150405Z"
+
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICS writes a content line, folding it at 75 octets as RFC 5545
+// requires without splitting UTF-8 sequences.
+func foldICS(b *bytes.Buffer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func TestEscapeICS(t *testing.T) {
+	tests := map[string]string{
+		"plain text":           "plain text",
+		`C:\path`:              `C:\\path`,
+		"a; b, c":              `a\; b\, c`,
+		"line one\nline two":   `line one\nline two`,
+		"line one\r\nline two": `line one\nline two`,
+	}
+	for in, want := range tests {
+		if got := escapeICS(in); got != want {
+			t.Errorf("escapeICS(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFoldICS(t *testing.T) {
+	tests := []string{
+		"SUMMARY:short",
+		"DESCRIPTION:" + strings.Repeat("x", 63), // exactly 75 octets
+		"DESCRIPTION:" + strings.Repeat("x", 200),
+		"DESCRIPTION:" + strings.Repeat("é", 100),
+		"DESCRIPTION:" + strings.Repeat("🚇 ", 60),
+	}
+	for _, in := range tests {
+		var b bytes.Buffer
+		foldICS(&b, in)
+		out := b.String()
+
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Errorf("%q: output doesn't end in CRLF", in)
+		}
+		lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+		for i, l := range lines {
+			if len(l) > 75 {
+				t.Errorf("%q: line %d is %d octets", in, i, len(l))
+			}
+			if i > 0 && !strings.HasPrefix(l, " ") {
+				t.Errorf("%q: continuation line %d doesn't start with a space", in, i)
+			}
+			if !utf8.ValidString(l) {
+				t.Errorf("%q: line %d splits a UTF-8 sequence", in, i)
+			}
+		}
+		if len(in) <= 75 && len(lines) != 1 {
+			t.Errorf("%q: folded a line of %d octets", in, len(in))
+		}
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != in {
+			t.Errorf("unfolding gave %q, want %q", unfolded, in)
+		}
+	}
+}
+
+func TestRenderICS(t *testing.T) {
+	s := &Server{PublicURL: "https://nyctcord.example"}
+	start := time.Date(2025, 7, 12, 4, 0, 0, 0, time.UTC)
+	end := start.Add(20 * time.Hour)
+	header := "No trains between Jay St, Bergen St; take the shuttle bus"
+	effect := "DETOUR"
+	body := strings.Repeat("Shuttle buses make all stops. ", 10)
+
+	out := string(s.renderICS([]db.PlannedWork{
+		{AlertID: "lmm:planned:1", LineID: "F", Header: &header, Body: &body, Effect: &effect, StartsAt: start, EndsAt: &end, LastSeenAt: start},
+		{AlertID: "lmm:planned:2", LineID: "G", StartsAt: start, LastSeenAt: start},
+	}))
+
+	if !strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Fatalf("not a calendar:\n%s", out)
+	}
+	if strings.Contains(strings.ReplaceAll(out, "\r\n", ""), "\n") {
+		t.Error("bare LF in output")
+	}
+
+	events := strings.Split(out, "BEGIN:VEVENT\r\n")[1:]
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2:\n%s", len(events), out)
+	}
+	unfold := func(s string) string { return strings.ReplaceAll(s, "\r\n ", "") }
+
+	first := unfold(events[0])
+	for _, want := range []string{
+		"UID:lmm:planned:1-F-1752292800@nyctcord.example\r\n",
+		"DTSTART:20250712T040000Z\r\n",
+		"DTEND:20250713T000000Z\r\n",
+		`SUMMARY:F: No trains between Jay St\, Bergen St\; take the shuttle bus` + "\r\n",
+		"DESCRIPTION:" + strings.TrimSpace(body) + "\r\n",
+		"CATEGORIES:DETOUR\r\n",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("first event missing %q:\n%s", want, first)
+		}
+	}
+
+	// Work with no known end is open-ended: no DTEND, and the summary
+	// falls back to a generic one.
+	second := unfold(events[1])
+	if strings.Contains(second, "DTEND") {
+		t.Errorf("open-ended event has a DTEND:\n%s", second)
+	}
+	if !strings.Contains(second, "SUMMARY:G: planned work\r\n") || strings.Contains(second, "DESCRIPTION") {
+		t.Errorf("second event:\n%s", second)
+	}
+}
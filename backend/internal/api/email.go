@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/email"
+)
+
+type setEmailRequest struct {
+	Email string `json:"email"`
+}
+
+func (s *Server) handleGetEmail(w http.ResponseWriter, r *http.Request) {
+	st, err := s.DB.Users().EmailStatus(r.Context(), s.currentUserID(r))
+	if err == db.ErrNotFound {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, st)
+}
+
+// handleSetEmail serves POST /api/email. The address starts unverified and
+// a confirmation link is mailed to it; an empty email removes it.
+func (s *Server) handleSetEmail(w http.ResponseWriter, r *http.Request) {
+	var req setEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	address := strings.TrimSpace(req.Email)
+	if address != "" {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Address != address {
+			http.Error(w, "invalid email", http.StatusBadRequest)
+			return
+		}
+		if !s.Mailer.Config.Enabled() {
+			http.Error(w, "email is not configured", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	token, err := s.DB.Users().SetEmail(r.Context(), s.currentUserID(r), address)
+	if err == db.ErrNotFound {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	if address == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	msg, err := s.Mailer.Config.VerifyMessage(address, token)
+	if err == nil {
+		_, err = s.Mailer.Send(r.Context(), msg)
+	}
+	if err != nil {
+		log.Printf("api: send verification email: %v", err)
+		http.Error(w, "could not send verification email", http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleVerifyEmail serves GET /api/email/verify?token=..., the link in the
+// confirmation email.
+func (s *Server) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+
+	_, err := s.DB.Users().VerifyEmail(r.Context(), token, time.Now())
+	if err == db.ErrNotFound {
+		http.Error(w, "invalid or used token", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("Your email address is confirmed. You'll get NYCTcord alerts for lines with email turned on.\n"))
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Unsubscribe from NYCTcord alerts</title></head>
+<body>
+<p>Stop all NYCTcord alert emails? Your other notification channels are not affected.</p>
+<form method="post" action="?token={{.}}">
+<input type="hidden" name="List-Unsubscribe" value="One-Click">
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// handleUnsubscribeEmail serves the unsubscribe link from alert emails. GET
+// is the link itself and only shows a confirmation page, since mail
+// scanners and link previews fetch links without anyone clicking them.
+// POST, from that page or an RFC 8058 one-click client, turns email off on
+// every subscription.
+func (s *Server) handleUnsubscribeEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	userID, ok := email.ParseUnsubscribeToken(s.Mailer.Config.Secret, token)
+	if !ok {
+		http.Error(w, "invalid token", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		unsubscribePage.Execute(w, token)
+		return
+	}
+
+	if err := s.DB.Subscriptions().DisableEmail(r.Context(), userID); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("You've been unsubscribed from NYCTcord alert emails.\n"))
+}
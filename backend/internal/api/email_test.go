@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/email"
+)
+
+func TestUnsubscribeEmail(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+	s.Mailer = email.NewSender(email.Config{Host: "smtp.test", Secret: "s3cret"})
+	ctx := context.Background()
+
+	u, err := s.DB.Users().Upsert(ctx, "100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Subscriptions().ReplaceForUser(ctx, u.ID, []string{"F"}, db.Channels{DM: true, Email: true}); err != nil {
+		t.Fatal(err)
+	}
+	viaEmail := func() bool {
+		t.Helper()
+		subs, err := s.DB.Subscriptions().ListForUser(ctx, u.ID)
+		if err != nil || len(subs) != 1 {
+			t.Fatalf("subscriptions = %+v, %v", subs, err)
+		}
+		return subs[0].ViaEmail
+	}
+	link := ts.URL + "/api/email/unsubscribe?token=" + url.QueryEscape(email.UnsubscribeToken("s3cret", u.ID))
+
+	// Following the link only asks for confirmation.
+	resp, err := http.Get(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `<form method="post"`) {
+		t.Fatalf("GET = %d %q, want a confirmation form", resp.StatusCode, body)
+	}
+	if !viaEmail() {
+		t.Fatal("GET turned email off")
+	}
+
+	// The RFC 8058 one-click POST does the unsubscribing.
+	resp, err = http.Post(link, "application/x-www-form-urlencoded", strings.NewReader("List-Unsubscribe=One-Click"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST = %d", resp.StatusCode)
+	}
+	if viaEmail() {
+		t.Fatal("POST left email on")
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		req, _ := http.NewRequest(method, ts.URL+"/api/email/unsubscribe?token="+url.QueryEscape(email.UnsubscribeToken("wrong", u.ID)), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s with a forged token = %d, want 400", method, resp.StatusCode)
+		}
+	}
+}
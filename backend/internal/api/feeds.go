@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const feedItems = 50
+
+// publicURLFromEnv is the externally visible base URL, used for self links
+// and GUIDs in feeds. Defaults to the local dev address.
+func publicURLFromEnv() string {
+	if v := strings.TrimSpace(os.Getenv("NYCTCORD_PUBLIC_URL")); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return "http://localhost:8080"
+}
+
+// tagURI builds a stable RFC 4151 id. It only depends on the public host and
+// the alert/feed identity, so ids survive restarts and redeploys.
+func (s *Server) tagURI(specific string) string {
+	return "tag:" + s.tagHost() + ",2025:" + specific
+}
+
+func (s *Server) tagHost() string {
+	if u, err := url.Parse(s.PublicURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Description string  `xml:"description,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Category    string  `xml:"category,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published"`
+	Category  *atomCategory `xml:"category"`
+	Content   atomContent   `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func alertTitle(a db.Alert) string {
+	if a.Header != nil && strings.TrimSpace(*a.Header) != "" {
+		return a.LineID + ": " + strings.TrimSpace(*a.Header)
+	}
+	status := ""
+	if a.NewStatus != nil {
+		status = *a.NewStatus
+	}
+	return a.LineID + ": " + status
+}
+
+func alertText(a db.Alert) string {
+	parts := make([]string, 0, 2)
+	if a.OldStatus != nil && a.NewStatus != nil && *a.OldStatus != "" {
+		parts = append(parts, *a.OldStatus+" → "+*a.NewStatus)
+	} else if a.NewStatus != nil {
+		parts = append(parts, *a.NewStatus)
+	}
+	if a.Body != nil && strings.TrimSpace(*a.Body) != "" {
+		parts = append(parts, strings.TrimSpace(*a.Body))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// handleFeed serves /feeds/{line}.rss, /feeds/{line}.atom and the "all"
+// variants. Responses carry ETag and Last-Modified from the newest alert,
+// so readers polling with If-None-Match/If-Modified-Since get a 304.
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	dot := strings.LastIndexByte(name, '.')
+	if dot <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	lineID, format := strings.ToUpper(name[:dot]), name[dot+1:]
+	if format != "rss" && format != "atom" {
+		http.NotFound(w, r)
+		return
+	}
+
+	filter := db.AlertFilter{Limit: feedItems}
+	title := "NYCTcord: all lines"
+	modified := time.Unix(0, 0).UTC()
+
+	if lineID != "ALL" {
+		line, err := s.DB.Lines().Get(r.Context(), lineID)
+		if err == db.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		filter.LineIDs = []string{lineID}
+		title = "NYCTcord: " + lineID + " line"
+		modified = line.UpdatedAt.UTC()
+	}
+
+	alerts, err := s.DB.Alerts().List(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	var newestID int64
+	if len(alerts) > 0 {
+		newestID = alerts[0].ID
+		modified = alerts[0].CreatedAt.UTC()
+	}
+
+	self := s.PublicURL + "/feeds/" + strings.ToLower(lineID) + "." + format
+
+	var body []byte
+	if format == "rss" {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		body, err = s.renderRSS(title, self, modified, alerts)
+	} else {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		body, err = s.renderAtom(lineID, title, self, modified, alerts)
+	}
+	if err != nil {
+		http.Error(w, "render error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s-%d"`, strings.ToLower(lineID), format, newestID))
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+func (s *Server) renderRSS(title, self string, modified time.Time, alerts []db.Alert) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          s.PublicURL,
+			Description:   "NYC subway service changes",
+			LastBuildDate: modified.Format(time.RFC1123Z),
+			Self:          atomLink{Href: self, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssItem, 0, len(alerts)),
+		},
+	}
+
+	for _, a := range alerts {
+		item := rssItem{
+			Title:       alertTitle(a),
+			Description: alertText(a),
+			GUID:        rssGUID{Value: s.tagURI(fmt.Sprintf("alert/%d", a.ID))},
+			PubDate:     a.CreatedAt.UTC().Format(time.RFC1123Z),
+		}
+		if a.Effect != nil {
+			item.Category = *a.Effect
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	return marshalFeed(feed)
+}
+
+func (s *Server) renderAtom(lineID, title, self string, modified time.Time, alerts []db.Alert) ([]byte, error) {
+	feed := atomFeed{
+		ID:      s.tagURI("feed/" + strings.ToLower(lineID)),
+		Title:   title,
+		Updated: modified.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: s.PublicURL, Rel: "alternate"},
+		},
+		Author:  atomAuthor{Name: "NYCTcord"},
+		Entries: make([]atomEntry, 0, len(alerts)),
+	}
+
+	for _, a := range alerts {
+		ts := a.CreatedAt.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        s.tagURI(fmt.Sprintf("alert/%d", a.ID)),
+			Title:     alertTitle(a),
+			Updated:   ts,
+			Published: ts,
+			Content:   atomContent{Type: "text", Value: alertText(a)},
+		}
+		if a.Effect != nil {
+			entry.Category = &atomCategory{Term: *a.Effect}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshalFeed(feed)
+}
+
+func marshalFeed(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
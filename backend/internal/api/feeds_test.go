@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+type feedFixture struct {
+	db  *db.DB
+	url string
+	at  time.Time
+}
+
+func (f *feedFixture) insert(t *testing.T, line, header, effect string, at time.Time) {
+	t.Helper()
+	old, status := db.StatusGoodService, "Delays"
+	a := db.Alert{LineID: line, OldStatus: &old, NewStatus: &status, CreatedAt: at}
+	if header != "" {
+		body := "Expect delays."
+		a.Header, a.Body = &header, &body
+	}
+	if effect != "" {
+		a.Effect = &effect
+	}
+	if _, err := f.db.Alerts().Insert(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newFeedFixture(t *testing.T) *feedFixture {
+	t.Helper()
+	database := openTestDB(t)
+	ts := httptest.NewServer((&Server{DB: database, PublicURL: "https://nyctcord.example"}).Router())
+	t.Cleanup(ts.Close)
+
+	f := &feedFixture{db: database, url: ts.URL, at: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	for _, line := range []string{"F", "G"} {
+		if err := database.Lines().Upsert(context.Background(), db.LineStatus{LineID: line, Status: "Delays", UpdatedAt: f.at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.insert(t, "F", "Signal problems at Jay St", "SIGNIFICANT_DELAYS", f.at)
+	f.insert(t, "G", "", "", f.at.Add(time.Minute))
+	f.insert(t, "F", "Sick customer at Bergen St", "", f.at.Add(2*time.Minute))
+	return f
+}
+
+func (f *feedFixture) get(t *testing.T, path string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest("GET", f.url+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestFeedRSS(t *testing.T) {
+	f := newFeedFixture(t)
+	resp, body := f.get(t, "/feeds/all.rss", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/rss+xml; charset=utf-8" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+
+	var feed rssFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("decode: %v\n%s", err, body)
+	}
+	if feed.Version != "2.0" || feed.Channel.Title != "NYCTcord: all lines" {
+		t.Errorf("channel = %+v", feed.Channel)
+	}
+	if !strings.Contains(string(body), `<atom:link href="https://nyctcord.example/feeds/all.rss" rel="self" type="application/rss+xml">`) {
+		t.Errorf("missing self link:\n%s", body)
+	}
+	if want := f.at.Add(2 * time.Minute).Format(time.RFC1123Z); feed.Channel.LastBuildDate != want {
+		t.Errorf("lastBuildDate = %s, want %s", feed.Channel.LastBuildDate, want)
+	}
+
+	want := []rssItem{
+		{
+			Title:       "F: Sick customer at Bergen St",
+			Description: "Good Service → Delays\n\nExpect delays.",
+			GUID:        rssGUID{Value: "tag:nyctcord.example,2025:alert/3"},
+			PubDate:     "Sat, 01 Mar 2025 12:02:00 +0000",
+		},
+		{
+			// Without a header the title falls back to the status.
+			Title:       "G: Delays",
+			Description: "Good Service → Delays",
+			GUID:        rssGUID{Value: "tag:nyctcord.example,2025:alert/2"},
+			PubDate:     "Sat, 01 Mar 2025 12:01:00 +0000",
+		},
+		{
+			Title:       "F: Signal problems at Jay St",
+			Description: "Good Service → Delays\n\nExpect delays.",
+			GUID:        rssGUID{Value: "tag:nyctcord.example,2025:alert/1"},
+			PubDate:     "Sat, 01 Mar 2025 12:00:00 +0000",
+			Category:    "SIGNIFICANT_DELAYS",
+		},
+	}
+	if len(feed.Channel.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(feed.Channel.Items), len(want))
+	}
+	for i, item := range feed.Channel.Items {
+		if item != want[i] {
+			t.Errorf("item %d = %+v, want %+v", i, item, want[i])
+		}
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	f := newFeedFixture(t)
+	resp, body := f.get(t, "/feeds/f.atom", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("decode: %v\n%s", err, body)
+	}
+	if feed.ID != "tag:nyctcord.example,2025:feed/f" || feed.Title != "NYCTcord: F line" || feed.Updated != "2025-03-01T12:02:00Z" {
+		t.Errorf("feed = %+v", feed)
+	}
+	if len(feed.Links) != 2 || feed.Links[0] != (atomLink{Href: "https://nyctcord.example/feeds/f.atom", Rel: "self", Type: "application/atom+xml"}) {
+		t.Errorf("links = %+v", feed.Links)
+	}
+
+	// Only the F line's alerts, newest first.
+	if len(feed.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(feed.Entries))
+	}
+	first, second := feed.Entries[0], feed.Entries[1]
+	if first.ID != "tag:nyctcord.example,2025:alert/3" || first.Title != "F: Sick customer at Bergen St" ||
+		first.Published != "2025-03-01T12:02:00Z" || first.Category != nil {
+		t.Errorf("first entry = %+v", first)
+	}
+	if first.Content != (atomContent{Type: "text", Value: "Good Service → Delays\n\nExpect delays."}) {
+		t.Errorf("first content = %+v", first.Content)
+	}
+	if second.ID != "tag:nyctcord.example,2025:alert/1" || second.Category == nil || second.Category.Term != "SIGNIFICANT_DELAYS" {
+		t.Errorf("second entry = %+v", second)
+	}
+
+	for _, path := range []string{"/feeds/z.rss", "/feeds/f.json", "/feeds/f", "/feeds/.rss"} {
+		if resp, _ := f.get(t, path, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: %s, want 404", path, resp.Status)
+		}
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	f := newFeedFixture(t)
+
+	resp, _ := f.get(t, "/feeds/f.rss", nil)
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != `"f-rss-3"` {
+		t.Errorf("ETag = %s", etag)
+	}
+	if modified != "Sat, 01 Mar 2025 12:02:00 GMT" {
+		t.Errorf("Last-Modified = %s", modified)
+	}
+
+	for name, h := range map[string]http.Header{
+		"If-None-Match":     {"If-None-Match": {etag}},
+		"If-Modified-Since": {"If-Modified-Since": {modified}},
+	} {
+		resp, body := f.get(t, "/feeds/f.rss", h)
+		if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+			t.Errorf("%s: %s with %d bytes, want 304 and no body", name, resp.Status, len(body))
+		}
+	}
+
+	// Each format and feed has its own tag.
+	if resp, _ := f.get(t, "/feeds/f.atom", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("atom with the rss ETag: %s, want 200", resp.Status)
+	}
+
+	// An alert on another line leaves the F feed unchanged.
+	f.insert(t, "G", "", "", f.at.Add(3*time.Minute))
+	if resp, _ := f.get(t, "/feeds/f.rss", http.Header{"If-None-Match": {etag}}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("after a G alert: %s, want 304", resp.Status)
+	}
+
+	// A new F alert invalidates both validators.
+	f.insert(t, "F", "Delays cleared", "", f.at.Add(4*time.Minute))
+	for name, h := range map[string]http.Header{
+		"If-None-Match":     {"If-None-Match": {etag}},
+		"If-Modified-Since": {"If-Modified-Since": {modified}},
+	} {
+		resp, _ := f.get(t, "/feeds/f.rss", h)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s after a new alert: %s, want 200", name, resp.Status)
+		}
+		if resp.Header.Get("ETag") == etag {
+			t.Errorf("%s after a new alert: ETag unchanged", name)
+		}
+	}
+}
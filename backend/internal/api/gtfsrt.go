@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// AlertsFeed builds a full-dataset GTFS-RT FeedMessage from the current line
+// statuses. Lines disrupted by the same alert share one entity, keyed by the
+// alert's content hash so the id stays stable between requests.
+func AlertsFeed(lines []db.LineStatus, now time.Time) *gtfsrt.FeedMessage {
+	type group struct {
+		first db.LineStatus
+		lines []string
+	}
+	groups := map[string]*group{}
+	updated := time.Time{}
+
+	for _, ls := range lines {
+		// Resolutions change the feed too, so every line counts towards
+		// the header timestamp.
+		if ls.UpdatedAt.After(updated) {
+			updated = ls.UpdatedAt
+		}
+		if !db.IsDisrupted(ls.Status) {
+			continue
+		}
+
+		key := ls.ContentHash
+		if key == "" {
+			key = "line:" + ls.LineID
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{first: ls}
+			groups[key] = g
+		} else if ls.UpdatedAt.Before(g.first.UpdatedAt) {
+			g.first.UpdatedAt = ls.UpdatedAt
+		}
+		g.lines = append(g.lines, ls.LineID)
+	}
+
+	if updated.IsZero() {
+		updated = now
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	entities := make([]*gtfsrt.FeedEntity, 0, len(groups))
+	for _, key := range keys {
+		g := groups[key]
+		sort.Strings(g.lines)
+
+		id := key
+		if len(id) > 16 {
+			id = id[:16]
+		}
+
+		alert := &gtfsrt.Alert{
+			ActivePeriod: []*gtfsrt.TimeRange{{Start: proto.Uint64(uint64(g.first.UpdatedAt.Unix()))}},
+			Cause:        gtfsrt.Alert_UNKNOWN_CAUSE.Enum(),
+			Effect:       gtfsrt.Alert_UNKNOWN_EFFECT.Enum(),
+		}
+		if g.first.Effect != nil {
+			if v, ok := gtfsrt.Alert_Effect_value[*g.first.Effect]; ok {
+				alert.Effect = gtfsrt.Alert_Effect(v).Enum()
+			}
+		}
+		if g.first.Header != nil && *g.first.Header != "" {
+			alert.HeaderText = translated(*g.first.Header)
+		} else {
+			alert.HeaderText = translated(g.first.Status)
+		}
+		if g.first.Body != nil && *g.first.Body != "" {
+			alert.DescriptionText = translated(*g.first.Body)
+		}
+		for _, lineID := range g.lines {
+			alert.InformedEntity = append(alert.InformedEntity, &gtfsrt.EntitySelector{RouteId: proto.String(lineID)})
+		}
+
+		entities = append(entities, &gtfsrt.FeedEntity{
+			Id:    proto.String("nyctcord:" + id),
+			Alert: alert,
+		})
+	}
+
+	return &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfsrt.FeedHeader_FULL_DATASET.Enum(),
+			Timestamp:           proto.Uint64(uint64(updated.Unix())),
+		},
+		Entity: entities,
+	}
+}
+
+func translated(s string) *gtfsrt.TranslatedString {
+	return &gtfsrt.TranslatedString{
+		Translation: []*gtfsrt.TranslatedString_Translation{{Text: proto.String(s), Language: proto.String("en")}},
+	}
+}
+
+// handleGTFSRTAlerts serves GET /gtfs-rt/alerts.pb, the current state as a
+// GTFS-RT Alerts feed. ?format=json returns the same message as JSON for
+// debugging.
+func (s *Server) handleGTFSRTAlerts(w http.ResponseWriter, r *http.Request) {
+	lines, err := s.DB.Lines().List(r.Context())
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	msg := AlertsFeed(lines, time.Now())
+
+	var body []byte
+	if r.URL.Query().Get("format") == "json" {
+		body, err = protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(msg)
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		body, err = proto.Marshal(msg)
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}
+	if err != nil {
+		http.Error(w, "encode error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=15")
+	w.Header().Set("Last-Modified", time.Unix(int64(msg.GetHeader().GetTimestamp()), 0).UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
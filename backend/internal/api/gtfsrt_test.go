@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func getFeedMessage(t *testing.T, url string, unmarshal func([]byte, proto.Message) error) (*http.Response, *gtfsrt.FeedMessage) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg gtfsrt.FeedMessage
+	if err := unmarshal(body, &msg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp, &msg
+}
+
+func TestGTFSRTAlerts(t *testing.T) {
+	database := openTestDB(t)
+	ts := httptest.NewServer((&Server{DB: database}).Router())
+	t.Cleanup(ts.Close)
+
+	// Before any status is known the feed is empty but valid.
+	start := time.Now()
+	_, msg := getFeedMessage(t, ts.URL+"/gtfs-rt/alerts.pb", proto.Unmarshal)
+	if len(msg.GetEntity()) != 0 || msg.GetHeader().GetTimestamp() < uint64(start.Unix()) {
+		t.Errorf("empty feed = %v", msg)
+	}
+
+	ctx := context.Background()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	str := func(s string) *string { return &s }
+	for _, ls := range []db.LineStatus{
+		// A and C share one alert; the entity starts when the first of
+		// them did.
+		{LineID: "C", Status: "Delays", Header: str("Signal problems at Jay St"), Body: str("Expect delays."),
+			Effect: str("SIGNIFICANT_DELAYS"), ContentHash: "0123456789abcdef0123", UpdatedAt: at},
+		{LineID: "A", Status: "Delays", Header: str("Signal problems at Jay St"), Body: str("Expect delays."),
+			Effect: str("SIGNIFICANT_DELAYS"), ContentHash: "0123456789abcdef0123", UpdatedAt: at.Add(time.Minute)},
+		// Without a hash or header the entity is keyed by line and
+		// titled with the status; unknown effects map to UNKNOWN_EFFECT.
+		{LineID: "E", Status: "No Service", Effect: str("NOT_AN_EFFECT"), UpdatedAt: at.Add(2 * time.Minute)},
+		// A resolution isn't an entity but still bumps the timestamp.
+		{LineID: "F", Status: db.StatusGoodService, UpdatedAt: at.Add(time.Hour)},
+	} {
+		if err := database.Lines().Upsert(ctx, ls); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, msg := getFeedMessage(t, ts.URL+"/gtfs-rt/alerts.pb", proto.Unmarshal)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "Sat, 01 Mar 2025 13:00:00 GMT" {
+		t.Errorf("Last-Modified = %s", lm)
+	}
+
+	h := msg.GetHeader()
+	if h.GetGtfsRealtimeVersion() != "2.0" || h.GetIncrementality() != gtfsrt.FeedHeader_FULL_DATASET ||
+		h.GetTimestamp() != uint64(at.Add(time.Hour).Unix()) {
+		t.Errorf("header = %v", h)
+	}
+
+	ents := msg.GetEntity()
+	if len(ents) != 2 {
+		t.Fatalf("got %d entities, want 2: %v", len(ents), msg)
+	}
+	routes := func(a *gtfsrt.Alert) []string {
+		var out []string
+		for _, ie := range a.GetInformedEntity() {
+			out = append(out, ie.GetRouteId())
+		}
+		return out
+	}
+
+	shared := ents[0]
+	if shared.GetId() != "nyctcord:0123456789abcdef" {
+		t.Errorf("shared entity id = %s", shared.GetId())
+	}
+	a := shared.GetAlert()
+	if got := routes(a); !slices.Equal(got, []string{"A", "C"}) {
+		t.Errorf("shared entity routes = %v, want [A C]", got)
+	}
+	if a.GetEffect() != gtfsrt.Alert_SIGNIFICANT_DELAYS || a.GetCause() != gtfsrt.Alert_UNKNOWN_CAUSE {
+		t.Errorf("shared entity effect/cause = %s/%s", a.GetEffect(), a.GetCause())
+	}
+	if got := a.GetHeaderText().GetTranslation()[0]; got.GetText() != "Signal problems at Jay St" || got.GetLanguage() != "en" {
+		t.Errorf("shared entity header = %v", got)
+	}
+	if got := a.GetDescriptionText().GetTranslation()[0].GetText(); got != "Expect delays." {
+		t.Errorf("shared entity description = %q", got)
+	}
+	if ap := a.GetActivePeriod(); len(ap) != 1 || ap[0].GetStart() != uint64(at.Unix()) || ap[0].End != nil {
+		t.Errorf("shared entity active period = %v", ap)
+	}
+
+	byLine := ents[1]
+	a = byLine.GetAlert()
+	if byLine.GetId() != "nyctcord:line:E" || !slices.Equal(routes(a), []string{"E"}) {
+		t.Errorf("line entity = %v", byLine)
+	}
+	if a.GetEffect() != gtfsrt.Alert_UNKNOWN_EFFECT || a.GetHeaderText().GetTranslation()[0].GetText() != "No Service" ||
+		a.DescriptionText != nil {
+		t.Errorf("line entity alert = %v", a)
+	}
+
+	// The JSON debug view is the same message.
+	resp, asJSON := getFeedMessage(t, ts.URL+"/gtfs-rt/alerts.pb?format=json", protojson.Unmarshal)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("JSON Content-Type = %s", ct)
+	}
+	if !proto.Equal(asJSON, msg) {
+		t.Errorf("JSON feed differs:\n%v\nwant\n%v", asJSON, msg)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+)
+
+type setPushRequest struct {
+	Kind  string `json:"kind"` // "ntfy" (default) or "http"
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+func (s *Server) handleGetPush(w http.ResponseWriter, r *http.Request) {
+	dest, err := s.DB.PushDestinations().Get(r.Context(), s.currentUserID(r))
+	if err == db.ErrNotFound {
+		http.Error(w, "push not configured", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, dest)
+}
+
+// handleSetPush serves POST /api/push. For ntfy the URL is the full topic
+// URL, e.g. https://ntfy.sh/my-secret-topic.
+func (s *Server) handleSetPush(w http.ResponseWriter, r *http.Request) {
+	var req setPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if kind == "" {
+		kind = db.PushNtfy
+	}
+	if kind != db.PushNtfy && kind != db.PushHTTP {
+		http.Error(w, "kind must be ntfy or http", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if safehttp.CheckURL(u) != nil {
+		http.Error(w, "url must point to a public address", http.StatusBadRequest)
+		return
+	}
+	if kind == db.PushNtfy && strings.Trim(u.Path, "/") == "" {
+		http.Error(w, "ntfy url must include a topic", http.StatusBadRequest)
+		return
+	}
+
+	token := strings.TrimSpace(req.Token)
+	err = s.DB.PushDestinations().Upsert(r.Context(), db.PushDestination{
+		UserID: s.currentUserID(r),
+		Kind:   kind,
+		URL:    u.String(),
+		Token:  &token,
+	})
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeletePush(w http.ResponseWriter, r *http.Request) {
+	if err := s.DB.PushDestinations().Delete(r.Context(), s.currentUserID(r)); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
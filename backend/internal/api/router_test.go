@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// documentedRoutes is every route the API serves. A route added to Router
+// has to be listed here too.
+var documentedRoutes = []struct {
+	method, pattern, example string
+}{
+	{"GET", "/health", "/health"},
+	{"GET", "/feeds/{name}", "/feeds/alerts.rss"},
+	{"GET", "/gtfs-rt/alerts.pb", "/gtfs-rt/alerts.pb"},
+	{"GET", "/api/lines", "/api/lines"},
+	{"GET", "/api/lines/{id}/timeline", "/api/lines/A/timeline"},
+	{"GET", "/api/timeline/heatmap", "/api/timeline/heatmap"},
+	{"GET", "/api/stream", "/api/stream"},
+	{"GET", "/api/ws", "/api/ws"},
+	{"GET", "/api/subscriptions", "/api/subscriptions"},
+	{"POST", "/api/subscriptions", "/api/subscriptions"},
+	{"GET", "/api/alerts", "/api/alerts"},
+	{"GET", "/api/alerts/recent", "/api/alerts/recent"},
+	{"GET", "/api/alerts/search", "/api/alerts/search"},
+	{"GET", "/api/notifications/pending", "/api/notifications/pending"},
+	{"GET", "/api/stats/lines", "/api/stats/lines"},
+	{"GET", "/api/stats/lines/{id}", "/api/stats/lines/A"},
+	{"GET", "/api/calendar/token", "/api/calendar/token"},
+	{"POST", "/api/calendar/token", "/api/calendar/token"},
+	{"GET", "/api/calendar/{name}", "/api/calendar/abc.ics"},
+	{"GET", "/api/webhooks", "/api/webhooks"},
+	{"POST", "/api/webhooks", "/api/webhooks"},
+	{"DELETE", "/api/webhooks/{id}", "/api/webhooks/1"},
+	{"GET", "/api/webhooks/{id}/deliveries", "/api/webhooks/1/deliveries"},
+	{"GET", "/api/slack", "/api/slack"},
+	{"POST", "/api/slack", "/api/slack"},
+	{"DELETE", "/api/slack", "/api/slack"},
+	{"GET", "/api/email", "/api/email"},
+	{"POST", "/api/email", "/api/email"},
+	{"GET", "/api/email/verify", "/api/email/verify"},
+	{"GET", "/api/email/unsubscribe", "/api/email/unsubscribe"},
+	{"POST", "/api/email/unsubscribe", "/api/email/unsubscribe"},
+	{"GET", "/api/push", "/api/push"},
+	{"POST", "/api/push", "/api/push"},
+	{"DELETE", "/api/push", "/api/push"},
+	{"POST", "/api/admin/templates/preview", "/api/admin/templates/preview"},
+}
+
+func testRouter(t *testing.T) chi.Routes {
+	t.Helper()
+	routes, ok := (&Server{}).Router().(chi.Routes)
+	if !ok {
+		t.Fatal("Router does not return a chi router")
+	}
+	return routes
+}
+
+func TestRoutesResolve(t *testing.T) {
+	routes := testRouter(t)
+	for _, rt := range documentedRoutes {
+		if !routes.Match(chi.NewRouteContext(), rt.method, rt.example) {
+			t.Errorf("%s %s does not resolve", rt.method, rt.example)
+		}
+	}
+
+	for _, path := range []string{"/api/api/alerts/recent", "/api/api/lines", "/api/nope"} {
+		if routes.Match(chi.NewRouteContext(), "GET", path) {
+			t.Errorf("GET %s resolves", path)
+		}
+	}
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	documented := make([]string, 0, len(documentedRoutes))
+	for _, rt := range documentedRoutes {
+		documented = append(documented, rt.method+" "+rt.pattern)
+	}
+
+	var served []string
+	err := chi.Walk(testRouter(t), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		served = append(served, method+" "+route)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range served {
+		if !slices.Contains(documented, r) {
+			t.Errorf("%s is served but not documented", r)
+		}
+	}
+	for _, r := range documented {
+		if !slices.Contains(served, r) {
+			t.Errorf("%s is documented but not served", r)
+		}
+	}
+}
+
+func TestListAlertsPagination(t *testing.T) {
+	database := openTestDB(t)
+	ts := httptest.NewServer((&Server{DB: database}).Router())
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, line := range []string{"A", "C", "A", "E", "A"} {
+		status := "Delays"
+		if _, err := database.Alerts().Insert(ctx, db.Alert{LineID: line, NewStatus: &status, CreatedAt: at.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(query string) alertPage {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/alerts?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /api/alerts?%s: %s", query, resp.Status)
+		}
+		var page alertPage
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		return page
+	}
+
+	var ids []int64
+	query := "line=A&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not stop")
+		}
+		page := get(query)
+		for _, a := range page.Alerts {
+			ids = append(ids, a.ID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		query = "line=A&limit=2&cursor=" + *page.NextCursor
+	}
+	if want := []int64{5, 3, 1}; !slices.Equal(ids, want) {
+		t.Errorf("paged ids = %v, want %v", ids, want)
+	}
+
+	for _, bad := range []string{"from=yesterday", "to=2025-13-01", "cursor=-1"} {
+		resp, err := http.Get(ts.URL + "/api/alerts?" + bad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET /api/alerts?%s: %s, want 400", bad, resp.Status)
+		}
+	}
+}
+
+func TestSetSubscriptionsDefaultsToDM(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+	ctx := context.Background()
+	if _, err := s.DB.Users().Upsert(ctx, "100", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for body, want := range map[string]bool{
+		`{"lines": ["F"]}`:                  true,
+		`{"lines": ["F"], "via_dm": true}`:  true,
+		`{"lines": ["F"], "via_dm": false}`: false,
+	} {
+		resp, err := http.Post(ts.URL+"/api/subscriptions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s: status %d", body, resp.StatusCode)
+		}
+		subs, err := s.DB.Subscriptions().ListForUser(ctx, 1)
+		if err != nil || len(subs) != 1 {
+			t.Fatalf("%s: subscriptions = %+v, %v", body, subs, err)
+		}
+		if subs[0].ViaDM != want {
+			t.Errorf("%s: via_dm = %v, want %v", body, subs[0].ViaDM, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+)
+
+type setSlackRequest struct {
+	WebhookURL string `json:"webhook_url"`
+	BotToken   string `json:"bot_token"`
+	ChannelID  string `json:"channel_id"`
+	TeamID     string `json:"team_id"`
+}
+
+type slackResponse struct {
+	db.SlackDestination
+	Mode string `json:"mode"` // "webhook" or "bot"
+}
+
+// handleGetSlack serves GET /api/slack, the user's Slack destination
+// without its secrets.
+func (s *Server) handleGetSlack(w http.ResponseWriter, r *http.Request) {
+	dest, err := s.DB.SlackDestinations().Get(r.Context(), s.currentUserID(r))
+	if err == db.ErrNotFound {
+		http.Error(w, "slack not configured", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	mode := "bot"
+	if dest.WebhookURL != nil {
+		mode = "webhook"
+	}
+	writeJSON(w, slackResponse{SlackDestination: dest, Mode: mode})
+}
+
+// handleSetSlack serves POST /api/slack. Send either webhook_url, or
+// bot_token with channel_id (and optionally team_id).
+func (s *Server) handleSetSlack(w http.ResponseWriter, r *http.Request) {
+	var req setSlackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	dest := db.SlackDestination{UserID: s.currentUserID(r)}
+	webhookURL := strings.TrimSpace(req.WebhookURL)
+	botToken := strings.TrimSpace(req.BotToken)
+	channelID := strings.TrimSpace(req.ChannelID)
+	teamID := strings.TrimSpace(req.TeamID)
+
+	switch {
+	case webhookURL != "" && botToken == "":
+		u, err := url.Parse(webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "webhook_url must be an absolute http(s) URL", http.StatusBadRequest)
+			return
+		}
+		if safehttp.CheckURL(u) != nil {
+			http.Error(w, "webhook_url must point to a public address", http.StatusBadRequest)
+			return
+		}
+		dest.WebhookURL = &webhookURL
+	case botToken != "" && webhookURL == "":
+		if channelID == "" {
+			http.Error(w, "channel_id is required with bot_token", http.StatusBadRequest)
+			return
+		}
+		dest.BotToken = &botToken
+		dest.ChannelID = &channelID
+		dest.TeamID = &teamID
+	default:
+		http.Error(w, "set exactly one of webhook_url or bot_token", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.DB.SlackDestinations().Upsert(r.Context(), dest); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeleteSlack(w http.ResponseWriter, r *http.Request) {
+	if err := s.DB.SlackDestinations().Delete(r.Context(), s.currentUserID(r)); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
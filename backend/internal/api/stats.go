@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/stats"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultStatsWindow = 28 * 24 * time.Hour
+
+// statsRange reads ?from= and ?to= (YYYY-MM-DD or RFC 3339, UTC days, to
+// exclusive). Stats only cover completed days, so to is capped at today.
+func statsRange(r *http.Request) (time.Time, time.Time, bool) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	to, err := parseTimeParam(r.URL.Query().Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if to.IsZero() || to.After(today) {
+		to = today
+	}
+
+	from, err := parseTimeParam(r.URL.Query().Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultStatsWindow)
+	}
+	return from, to, true
+}
+
+// handleGetLineStats serves GET /api/stats/lines: per-line hours per week in
+// each status, incidents by effect, mean time to resolution and worst days.
+func (s *Server) handleGetLineStats(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := statsRange(r)
+	if !ok {
+		http.Error(w, "invalid from/to", http.StatusBadRequest)
+		return
+	}
+
+	out, err := stats.Report(r.Context(), s.DB, stats.Options{From: from, To: to, WorstDays: 3})
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, out)
+}
+
+// handleGetLineStatsByID serves GET /api/stats/lines/{id}, the same numbers
+// for one line plus a day-by-day breakdown.
+func (s *Server) handleGetLineStatsByID(w http.ResponseWriter, r *http.Request) {
+	lineID := strings.ToUpper(strings.TrimSpace(chi.URLParam(r, "id")))
+
+	from, to, ok := statsRange(r)
+	if !ok {
+		http.Error(w, "invalid from/to", http.StatusBadRequest)
+		return
+	}
+
+	out, err := stats.Report(r.Context(), s.DB, stats.Options{LineID: lineID, From: from, To: to, WorstDays: 10, Daily: true})
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if len(out) == 0 {
+		http.Error(w, "no stats for line", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, out[0])
+}
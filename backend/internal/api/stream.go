@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+// handleStream serves line status transitions and new alerts as
+// Server-Sent Events. Clients resume with the standard Last-Event-ID header
+// (or ?last_event_id= on the first connect) holding an alerts.id.
+//
+// Each alert is sent as an alert event and then a line_status event, and
+// only the second carries the id. A client cut off between the two still
+// has the previous id, so on resume it gets both again.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// The server-wide WriteTimeout would cut the stream off.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	lastID := parseLastEventID(r)
+
+	// Subscribe before replaying so nothing written in between is lost;
+	// duplicates are dropped below by comparing IDs.
+	events, unsubscribe := s.Broker.Subscribe(64)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	if lastID > 0 {
+		for {
+			alerts, err := s.DB.Alerts().Since(r.Context(), lastID, 200)
+			if err != nil || len(alerts) == 0 {
+				break
+			}
+			replay, err := EventsForAlerts(r.Context(), s.DB, alerts)
+			if err != nil {
+				break
+			}
+			for _, ev := range replay {
+				if err := writeSSE(w, ev); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+			lastID = alerts[len(alerts)-1].ID
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				// Dropped for falling behind; the client reconnects and
+				// resumes from its Last-Event-ID.
+				return
+			}
+			if ev.ID <= lastID {
+				continue
+			}
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, ev Event) error {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+	if ev.final {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
+
+func parseLastEventID(r *http.Request) int64 {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+type sseFrame struct {
+	id, event, data string
+}
+
+// readSSE reads frames from an event stream until it has n events,
+// skipping comments and the retry hint.
+func readSSE(t *testing.T, r *bufio.Reader, n int) []sseFrame {
+	t.Helper()
+	out := make([]sseFrame, 0, n)
+	var f sseFrame
+	for len(out) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (got %d of %d events)", err, len(out), n)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			f.id = value
+		case "event":
+			f.event = value
+		case "data":
+			f.data = value
+		case "":
+			if f.event != "" {
+				out = append(out, f)
+			}
+			f = sseFrame{}
+		}
+	}
+	return out
+}
+
+func TestWriteSSE(t *testing.T) {
+	database := openTestDB(t)
+	at := time.Now().UTC().Truncate(time.Second)
+	setLine(t, database, "F", "Delays", at)
+
+	ctx := context.Background()
+	status := "Alert"
+	orphanID, err := database.Alerts().Insert(ctx, db.Alert{LineID: "Z", NewStatus: &status, CreatedAt: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts, err := database.Alerts().Since(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := EventsForAlerts(ctx, database, alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	for _, ev := range events {
+		if err := writeSSE(rec, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frames := readSSE(t, bufio.NewReader(rec.Body), 3)
+
+	fID := strconv.FormatInt(alerts[0].ID, 10)
+	want := []struct{ id, event string }{
+		// The alert and its line_status share an id, which only the
+		// second carries.
+		{"", EventAlert},
+		{fID, EventLineStatus},
+		// Z has no line status, so its alert event is the last one.
+		{strconv.FormatInt(orphanID, 10), EventAlert},
+	}
+	for i, w := range want {
+		if frames[i].id != w.id || frames[i].event != w.event {
+			t.Errorf("frame %d = id %q %s, want id %q %s", i, frames[i].id, frames[i].event, w.id, w.event)
+		}
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+	at := time.Now().UTC().Truncate(time.Second)
+	setLine(t, s.DB, "A", "Delays", at)
+	setLine(t, s.DB, "C", "Delays", at)
+	setLine(t, s.DB, "F", "Delays", at)
+	waitBroker(t, s)
+
+	alerts, err := s.DB.Alerts().Since(context.Background(), 0, 10)
+	if err != nil || len(alerts) != 3 {
+		t.Fatalf("alerts = %v, %v", alerts, err)
+	}
+
+	// A client that saw the first alert's id resumes with the other two,
+	// both events each.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/stream", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(alerts[0].ID, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+
+	frames := readSSE(t, r, 4)
+	for i, a := range alerts[1:] {
+		alert, status := frames[2*i], frames[2*i+1]
+		if alert.event != EventAlert || alert.id != "" || !strings.Contains(alert.data, `"line_id":"`+a.LineID+`"`) {
+			t.Errorf("frame %d = %+v, want %s alert without an id", 2*i, alert, a.LineID)
+		}
+		if status.event != EventLineStatus || status.id != strconv.FormatInt(a.ID, 10) {
+			t.Errorf("frame %d = %+v, want line_status with id %d", 2*i+1, status, a.ID)
+		}
+	}
+
+	// Live changes follow the replay the same way.
+	setLine(t, s.DB, "A", "No Service", at.Add(time.Minute))
+	live := readSSE(t, r, 2)
+	if live[0].event != EventAlert || live[0].id != "" || live[1].event != EventLineStatus || live[1].id == "" {
+		t.Errorf("live frames = %+v", live)
+	}
+}
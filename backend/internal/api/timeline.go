@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/stats"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultTimelineWindow = 24 * time.Hour
+	maxTimelineWindow     = 31 * 24 * time.Hour
+	maxHeatmapBuckets     = 2000
+)
+
+// timelineRange reads ?from= and ?to=, defaulting to the last day and
+// capping to at now so the last interval is the one still in effect.
+func timelineRange(r *http.Request) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+
+	to, err := parseTimeParam(r.URL.Query().Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+
+	from, err := parseTimeParam(r.URL.Query().Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultTimelineWindow)
+	}
+
+	if !from.Before(to) || to.Sub(from) > maxTimelineWindow {
+		return time.Time{}, time.Time{}, false
+	}
+	return from.UTC(), to.UTC(), true
+}
+
+type timelineResponse struct {
+	LineID    string           `json:"line_id"`
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Intervals []stats.Interval `json:"intervals"`
+}
+
+// handleGetLineTimeline serves GET /api/lines/{id}/timeline: the line's
+// contiguous status intervals over the range, each with the alert that
+// started it.
+func (s *Server) handleGetLineTimeline(w http.ResponseWriter, r *http.Request) {
+	lineID := strings.ToUpper(strings.TrimSpace(chi.URLParam(r, "id")))
+
+	from, to, ok := timelineRange(r)
+	if !ok {
+		http.Error(w, "invalid from/to", http.StatusBadRequest)
+		return
+	}
+
+	ivs, err := stats.LineIntervals(r.Context(), s.DB, lineID, from, to)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, timelineResponse{LineID: lineID, From: from, To: to, Intervals: ivs})
+}
+
+type heatmapRow struct {
+	LineID string              `json:"line_id"`
+	Cells  []stats.HeatmapCell `json:"cells"`
+}
+
+type heatmapResponse struct {
+	From          time.Time    `json:"from"`
+	To            time.Time    `json:"to"`
+	BucketSeconds int64        `json:"bucket_seconds"`
+	Lines         []heatmapRow `json:"lines"`
+}
+
+// handleGetHeatmap serves GET /api/timeline/heatmap?from=&to=&bucket=1h,
+// every line's timeline folded into fixed-size buckets.
+func (s *Server) handleGetHeatmap(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := timelineRange(r)
+	if !ok {
+		http.Error(w, "invalid from/to", http.StatusBadRequest)
+		return
+	}
+
+	bucket := time.Hour
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			http.Error(w, "invalid bucket", http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+	if to.Sub(from)/bucket > maxHeatmapBuckets {
+		http.Error(w, "too many buckets", http.StatusBadRequest)
+		return
+	}
+
+	byLine, err := stats.AllIntervals(r.Context(), s.DB, from, to)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]heatmapRow, 0, len(byLine))
+	for lineID, ivs := range byLine {
+		rows = append(rows, heatmapRow{LineID: lineID, Cells: stats.Heatmap(ivs, from, to, bucket)})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].LineID < rows[j].LineID })
+
+	writeJSON(w, heatmapResponse{
+		From:          from,
+		To:            to,
+		BucketSeconds: int64(bucket / time.Second),
+		Lines:         rows,
+	})
+}
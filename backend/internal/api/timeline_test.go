@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// timelineServer serves a history of three lines around 10:00–12:00 on
+// 2025-03-01:
+//
+//	A: No Service since 09:00
+//	F: Delays 10:30–11:45, and Delays again at 12:00
+//	G: Delays from exactly 10:00
+func timelineServer(t *testing.T) (*httptest.Server, time.Time) {
+	t.Helper()
+	database := openTestDB(t)
+	ts := httptest.NewServer((&Server{DB: database}).Router())
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, a := range []struct {
+		line, status string
+		at           time.Duration
+	}{
+		{"A", "No Service", -time.Hour},
+		{"F", "Delays", 30 * time.Minute},
+		{"F", db.StatusGoodService, 105 * time.Minute},
+		{"F", "Delays", 2 * time.Hour},
+		{"G", "Delays", 0},
+	} {
+		status := a.status
+		if _, err := database.Alerts().Insert(ctx, db.Alert{LineID: a.line, NewStatus: &status, CreatedAt: base.Add(a.at)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ts, base
+}
+
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestLineTimeline(t *testing.T) {
+	ts, base := timelineServer(t)
+	query := "?from=2025-03-01T10:00:00Z&to=2025-03-01T12:00:00Z"
+
+	type span struct {
+		status     string
+		start, end time.Duration
+	}
+	tests := []struct {
+		line string
+		want []span
+	}{
+		// The transition at exactly to belongs to the next range.
+		{"f", []span{
+			{db.StatusGoodService, 0, 30 * time.Minute},
+			{"Delays", 30 * time.Minute, 105 * time.Minute},
+			{db.StatusGoodService, 105 * time.Minute, 2 * time.Hour},
+		}},
+		{"A", []span{{"No Service", 0, 2 * time.Hour}}},
+		// One at exactly from starts the range without an empty interval
+		// before it.
+		{"G", []span{{"Delays", 0, 2 * time.Hour}}},
+		// A line with no history is in good service throughout.
+		{"Z", []span{{db.StatusGoodService, 0, 2 * time.Hour}}},
+	}
+	for _, tt := range tests {
+		var got timelineResponse
+		if code := getJSON(t, ts.URL+"/api/lines/"+tt.line+"/timeline"+query, &got); code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.line, code)
+		}
+		if !got.From.Equal(base) || !got.To.Equal(base.Add(2*time.Hour)) {
+			t.Errorf("%s: range %s–%s", tt.line, got.From, got.To)
+		}
+		if len(got.Intervals) != len(tt.want) {
+			t.Errorf("%s: intervals = %+v, want %+v", tt.line, got.Intervals, tt.want)
+			continue
+		}
+		for i, w := range tt.want {
+			iv := got.Intervals[i]
+			if iv.Status != w.status || !iv.Start.Equal(base.Add(w.start)) || !iv.End.Equal(base.Add(w.end)) {
+				t.Errorf("%s: interval %d = %s %s–%s, want %s %s–%s", tt.line, i,
+					iv.Status, iv.Start.Format(time.Kitchen), iv.End.Format(time.Kitchen),
+					w.status, base.Add(w.start).Format(time.Kitchen), base.Add(w.end).Format(time.Kitchen))
+			}
+		}
+	}
+
+	// A range before any history is one good-service interval.
+	var got timelineResponse
+	getJSON(t, ts.URL+"/api/lines/F/timeline?from=2024-01-01&to=2024-01-02", &got)
+	if len(got.Intervals) != 1 || got.Intervals[0].Status != db.StatusGoodService || got.Intervals[0].AlertID != 0 {
+		t.Errorf("empty range intervals = %+v", got.Intervals)
+	}
+
+	for _, bad := range []string{
+		"?from=2025-03-01T12:00:00Z&to=2025-03-01T12:00:00Z",
+		"?from=2025-03-02&to=2025-03-01",
+		"?from=2025-01-01&to=2025-03-01",
+		"?from=noon",
+	} {
+		if code := getJSON(t, ts.URL+"/api/lines/F/timeline"+bad, nil); code != http.StatusBadRequest {
+			t.Errorf("timeline%s: status %d, want 400", bad, code)
+		}
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	ts, base := timelineServer(t)
+
+	get := func(query string) heatmapResponse {
+		t.Helper()
+		var got heatmapResponse
+		if code := getJSON(t, ts.URL+"/api/timeline/heatmap"+query, &got); code != http.StatusOK {
+			t.Fatalf("heatmap%s: status %d", query, code)
+		}
+		return got
+	}
+
+	type cell struct {
+		status    string
+		disrupted int64
+	}
+	check := func(got heatmapResponse, want map[string][]cell, starts []time.Duration) {
+		t.Helper()
+		if len(got.Lines) != len(want) {
+			t.Fatalf("lines = %+v, want %d", got.Lines, len(want))
+		}
+		for i, row := range got.Lines {
+			if i > 0 && got.Lines[i-1].LineID >= row.LineID {
+				t.Errorf("lines not sorted: %s before %s", got.Lines[i-1].LineID, row.LineID)
+			}
+			w := want[row.LineID]
+			if len(row.Cells) != len(w) {
+				t.Errorf("%s: %d cells, want %d", row.LineID, len(row.Cells), len(w))
+				continue
+			}
+			for j, c := range row.Cells {
+				if !c.Start.Equal(base.Add(starts[j])) || c.Status != w[j].status || c.DisruptedSeconds != w[j].disrupted {
+					t.Errorf("%s cell %d = %+v, want %s %s with %ds disrupted", row.LineID, j, c,
+						base.Add(starts[j]).Format(time.Kitchen), w[j].status, w[j].disrupted)
+				}
+			}
+		}
+	}
+
+	// Hourly: F's first hour is split evenly and goes to the disrupted
+	// status, which sorts first.
+	got := get("?from=2025-03-01T10:00:00Z&to=2025-03-01T12:00:00Z")
+	if got.BucketSeconds != 3600 {
+		t.Errorf("bucket_seconds = %d, want 3600", got.BucketSeconds)
+	}
+	check(got, map[string][]cell{
+		"A": {{"No Service", 3600}, {"No Service", 3600}},
+		"F": {{"Delays", 1800}, {"Delays", 2700}},
+		"G": {{"Delays", 3600}, {"Delays", 3600}},
+	}, []time.Duration{0, time.Hour})
+
+	// Buckets that don't divide the range leave a short last one.
+	got = get("?from=2025-03-01T10:00:00Z&to=2025-03-01T12:00:00Z&bucket=45m")
+	check(got, map[string][]cell{
+		"A": {{"No Service", 2700}, {"No Service", 2700}, {"No Service", 1800}},
+		"F": {{db.StatusGoodService, 900}, {"Delays", 2700}, {"Delays", 900}},
+		"G": {{"Delays", 2700}, {"Delays", 2700}, {"Delays", 1800}},
+	}, []time.Duration{0, 45 * time.Minute, 90 * time.Minute})
+
+	// Before any history there are no lines at all, as an empty list.
+	resp, err := http.Get(ts.URL + "/api/timeline/heatmap?from=2024-01-01&to=2024-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Lines json.RawMessage `json:"lines"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&raw)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw.Lines) != "[]" {
+		t.Errorf("empty range lines = %s, want []", raw.Lines)
+	}
+
+	for _, bad := range []string{
+		"?bucket=30s",
+		"?bucket=hourly",
+		"?from=2025-02-01&to=2025-03-01&bucket=1m",
+		"?from=2025-03-01T12:00:00Z&to=2025-03-01T10:00:00Z",
+	} {
+		if code := getJSON(t, ts.URL+"/api/timeline/heatmap"+bad, nil); code != http.StatusBadRequest {
+			t.Errorf("heatmap%s: status %d, want 400", bad, code)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+	"github.com/go-chi/chi/v5"
+)
+
+type createWebhookRequest struct {
+	URL   string   `json:"url"`
+	Lines []string `json:"lines"`
+}
+
+// handleCreateWebhook serves POST /api/webhooks. The response is the only
+// time the signing secret is returned.
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := s.currentUserID(r)
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if safehttp.CheckURL(u) != nil {
+		http.Error(w, "url must point to a public address", http.StatusBadRequest)
+		return
+	}
+
+	lines := make([]string, 0, len(req.Lines))
+	seen := map[string]bool{}
+	for _, l := range req.Lines {
+		l = strings.ToUpper(strings.TrimSpace(l))
+		if l == "" || seen[l] {
+			continue
+		}
+		seen[l] = true
+		lines = append(lines, l)
+	}
+	if len(lines) == 0 {
+		lines = []string{"ALL"}
+	}
+
+	var hook db.Webhook
+	err = s.DB.WithTx(r.Context(), func(tx *db.Tx) error {
+		var err error
+		hook, err = tx.Webhooks().Create(r.Context(), userID, u.String(), lines, time.Now())
+		return err
+	})
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := s.DB.Webhooks().ListForUser(r.Context(), s.currentUserID(r))
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, hooks)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = s.DB.Webhooks().Delete(r.Context(), s.currentUserID(r), id)
+	if err == db.ErrNotFound {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListWebhookDeliveries serves GET /api/webhooks/{id}/deliveries, the
+// delivery log for one of the user's webhooks, newest first.
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	owned, err := s.DB.Webhooks().Owned(r.Context(), s.currentUserID(r), id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if !owned {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := s.DB.Webhooks().Deliveries(r.Context(), id, parseLimit(r, 50, 500))
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, deliveries)
+}
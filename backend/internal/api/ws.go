@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 50 * time.Second
+	wsSendBuffer = 32
+	wsMaxMessage = 4096
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || slices.Contains(allowedOrigins, origin)
+	},
+}
+
+// wsClientMessage is what clients send: {"type":"subscribe","lines":["F","G"]}.
+// The line ID "ALL" matches every line.
+type wsClientMessage struct {
+	Type  string   `json:"type"`
+	Lines []string `json:"lines"`
+}
+
+type wsServerMessage struct {
+	Type  string   `json:"type"`
+	Lines []string `json:"lines,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	send chan any
+
+	mu    sync.Mutex
+	lines map[string]bool
+}
+
+func (c *wsClient) wants(lineID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lines["ALL"] || c.lines[lineID]
+}
+
+func (c *wsClient) update(lines []string, on bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range lines {
+		l = strings.ToUpper(strings.TrimSpace(l))
+		if l == "" {
+			continue
+		}
+		if on {
+			c.lines[l] = true
+		} else {
+			delete(c.lines, l)
+		}
+	}
+	out := make([]string, 0, len(c.lines))
+	for l := range c.lines {
+		out = append(out, l)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// enqueue hands msg to the writer. A client whose buffer is full is too slow
+// to keep up and gets disconnected rather than stalling the broker.
+func (c *wsClient) enqueue(msg any) bool {
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// push enqueues msg, disconnecting the client if it can't keep up. Closing
+// the connection ends the reader, which tears everything else down.
+func (c *wsClient) push(msg any) bool {
+	if c.enqueue(msg) {
+		return true
+	}
+	log.Printf("ws: dropping slow client %s", c.conn.RemoteAddr())
+	c.conn.Close()
+	return false
+}
+
+// handleWebSocket streams the same events as /api/stream, filtered to the
+// lines each client subscribes to.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	client := &wsClient{
+		conn:  conn,
+		send:  make(chan any, wsSendBuffer),
+		lines: map[string]bool{},
+	}
+
+	events, unsubscribe := s.Broker.Subscribe(64)
+	done := make(chan struct{})
+
+	go s.wsWriter(client, done)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					client.push(wsClose{websocket.CloseTryAgainLater, "fell behind, reconnect"})
+					return
+				}
+				if !client.wants(ev.LineID) {
+					continue
+				}
+				if !client.push(ev) {
+					return
+				}
+			}
+		}
+	}()
+
+	s.wsReader(client, r)
+	close(done)
+	unsubscribe()
+}
+
+type wsClose struct {
+	code int
+	text string
+}
+
+func (s *Server) wsReader(c *wsClient, r *http.Request) {
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsClientMessage
+		var ok bool
+		if err := json.Unmarshal(data, &msg); err != nil {
+			ok = c.push(wsServerMessage{Type: "error", Error: "invalid json"})
+		} else {
+			switch msg.Type {
+			case "subscribe":
+				lines := c.update(msg.Lines, true)
+				ok = c.push(wsServerMessage{Type: "subscribed", Lines: lines}) && s.wsSendSnapshot(c, r, msg.Lines)
+			case "unsubscribe":
+				lines := c.update(msg.Lines, false)
+				ok = c.push(wsServerMessage{Type: "subscribed", Lines: lines})
+			default:
+				ok = c.push(wsServerMessage{Type: "error", Error: "unknown message type"})
+			}
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// wsSendSnapshot sends the current status of newly subscribed lines so a
+// client doesn't have to wait for the next change to render something. It
+// reports false if the client was dropped.
+func (s *Server) wsSendSnapshot(c *wsClient, r *http.Request, lines []string) bool {
+	all, err := s.DB.Lines().List(r.Context())
+	if err != nil {
+		log.Printf("ws: snapshot error: %v", err)
+		return c.push(wsServerMessage{Type: "error", Error: "snapshot unavailable"})
+	}
+	want := map[string]bool{}
+	for _, l := range lines {
+		want[strings.ToUpper(strings.TrimSpace(l))] = true
+	}
+	for _, ls := range all {
+		if want["ALL"] || want[ls.LineID] {
+			if !c.push(Event{Type: EventLineStatus, LineID: ls.LineID, Data: ls}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Server) wsWriter(c *wsClient, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if cl, isClose := msg.(wsClose); isClose {
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(cl.code, cl.text))
+				return
+			}
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
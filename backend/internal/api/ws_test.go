@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/gorilla/websocket"
+)
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// newTestServer serves the API over httptest with a fast-polling broker.
+// Cancelling the returned context stops the broker.
+func newTestServer(t *testing.T) (*Server, *httptest.Server, context.CancelFunc) {
+	t.Helper()
+	database := openTestDB(t)
+	s := &Server{DB: database, Broker: NewBroker(database)}
+	s.Broker.Interval = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Broker.Run(ctx)
+
+	ts := httptest.NewServer(s.Router())
+	t.Cleanup(ts.Close)
+	return s, ts, cancel
+}
+
+func dialWS(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+type wsTestMessage struct {
+	ID     int64           `json:"id"`
+	Type   string          `json:"type"`
+	LineID string          `json:"line_id"`
+	Lines  []string        `json:"lines"`
+	Error  string          `json:"error"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) wsTestMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsTestMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func setLine(t *testing.T, database *db.DB, line, status string, at time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	err := database.WithTx(ctx, func(tx *db.Tx) error {
+		if _, err := tx.Alerts().Insert(ctx, db.Alert{LineID: line, NewStatus: &status, CreatedAt: at}); err != nil {
+			return err
+		}
+		return tx.Lines().Upsert(ctx, db.LineStatus{LineID: line, Status: status, UpdatedAt: at})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitBroker waits until the broker has published every alert on file, so
+// seeded rows don't show up as live events.
+func waitBroker(t *testing.T, s *Server) {
+	t.Helper()
+	max, err := s.DB.Alerts().MaxID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s.Broker.mu.Lock()
+		last := s.Broker.lastID
+		s.Broker.mu.Unlock()
+		if last >= max {
+			return
+		}
+	}
+	t.Fatal("broker did not catch up")
+}
+
+func TestWebSocketSubscribe(t *testing.T) {
+	s, ts, _ := newTestServer(t)
+	at := time.Now().UTC().Truncate(time.Second)
+	setLine(t, s.DB, "A", "Delays", at)
+	setLine(t, s.DB, "C", "Delays", at)
+	waitBroker(t, s)
+
+	conn := dialWS(t, ts)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`not json`))
+	if msg := readWS(t, conn); msg.Type != "error" || msg.Error != "invalid json" {
+		t.Fatalf("bad json reply = %+v", msg)
+	}
+
+	if err := conn.WriteJSON(wsClientMessage{Type: "subscribe", Lines: []string{" a "}}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readWS(t, conn); msg.Type != "subscribed" || len(msg.Lines) != 1 || msg.Lines[0] != "A" {
+		t.Fatalf("subscribe reply = %+v", msg)
+	}
+	if msg := readWS(t, conn); msg.Type != EventLineStatus || msg.LineID != "A" {
+		t.Fatalf("snapshot = %+v, want A line_status", msg)
+	}
+
+	// Only the subscribed line's changes come through.
+	setLine(t, s.DB, "C", "No Service", at.Add(time.Minute))
+	setLine(t, s.DB, "A", "No Service", at.Add(time.Minute))
+	alert := readWS(t, conn)
+	if alert.Type != EventAlert || alert.LineID != "A" {
+		t.Fatalf("first event = %+v, want alert on A", alert)
+	}
+	status := readWS(t, conn)
+	if status.Type != EventLineStatus || status.LineID != "A" || !strings.Contains(string(status.Data), "No Service") {
+		t.Fatalf("second event = %+v, want A line_status", status)
+	}
+
+	if err := conn.WriteJSON(wsClientMessage{Type: "unsubscribe", Lines: []string{"A"}}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readWS(t, conn); msg.Type != "subscribed" || len(msg.Lines) != 0 {
+		t.Fatalf("unsubscribe reply = %+v", msg)
+	}
+}
+
+func TestWebSocketBrokerStop(t *testing.T) {
+	_, ts, stop := newTestServer(t)
+	conn := dialWS(t, ts)
+
+	// Make sure the handler has subscribed to the broker before stopping it.
+	conn.WriteJSON(wsClientMessage{Type: "subscribe", Lines: []string{"ALL"}})
+	readWS(t, conn)
+
+	stop()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Fatalf("read after broker stop = %v, want close 1013", err)
+	}
+}
+
+func TestWebSocketPushDropsSlowClient(t *testing.T) {
+	serverConn := make(chan *websocket.Conn, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serverConn <- conn
+	}))
+	t.Cleanup(ts.Close)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// No writer drains send, so the first push finds it full.
+	c := &wsClient{conn: <-serverConn, send: make(chan any), lines: map[string]bool{}}
+	if c.push(wsServerMessage{Type: "subscribed"}) {
+		t.Fatal("push to a full client succeeded")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("connection still open after the client was dropped")
+	}
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Alert is one row of the transition log: a line moving from OldStatus to
+// NewStatus because of the alert text in Header/Body.
+type Alert struct {
+	ID        int64     `json:"id"`
+	AlertID   string    `json:"-"`
+	LineID    string    `json:"line_id"`
+	OldStatus *string   `json:"old_status,omitempty"`
+	NewStatus *string   `json:"new_status,omitempty"`
+	Header    *string   `json:"header,omitempty"`
+	Body      *string   `json:"body,omitempty"`
+	Effect    *string   `json:"effect,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AlertStore struct {
+	q       Querier
+	dialect Dialect
+}
+
+const alertColumns = `id, alert_id, line_id, old_status, new_status, header, body, effect, created_at`
+
+func scanAlert(sc interface{ Scan(...any) error }) (Alert, error) {
+	var a Alert
+	var oldStatus, newStatus, header, body, effect sql.NullString
+	var created sqlTime
+	if err := sc.Scan(&a.ID, &a.AlertID, &a.LineID, &oldStatus, &newStatus, &header, &body, &effect, &created); err != nil {
+		return Alert{}, err
+	}
+	a.OldStatus = nullString(oldStatus)
+	a.NewStatus = nullString(newStatus)
+	a.Header = nullString(header)
+	a.Body = nullString(body)
+	a.Effect = nullString(effect)
+	a.CreatedAt = created.Time
+	return a, nil
+}
+
+func scanAlerts(rows *sql.Rows) ([]Alert, error) {
+	defer rows.Close()
+
+	out := make([]Alert, 0)
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// Insert records a transition and returns its row ID.
+func (s *AlertStore) Insert(ctx context.Context, a Alert) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO alerts (alert_id, line_id, old_status, new_status, header, body, effect, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, a.AlertID, a.LineID, a.OldStatus, a.NewStatus, nullIfEmpty(a.Header), nullIfEmpty(a.Body), nullIfEmpty(a.Effect), a.CreatedAt).Scan(&id)
+	return id, err
+}
+
+func (s *AlertStore) Get(ctx context.Context, id int64) (Alert, error) {
+	a, err := scanAlert(s.q.QueryRowContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return Alert{}, ErrNotFound
+	}
+	return a, err
+}
+
+// Recent returns the newest alerts first.
+func (s *AlertStore) Recent(ctx context.Context, limit int) ([]Alert, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// Since returns alerts with id > afterID, oldest first.
+func (s *AlertStore) Since(ctx context.Context, afterID int64, limit int) ([]Alert, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+func (s *AlertStore) MaxID(ctx context.Context) (int64, error) {
+	var id sql.NullInt64
+	err := s.q.QueryRowContext(ctx, `SELECT MAX(id) FROM alerts`).Scan(&id)
+	return id.Int64, err
+}
+
+// AlertFilter narrows List. Zero values mean "no filter".
+type AlertFilter struct {
+	LineIDs []string
+	Effects []string
+	Status  string // matches new_status
+	From    time.Time
+	To      time.Time
+	Query   string // substring of header or body, case-insensitive
+	// Before is a cursor: only alerts with id < Before are returned.
+	Before int64
+	Limit  int
+}
+
+// List returns alerts matching f, newest first.
+func (s *AlertStore) List(ctx context.Context, f AlertFilter) ([]Alert, error) {
+	where := make([]string, 0, 8)
+	args := make([]any, 0, 8)
+
+	if len(f.LineIDs) > 0 {
+		where = append(where, `line_id IN (`+placeholders(len(f.LineIDs))+`)`)
+		for _, l := range f.LineIDs {
+			args = append(args, l)
+		}
+	}
+	if len(f.Effects) > 0 {
+		where = append(where, `effect IN (`+placeholders(len(f.Effects))+`)`)
+		for _, e := range f.Effects {
+			args = append(args, e)
+		}
+	}
+	if f.Status != "" {
+		where = append(where, `new_status = ?`)
+		args = append(args, f.Status)
+	}
+	if !f.From.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, f.To)
+	}
+	if q := strings.TrimSpace(f.Query); q != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+		where = append(where, `(LOWER(COALESCE(header, '')) LIKE ? ESCAPE '\' OR LOWER(COALESCE(body, '')) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if f.Before > 0 {
+		where = append(where, `id < ?`)
+		args = append(args, f.Before)
+	}
+
+	query := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.Limit)
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Between returns alerts created in [from, to) in the order they happened.
+// An empty lineID means every line.
+func (s *AlertStore) Between(ctx context.Context, lineID string, from, to time.Time) ([]Alert, error) {
+	query := `
+		SELECT ` + alertColumns + `
+		FROM alerts
+		WHERE created_at >= ? AND created_at < ?`
+	args := []any{from, to}
+	if lineID != "" {
+		query += ` AND line_id = ?`
+		args = append(args, lineID)
+	}
+	query += ` ORDER BY created_at, id`
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAlerts(rows)
+}
+
+// StateAt returns, for every line, the last alert created before t; its
+// NewStatus is the line's status at t.
+func (s *AlertStore) StateAt(ctx context.Context, t time.Time) (map[string]Alert, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		WHERE id IN (
+			SELECT MAX(id) FROM alerts
+			WHERE created_at < ?
+			GROUP BY line_id
+		)
+	`, t)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]Alert, len(alerts))
+	for _, a := range alerts {
+		out[a.LineID] = a
+	}
+	return out, nil
+}
+
+// IncidentStart finds the transition that opened the disruption still in
+// progress just before alert beforeID on lineID.
+func (s *AlertStore) IncidentStart(ctx context.Context, lineID string, beforeID int64) (Alert, error) {
+	a, err := scanAlert(s.q.QueryRowContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM alerts
+		WHERE line_id = ? AND id < ?
+			AND (old_status IS NULL OR old_status = '' OR old_status = ?)
+		ORDER BY id DESC
+		LIMIT 1
+	`, lineID, beforeID, StatusGoodService))
+	if err == sql.ErrNoRows {
+		return Alert{}, ErrNotFound
+	}
+	return a, err
+}
+
+// FirstCreatedAt returns when the oldest alert still on file was created.
+func (s *AlertStore) FirstCreatedAt(ctx context.Context) (time.Time, bool, error) {
+	var t sqlTime
+	err := s.q.QueryRowContext(ctx, `SELECT MIN(created_at) FROM alerts`).Scan(&t)
+	return t.Time, t.Valid, err
+}
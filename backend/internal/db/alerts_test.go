@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// insertAlert records a transition on line to status at at and returns its
+// row ID.
+func insertAlert(t *testing.T, q interface{ Alerts() *AlertStore }, line, oldStatus, newStatus, effect, header string, at time.Time) int64 {
+	t.Helper()
+	id, err := q.Alerts().Insert(context.Background(), Alert{
+		AlertID:   line + "-" + effect,
+		LineID:    line,
+		OldStatus: &oldStatus,
+		NewStatus: &newStatus,
+		Header:    &header,
+		Effect:    &effect,
+		CreatedAt: at,
+	})
+	if err != nil {
+		t.Fatalf("insert alert: %v", err)
+	}
+	return id
+}
+
+func alertIDs(alerts []Alert) []int64 {
+	out := make([]int64, len(alerts))
+	for i, a := range alerts {
+		out[i] = a.ID
+	}
+	return out
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAlertStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		store := d.Alerts()
+		t0 := day(2025, 4, 1, 8*time.Hour)
+
+		if max, err := store.MaxID(ctx); err != nil || max != 0 {
+			t.Fatalf("MaxID on empty table = %d, %v", max, err)
+		}
+		if _, ok, err := store.FirstCreatedAt(ctx); err != nil || ok {
+			t.Fatalf("FirstCreatedAt on empty table = %v, %v", ok, err)
+		}
+
+		a1 := insertAlert(t, d, "A", "", "Delays", "SIGNIFICANT_DELAYS", "Signal problems at Jay St", t0)
+		a2 := insertAlert(t, d, "C", "", "No Service", "NO_SERVICE", "No C trains", t0.Add(10*time.Minute))
+		a3 := insertAlert(t, d, "A", "Delays", StatusGoodService, "", "Good service has resumed.", t0.Add(30*time.Minute))
+		a4 := insertAlert(t, d, "A", StatusGoodService, "Delays", "SIGNIFICANT_DELAYS", "Sick customer at 59 St", t0.Add(2*time.Hour))
+
+		got, err := store.Get(ctx, a2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LineID != "C" || deref(got.NewStatus) != "No Service" || deref(got.OldStatus) != "" || !got.CreatedAt.Equal(t0.Add(10*time.Minute)) {
+			t.Errorf("Get = %+v", got)
+		}
+		if _, err := store.Get(ctx, 999); err != ErrNotFound {
+			t.Errorf("Get missing = %v, want ErrNotFound", err)
+		}
+
+		if max, _ := store.MaxID(ctx); max != a4 {
+			t.Errorf("MaxID = %d, want %d", max, a4)
+		}
+		if first, ok, _ := store.FirstCreatedAt(ctx); !ok || !first.Equal(t0) {
+			t.Errorf("FirstCreatedAt = %v %v, want %v", first, ok, t0)
+		}
+
+		recent, _ := store.Recent(ctx, 2)
+		if want := []int64{a4, a3}; !equalIDs(alertIDs(recent), want) {
+			t.Errorf("Recent = %v, want %v", alertIDs(recent), want)
+		}
+		since, _ := store.Since(ctx, a2, 10)
+		if want := []int64{a3, a4}; !equalIDs(alertIDs(since), want) {
+			t.Errorf("Since = %v, want %v", alertIDs(since), want)
+		}
+
+		filters := []struct {
+			name string
+			f    AlertFilter
+			want []int64
+		}{
+			{"all", AlertFilter{Limit: 10}, []int64{a4, a3, a2, a1}},
+			{"limit", AlertFilter{Limit: 1}, []int64{a4}},
+			{"lines", AlertFilter{LineIDs: []string{"C"}, Limit: 10}, []int64{a2}},
+			{"effects", AlertFilter{Effects: []string{"NO_SERVICE", "SIGNIFICANT_DELAYS"}, Limit: 10}, []int64{a4, a2, a1}},
+			{"status", AlertFilter{Status: StatusGoodService, Limit: 10}, []int64{a3}},
+			{"range", AlertFilter{From: t0.Add(5 * time.Minute), To: t0.Add(time.Hour), Limit: 10}, []int64{a3, a2}},
+			{"query is case-insensitive", AlertFilter{Query: "jay st", Limit: 10}, []int64{a1}},
+			{"query escapes LIKE wildcards", AlertFilter{Query: "%", Limit: 10}, []int64{}},
+			{"cursor", AlertFilter{Before: a3, Limit: 10}, []int64{a2, a1}},
+			{"combined", AlertFilter{LineIDs: []string{"A"}, Effects: []string{"SIGNIFICANT_DELAYS"}, Before: a4, Limit: 10}, []int64{a1}},
+		}
+		for _, tt := range filters {
+			got, err := store.List(ctx, tt.f)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !equalIDs(alertIDs(got), tt.want) {
+				t.Errorf("List %s = %v, want %v", tt.name, alertIDs(got), tt.want)
+			}
+		}
+
+		between, _ := store.Between(ctx, "A", t0, t0.Add(2*time.Hour))
+		if want := []int64{a1, a3}; !equalIDs(alertIDs(between), want) {
+			t.Errorf("Between = %v, want %v", alertIDs(between), want)
+		}
+		between, _ = store.Between(ctx, "", t0, t0.Add(3*time.Hour))
+		if len(between) != 4 {
+			t.Errorf("Between every line returned %d alerts, want 4", len(between))
+		}
+
+		state, err := store.StateAt(ctx, t0.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(state) != 2 || state["A"].ID != a3 || state["C"].ID != a2 {
+			t.Errorf("StateAt = %v", state)
+		}
+
+		start, err := store.IncidentStart(ctx, "A", a3)
+		if err != nil || start.ID != a1 {
+			t.Errorf("IncidentStart before %d = %d, %v; want %d", a3, start.ID, err, a1)
+		}
+		if _, err := store.IncidentStart(ctx, "A", a1); err != ErrNotFound {
+			t.Errorf("IncidentStart before the first alert = %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+var ErrBackupUnsupported = errors.New("backup/restore is only supported for SQLite; use pg_dump/pg_restore for PostgreSQL")
+
+// Pages copied per backup step. Between steps the source lock is released
+// so the poller, bot and API can keep writing during a backup.
+const backupStepPages = 256
+
+// Backup writes a consistent copy of the live database to dest using the
+// SQLite online backup API. The copy is built next to dest and renamed into
+// place, so dest is never left half-written.
+func (d *DB) Backup(ctx context.Context, dest string) error {
+	if d.Dialect != SQLite {
+		return ErrBackupUnsupported
+	}
+
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+
+	destDB, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	if err := copyDatabase(ctx, destDB, d.DB, backupStepPages); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := destDB.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Restore replaces the contents of the live database with the backup at
+// src, then migrates it forward. Backups from a newer schema than this
+// binary knows about are rejected.
+//
+// The file is never copied over directly: the backup is written through
+// this connection with the online backup API in one write transaction, so
+// the api, poller and bot can keep the database open. Their writes wait on
+// the busy timeout and they see either the old data or the restored data,
+// never a mix. They do keep in-memory state keyed by row IDs, such as
+// stream positions and unmarked deliveries, so restart them afterwards.
+func (d *DB) Restore(ctx context.Context, src string) error {
+	if d.Dialect != SQLite {
+		return ErrBackupUnsupported
+	}
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	srcDB, err := sql.Open("sqlite3", "file:"+src+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	if err := verifyBackupSchema(ctx, srcDB); err != nil {
+		return err
+	}
+
+	d.writeMu.Lock()
+	err = copyDatabase(ctx, d.DB, srcDB, -1)
+	d.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	_, err = d.MigrateUp(ctx)
+	return err
+}
+
+func verifyBackupSchema(ctx context.Context, src *sql.DB) error {
+	var version sql.NullInt64
+	if err := src.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("not a nyctcord database (reading schema_migrations: %w)", err)
+	}
+	if !version.Valid || version.Int64 == 0 {
+		return fmt.Errorf("backup has no applied migrations")
+	}
+
+	latest, err := LatestSchemaVersion(SQLite)
+	if err != nil {
+		return err
+	}
+	if int(version.Int64) > latest {
+		return fmt.Errorf("backup is at schema version %d but this build only knows up to %d", version.Int64, latest)
+	}
+	return nil
+}
+
+// copyDatabase copies src over dest pages at a time; pages < 0 copies
+// everything in a single step.
+func copyDatabase(ctx context.Context, dest, src *sql.DB, pages int) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(dc any) error {
+		return srcConn.Raw(func(sc any) error {
+			destSQLite, ok := dc.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup: unexpected driver conn %T", dc)
+			}
+			srcSQLite, ok := sc.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup: unexpected driver conn %T", sc)
+			}
+
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(pages)
+				if err != nil {
+					b.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				if err := ctx.Err(); err != nil {
+					b.Finish()
+					return err
+				}
+			}
+			return b.Finish()
+		})
+	})
+}
+
+const backupPrefix = "nyctcord-"
+
+// BackupRotate writes a timestamped backup into dir and removes the oldest
+// ones so at most keep remain. keep <= 0 disables rotation.
+func (d *DB) BackupRotate(ctx context.Context, dir string, keep int, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(dir, backupPrefix+now.UTC().Format("20060102T150405Z")+".db")
+	if err := d.Backup(ctx, dest); err != nil {
+		return "", err
+	}
+	if keep <= 0 {
+		return dest, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dest, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), ".db") {
+			names = append(names, e.Name())
+		}
+	}
+	// Timestamps in the names sort chronologically.
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return dest, err
+		}
+		names = names[1:]
+	}
+	return dest, nil
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func countAlerts(t *testing.T, d *DB) int {
+	t.Helper()
+	var n int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM alerts`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func checkIntegrity(t *testing.T, d *DB) {
+	t.Helper()
+	var res string
+	if err := d.QueryRow(`PRAGMA integrity_check`).Scan(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res != "ok" {
+		t.Errorf("integrity_check = %s", res)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "live.db")
+	at := day(2025, 6, 1, 0)
+
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	// A second handle on the same file stands in for the other processes.
+	other, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	for i := range 3 {
+		insertAlert(t, d, "F", "", "Delays", "SIGNIFICANT_DELAYS", "before", at.Add(time.Duration(i)*time.Minute))
+	}
+	backup := filepath.Join(dir, "backup.db")
+	if err := d.Backup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backup + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary backup file left behind: %v", err)
+	}
+
+	for i := range 5 {
+		insertAlert(t, d, "G", "", "No Service", "NO_SERVICE", "after", at.Add(time.Duration(i)*time.Hour))
+	}
+	if n := countAlerts(t, other); n != 8 {
+		t.Fatalf("%d alerts before restore, want 8", n)
+	}
+
+	// The other handle keeps writing while the restore runs.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	writeErrs := make(chan error, 20)
+	go func() {
+		defer wg.Done()
+		for i := range 20 {
+			writeErrs <- other.WithTx(ctx, func(tx *Tx) error {
+				_, err := tx.Alerts().Insert(ctx, Alert{LineID: "C", CreatedAt: at.Add(time.Duration(i) * time.Second)})
+				return err
+			})
+		}
+	}()
+	if err := d.Restore(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(writeErrs)
+	for err := range writeErrs {
+		if err != nil {
+			t.Fatalf("write during restore: %v", err)
+		}
+	}
+
+	// Both handles see the restored data, plus whatever the other handle
+	// wrote after the restore committed, and never the rows added after
+	// the backup.
+	for name, h := range map[string]*DB{"restoring": d, "other": other} {
+		checkIntegrity(t, h)
+		var g int
+		if err := h.QueryRow(`SELECT COUNT(*) FROM alerts WHERE line_id = 'G'`).Scan(&g); err != nil {
+			t.Fatal(err)
+		}
+		var f int
+		if err := h.QueryRow(`SELECT COUNT(*) FROM alerts WHERE line_id = 'F'`).Scan(&f); err != nil {
+			t.Fatal(err)
+		}
+		if g != 0 || f != 3 {
+			t.Errorf("%s handle sees %d F and %d G alerts after restore, want 3 and 0", name, f, g)
+		}
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	d, err := Open(filepath.Join(dir, "live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	insertAlert(t, d, "F", "", "Delays", "SIGNIFICANT_DELAYS", "keep me", day(2025, 6, 1, 0))
+
+	newer := filepath.Join(dir, "newer.db")
+	if err := d.Backup(ctx, newer); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := sql.Open("sqlite3", newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	foreign := filepath.Join(dir, "foreign.db")
+	raw, err = sql.Open("sqlite3", foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`CREATE TABLE other (x INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	for _, src := range []string{newer, foreign, filepath.Join(dir, "missing.db")} {
+		if err := d.Restore(ctx, src); err == nil {
+			t.Errorf("Restore(%s) succeeded", filepath.Base(src))
+		}
+	}
+	if n := countAlerts(t, d); n != 1 {
+		t.Errorf("%d alerts after rejected restores, want 1", n)
+	}
+
+	pg := &DB{Dialect: Postgres}
+	if err := pg.Backup(ctx, filepath.Join(dir, "pg.db")); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("Backup on PostgreSQL = %v, want ErrBackupUnsupported", err)
+	}
+	if err := pg.Restore(ctx, newer); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("Restore on PostgreSQL = %v, want ErrBackupUnsupported", err)
+	}
+}
+
+func TestBackupRotate(t *testing.T) {
+	ctx := context.Background()
+	d, err := Open(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	// Files that aren't backups are left alone.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.FixedZone("EDT", -4*3600))
+	var made []string
+	for i := range 4 {
+		dest, err := d.BackupRotate(ctx, dir, 2, start.Add(time.Duration(i)*6*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		made = append(made, filepath.Base(dest))
+	}
+	if made[0] != "nyctcord-20250601T040000Z.db" {
+		t.Errorf("first backup named %s, want a UTC timestamp", made[0])
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"notes.txt", made[2], made[3]}
+	if len(names) != len(want) {
+		t.Fatalf("backup dir = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("backup dir = %v, want %v", names, want)
+		}
+	}
+
+	// keep <= 0 keeps everything.
+	if _, err := d.BackupRotate(ctx, dir, 0, start.Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 4 {
+		t.Errorf("%d entries with rotation disabled, want 4", len(entries))
+	}
+}
@@ -1,101 +1,214 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/mattn/go-sqlite3"
 )
 
+const DefaultDSN = "nyctcord.db"
+
+// sqliteDriver is go-sqlite3 with this package's SQL functions registered
+// on every connection.
+const sqliteDriver = "sqlite3_nyctcord"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("bm25", bm25, true)
+		},
+	})
+}
+
 type DB struct {
 	*sql.DB
+	Dialect Dialect
+
+	// writeMu serialises WithTx on SQLite so writers in one process queue
+	// here instead of spinning on the busy timeout.
+	writeMu sync.Mutex
+}
+
+// Pragmas applied to every SQLite connection through the DSN, so pooled
+// connections opened later get them too. _txlock=immediate takes the write
+// lock at BEGIN rather than failing on lock upgrade mid-transaction.
+// _auto_vacuum=incremental only takes effect on a new database; a full
+// Vacuum converts older ones.
+var sqliteDefaults = map[string]string{
+	"_journal_mode": "WAL",
+	"_busy_timeout": "5000",
+	"_foreign_keys": "on",
+	"_synchronous":  "NORMAL",
+	"_txlock":       "immediate",
+	"_auto_vacuum":  "incremental",
+}
+
+// DSNFromEnv returns $NYCTCORD_DB, falling back to the local SQLite file.
+func DSNFromEnv() string {
+	if v := strings.TrimSpace(os.Getenv("NYCTCORD_DB")); v != "" {
+		return v
+	}
+	return DefaultDSN
 }
 
-func Open(path string) (*DB, error) {
-	database, err := sql.Open("sqlite3", path)
+// Open connects to dsn and applies any pending migrations. A postgres:// or
+// postgresql:// DSN selects PostgreSQL; anything else (optionally prefixed
+// with sqlite://) is treated as a SQLite path.
+func Open(dsn string) (*DB, error) {
+	database, err := Connect(dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := database.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
+	if _, err := database.MigrateUp(context.Background()); err != nil {
+		database.Close()
 		return nil, err
 	}
 
-	if err := migrate(database); err != nil {
+	return database, nil
+}
+
+// Connect opens the database without touching the schema.
+func Connect(dsn string) (*DB, error) {
+	dialect, driverDSN := parseDSN(dsn)
+
+	database, err := sql.Open(dialect.driverName(), driverDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.Ping(); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return &DB{DB: database, Dialect: dialect}, nil
+}
+
+func parseDSN(dsn string) (Dialect, string) {
+	dsn = strings.TrimSpace(dsn)
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return Postgres, dsn
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return SQLite, withSQLiteDefaults(strings.TrimPrefix(dsn, "sqlite://"))
+	default:
+		return SQLite, withSQLiteDefaults(dsn)
+	}
+}
+
+// withSQLiteDefaults adds sqliteDefaults to a SQLite DSN without overriding
+// options the caller set explicitly.
+func withSQLiteDefaults(dsn string) string {
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return dsn
+	}
+	for k, v := range sqliteDefaults {
+		if !q.Has(k) {
+			q.Set(k, v)
+		}
+	}
+	return path + "?" + q.Encode()
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil. On SQLite
+// the transaction holds the database write lock for its whole duration.
+func (d *DB) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	if d.Dialect == SQLite {
+		d.writeMu.Lock()
+		defer d.writeMu.Unlock()
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return d.ExecContext(context.Background(), query, args...)
+}
+
+func (d *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.DB.ExecContext(ctx, d.Dialect.Rebind(query), d.Dialect.args(args)...)
+}
+
+func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.QueryContext(context.Background(), query, args...)
+}
+
+func (d *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, d.Dialect.Rebind(query), d.Dialect.args(args)...)
+}
+
+func (d *DB) QueryRow(query string, args ...any) *sql.Row {
+	return d.QueryRowContext(context.Background(), query, args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.DB.QueryRowContext(ctx, d.Dialect.Rebind(query), d.Dialect.args(args)...)
+}
+
+func (d *DB) Begin() (*Tx, error) {
+	return d.BeginTx(context.Background(), nil)
+}
+
+func (d *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := d.DB.BeginTx(ctx, opts)
+	if err != nil {
 		return nil, err
 	}
+	return &Tx{Tx: tx, Dialect: d.Dialect}, nil
+}
+
+// Tx is a transaction that speaks the same placeholder dialect as DB.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (t *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.ExecContext(context.Background(), query, args...)
+}
+
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.Dialect.Rebind(query), t.Dialect.args(args)...)
+}
+
+func (t *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.QueryContext(context.Background(), query, args...)
+}
+
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.Dialect.Rebind(query), t.Dialect.args(args)...)
+}
+
+func (t *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.QueryRowContext(context.Background(), query, args...)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.Dialect.Rebind(query), t.Dialect.args(args)...)
+}
+
+func (t *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return t.PrepareContext(context.Background(), query)
+}
 
-	return &DB{database}, nil
-}
-
-func migrate(db *sql.DB) error {
-	log.Println("running migrations")
-
-	schema := `
-CREATE TABLE IF NOT EXISTS users (
-    id               INTEGER PRIMARY KEY AUTOINCREMENT,
-    discord_id       TEXT NOT NULL UNIQUE,
-    discord_username TEXT,
-    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE IF NOT EXISTS subscriptions (
-    id          INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id     INTEGER NOT NULL,
-    line_id     TEXT NOT NULL,
-    via_dm      INTEGER NOT NULL DEFAULT 1,   -- 0/1 for false/true
-    via_guild   INTEGER NOT NULL DEFAULT 0,
-    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, line_id),
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-CREATE TABLE IF NOT EXISTS line_status (
-    line_id      TEXT PRIMARY KEY,
-    status       TEXT NOT NULL,
-    header       TEXT,
-    body         TEXT,
-    effect       TEXT,
-    alert_id     TEXT,
-    content_hash TEXT,
-    updated_at   DATETIME NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS alerts (
-    id           INTEGER PRIMARY KEY AUTOINCREMENT,
-    alert_id     TEXT NOT NULL,
-    line_id      TEXT NOT NULL,
-    old_status   TEXT,
-    new_status   TEXT,
-    header       TEXT,
-    body         TEXT,
-    effect       TEXT,
-    started_at   DATETIME,
-    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE INDEX IF NOT EXISTS idx_alerts_line_created_at 
-ON alerts (line_id, created_at);
-
-CREATE TABLE IF NOT EXISTS notifications (
-    id            INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id       INTEGER NOT NULL,
-    alert_id      INTEGER NOT NULL,
-    line_id       TEXT NOT NULL,
-    channel_type  TEXT NOT NULL,   -- 'dm' for now
-    status        TEXT NOT NULL,   -- 'pending', 'sent', 'failed'
-    last_error    TEXT,
-    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    sent_at       DATETIME,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    FOREIGN KEY (alert_id) REFERENCES alerts(id) ON DELETE CASCADE
-);
-
-CREATE INDEX IF NOT EXISTS idx_notifications_status 
-ON notifications(status);
-`
-
-	_, err := db.Exec(schema)
-	return err
+func (t *Tx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.Tx.PrepareContext(ctx, t.Dialect.Rebind(query))
 }
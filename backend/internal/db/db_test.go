@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// The store suite always runs on SQLite. Set NYCTCORD_TEST_POSTGRES to a
+// postgres:// DSN to run it on PostgreSQL as well; every test gets its own
+// schema, dropped afterwards.
+const testPostgresEnv = "NYCTCORD_TEST_POSTGRES"
+
+var testSchemaSeq atomic.Int64
+
+// forEachDialect runs fn against a freshly migrated database of every
+// dialect available.
+func forEachDialect(t *testing.T, fn func(t *testing.T, d *DB)) {
+	t.Helper()
+	t.Run(string(SQLite), func(t *testing.T) {
+		fn(t, openSQLite(t))
+	})
+	t.Run(string(Postgres), func(t *testing.T) {
+		fn(t, openPostgres(t))
+	})
+}
+
+// openSQLite opens a private in-memory database. Shared cache keeps every
+// pooled connection on the same database.
+func openSQLite(t *testing.T) *DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:nyctcord_test_%d?mode=memory&cache=shared", testSchemaSeq.Add(1))
+	d, err := Open(dsn)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func openPostgres(t *testing.T) *DB {
+	t.Helper()
+	dsn := strings.TrimSpace(os.Getenv(testPostgresEnv))
+	if dsn == "" {
+		t.Skip(testPostgresEnv + " not set")
+	}
+
+	admin, err := Connect(dsn)
+	if err != nil {
+		t.Fatalf("connect postgres: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("nyctcord_test_%d_%d", os.Getpid(), testSchemaSeq.Add(1))
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("parse %s: %v", testPostgresEnv, err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	d, err := Open(u.String())
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// day returns midnight UTC on the given date, plus offset.
+func day(y int, m time.Month, d int, offset time.Duration) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Add(offset)
+}
+
+func TestMigrations(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+
+		latest, err := LatestSchemaVersion(d.Dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := d.SchemaVersion(ctx); err != nil || v != latest {
+			t.Fatalf("schema version %d (%v), want %d", v, err, latest)
+		}
+		if n, err := d.MigrateUp(ctx); err != nil || n != 0 {
+			t.Fatalf("second MigrateUp applied %d (%v), want 0", n, err)
+		}
+
+		if n, err := d.MigrateDown(ctx, latest); err != nil || n != latest {
+			t.Fatalf("MigrateDown reverted %d (%v), want %d", n, err, latest)
+		}
+		if v, _ := d.SchemaVersion(ctx); v != 0 {
+			t.Fatalf("schema version %d after full rollback", v)
+		}
+		if n, err := d.MigrateUp(ctx); err != nil || n != latest {
+			t.Fatalf("MigrateUp after rollback applied %d (%v), want %d", n, err, latest)
+		}
+	})
+}
+
+func TestWithTx(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		at := day(2025, 3, 1, 0)
+
+		err := d.WithTx(ctx, func(tx *Tx) error {
+			return tx.Lines().Upsert(ctx, LineStatus{LineID: "A", Status: "Delays", UpdatedAt: at})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		boom := fmt.Errorf("boom")
+		err = d.WithTx(ctx, func(tx *Tx) error {
+			if err := tx.Lines().Upsert(ctx, LineStatus{LineID: "C", Status: "Delays", UpdatedAt: at}); err != nil {
+				return err
+			}
+			return boom
+		})
+		if err != boom {
+			t.Fatalf("WithTx returned %v, want %v", err, boom)
+		}
+
+		if _, err := d.Lines().Get(ctx, "A"); err != nil {
+			t.Errorf("committed row missing: %v", err)
+		}
+		if _, err := d.Lines().Get(ctx, "C"); err != ErrNotFound {
+			t.Errorf("rolled back row: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// TestWithTxConcurrentWriters hammers one SQLite file from two handles, as
+// the API and poller processes do, and expects every write to land without
+// SQLITE_BUSY.
+func TestWithTxConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stress.db")
+	handles := make([]*DB, 2)
+	for i := range handles {
+		d, err := Open(path)
+		if err != nil {
+			t.Fatalf("open handle %d: %v", i, err)
+		}
+		t.Cleanup(func() { d.Close() })
+		handles[i] = d
+	}
+
+	const writers, writes = 8, 25
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*writes*2)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			d := handles[w%len(handles)]
+			line := fmt.Sprintf("L%d", w)
+			for i := 0; i < writes; i++ {
+				errs <- d.WithTx(ctx, func(tx *Tx) error {
+					// Read before writing so a deferred transaction would
+					// have to upgrade its lock.
+					if _, err := tx.Lines().Get(ctx, line); err != nil && err != ErrNotFound {
+						return err
+					}
+					id, err := tx.Alerts().Insert(ctx, Alert{LineID: line, CreatedAt: time.Now()})
+					if err != nil {
+						return err
+					}
+					return tx.Lines().Upsert(ctx, LineStatus{LineID: line, Status: fmt.Sprint(id), UpdatedAt: time.Now()})
+				})
+				_, err := d.Alerts().Recent(ctx, 5)
+				errs <- err
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		var se sqlite3.Error
+		if errors.As(err, &se) && se.Code == sqlite3.ErrBusy {
+			t.Fatalf("SQLITE_BUSY under concurrent WithTx: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("concurrent write: %v", err)
+		}
+	}
+
+	var n int
+	if err := handles[0].QueryRow(`SELECT COUNT(*) FROM alerts`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != writers*writes {
+		t.Errorf("%d alerts written, want %d", n, writers*writes)
+	}
+}
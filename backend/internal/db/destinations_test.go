@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSlackDestinationStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		u := createUser(t, d, "1")
+		store := d.SlackDestinations()
+
+		if _, err := store.Get(ctx, u.ID); err != ErrNotFound {
+			t.Fatalf("Get before Upsert = %v, want ErrNotFound", err)
+		}
+
+		hook := "https://hooks.slack.com/services/T/B/X"
+		if err := store.Upsert(ctx, SlackDestination{UserID: u.ID, WebhookURL: &hook}); err != nil {
+			t.Fatal(err)
+		}
+		token, channel, team := "xoxb-1", "C123", "T9"
+		if err := store.Upsert(ctx, SlackDestination{UserID: u.ID, BotToken: &token, ChannelID: &channel, TeamID: &team}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.WebhookURL != nil || deref(got.BotToken) != token || deref(got.ChannelID) != channel || deref(got.TeamID) != team {
+			t.Errorf("Get after replace = %+v", got)
+		}
+
+		if err := store.Delete(ctx, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get(ctx, u.ID); err != ErrNotFound {
+			t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestPushDestinationStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		u := createUser(t, d, "1")
+		store := d.PushDestinations()
+
+		token := "secret"
+		if err := store.Upsert(ctx, PushDestination{UserID: u.ID, Kind: PushHTTP, URL: "https://push.example/a", Token: &token}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Upsert(ctx, PushDestination{UserID: u.ID, Kind: PushNtfy, URL: "https://ntfy.sh/nyct-a"}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get(ctx, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Kind != PushNtfy || got.URL != "https://ntfy.sh/nyct-a" || got.Token != nil {
+			t.Errorf("Get after replace = %+v", got)
+		}
+
+		if err := store.Delete(ctx, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get(ctx, u.ID); err != ErrNotFound {
+			t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+		}
+	})
+}
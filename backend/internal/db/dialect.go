@@ -0,0 +1,87 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// TimeLayout is how timestamps are stored in SQLite, matching what
+// CURRENT_TIMESTAMP produces for column defaults.
+const TimeLayout = "2006-01-02 15:04:05"
+
+func (d Dialect) driverName() string {
+	if d == Postgres {
+		return "pgx"
+	}
+	return sqliteDriver
+}
+
+// Rebind rewrites ? placeholders into the dialect's native form. Queries in
+// this repo are written with ? so they run unchanged on SQLite.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+			b.WriteByte(c)
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// args normalises query arguments. SQLite keeps timestamps as text, so
+// time.Time values are written in UTC with TimeLayout to stay comparable
+// with rows filled in by CURRENT_TIMESTAMP.
+func (d Dialect) args(args []any) []any {
+	if d != SQLite {
+		return args
+	}
+	out := make([]any, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case time.Time:
+			out[i] = v.UTC().Format(TimeLayout)
+		case *time.Time:
+			if v != nil {
+				out[i] = v.UTC().Format(TimeLayout)
+			} else {
+				out[i] = nil
+			}
+		default:
+			out[i] = a
+		}
+	}
+	return out
+}
+
+// dayExpr formats a timestamp column as a UTC YYYY-MM-DD string.
+func (d Dialect) dayExpr(col string) string {
+	if d == Postgres {
+		return "to_char(" + col + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	}
+	return "date(" + col + ")"
+}
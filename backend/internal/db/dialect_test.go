@@ -0,0 +1,78 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		in      string
+		want    string
+	}{
+		{"sqlite untouched", SQLite, `SELECT * FROM t WHERE a = ? AND b = ?`, `SELECT * FROM t WHERE a = ? AND b = ?`},
+		{"postgres numbered", Postgres, `SELECT * FROM t WHERE a = ? AND b = ?`, `SELECT * FROM t WHERE a = $1 AND b = $2`},
+		{"no placeholders", Postgres, `SELECT 1`, `SELECT 1`},
+		{"quoted question mark", Postgres, `SELECT '?' || x FROM t WHERE a = ?`, `SELECT '?' || x FROM t WHERE a = $1`},
+		{"escaped quote", Postgres, `SELECT 'it''s ?' WHERE a = ? AND b IN (?, ?)`, `SELECT 'it''s ?' WHERE a = $1 AND b IN ($2, $3)`},
+		{"many", Postgres, placeholders(11), `$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.Rebind(tt.in); got != tt.want {
+				t.Errorf("Rebind(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgs(t *testing.T) {
+	at := time.Date(2025, 6, 1, 8, 30, 0, 0, time.FixedZone("EDT", -4*3600))
+	in := []any{at, &at, (*time.Time)(nil), "x", 3}
+
+	got := SQLite.args(in)
+	want := []any{"2025-06-01 12:30:00", "2025-06-01 12:30:00", nil, "x", 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sqlite arg %d = %#v, want %#v", i, got[i], want[i])
+		}
+	}
+
+	if pg := Postgres.args(in); pg[0] != any(at) {
+		t.Errorf("postgres args were rewritten: %#v", pg)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		in      string
+		dialect Dialect
+		prefix  string
+	}{
+		{"nyctcord.db", SQLite, "nyctcord.db?"},
+		{"sqlite:///var/lib/nyctcord.db", SQLite, "/var/lib/nyctcord.db?"},
+		{"postgres://u@localhost/nyctcord", Postgres, "postgres://u@localhost/nyctcord"},
+		{" postgresql://u@localhost/nyctcord ", Postgres, "postgresql://u@localhost/nyctcord"},
+	}
+	for _, tt := range tests {
+		d, dsn := parseDSN(tt.in)
+		if d != tt.dialect || !strings.HasPrefix(dsn, tt.prefix) {
+			t.Errorf("parseDSN(%q) = %s %q", tt.in, d, dsn)
+		}
+	}
+}
+
+func TestWithSQLiteDefaults(t *testing.T) {
+	got := withSQLiteDefaults("x.db?_busy_timeout=100")
+	for _, want := range []string{"_busy_timeout=100", "_journal_mode=WAL", "_foreign_keys=on", "_txlock=immediate", "_auto_vacuum=incremental"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, "_busy_timeout=5000") {
+		t.Errorf("%q overrode an explicit option", got)
+	}
+}
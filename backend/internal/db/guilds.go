@@ -0,0 +1,306 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// GuildChannel is where a Discord server gets service alerts.
+type GuildChannel struct {
+	GuildID   string    `json:"guild_id"`
+	ChannelID string    `json:"channel_id"`
+	AllLines  bool      `json:"all_lines"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GuildLineRole maps a line to the role pinged for its alerts.
+type GuildLineRole struct {
+	GuildID     string `json:"guild_id"`
+	LineID      string `json:"line_id"`
+	RoleID      string `json:"role_id"`
+	MinSeverity string `json:"min_severity"`
+}
+
+// PendingGuildDelivery is a queued guild post joined with its channel and
+// the role mapped to its line, if any.
+type PendingGuildDelivery struct {
+	ID          int64
+	GuildID     string
+	ChannelID   string
+	RoleID      *string
+	MinSeverity string
+	Alert       Alert
+}
+
+type GuildStore struct {
+	q Querier
+}
+
+func (d *DB) Guilds() *GuildStore { return &GuildStore{q: d} }
+func (t *Tx) Guilds() *GuildStore { return &GuildStore{q: t} }
+
+func (s *GuildStore) Channel(ctx context.Context, guildID string) (GuildChannel, error) {
+	var c GuildChannel
+	var allLines int
+	var updated sqlTime
+	err := s.q.QueryRowContext(ctx, `
+		SELECT guild_id, channel_id, all_lines, updated_at
+		FROM guild_channels
+		WHERE guild_id = ?
+	`, guildID).Scan(&c.GuildID, &c.ChannelID, &allLines, &updated)
+	if err == sql.ErrNoRows {
+		return GuildChannel{}, ErrNotFound
+	}
+	if err != nil {
+		return GuildChannel{}, err
+	}
+	c.AllLines = allLines == 1
+	c.UpdatedAt = updated.Time
+	return c, nil
+}
+
+// SetChannel points a guild's alerts at a channel, replacing any previous
+// one.
+func (s *GuildStore) SetChannel(ctx context.Context, c GuildChannel) error {
+	now := time.Now()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO guild_channels (guild_id, channel_id, all_lines, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(guild_id) DO UPDATE SET
+			channel_id = excluded.channel_id,
+			all_lines  = excluded.all_lines,
+			updated_at = excluded.updated_at
+	`, c.GuildID, c.ChannelID, boolInt(c.AllLines), now, now)
+	return err
+}
+
+// DeleteChannel stops posting to a guild and drops its queued posts. Role
+// mappings are kept so they still apply if a channel is set again.
+func (s *GuildStore) DeleteChannel(ctx context.Context, guildID string) error {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM guild_deliveries WHERE guild_id = ?`, guildID); err != nil {
+		return err
+	}
+	_, err := s.q.ExecContext(ctx, `DELETE FROM guild_channels WHERE guild_id = ?`, guildID)
+	return err
+}
+
+// LineRoles returns a guild's role mappings ordered by line.
+func (s *GuildStore) LineRoles(ctx context.Context, guildID string) ([]GuildLineRole, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT guild_id, line_id, role_id, min_severity
+		FROM guild_line_roles
+		WHERE guild_id = ?
+		ORDER BY line_id
+	`, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]GuildLineRole, 0)
+	for rows.Next() {
+		var r GuildLineRole
+		if err := rows.Scan(&r.GuildID, &r.LineID, &r.RoleID, &r.MinSeverity); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *GuildStore) SetLineRole(ctx context.Context, r GuildLineRole) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO guild_line_roles (guild_id, line_id, role_id, min_severity, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(guild_id, line_id) DO UPDATE SET
+			role_id      = excluded.role_id,
+			min_severity = excluded.min_severity
+	`, r.GuildID, r.LineID, r.RoleID, r.MinSeverity, time.Now())
+	return err
+}
+
+// DeleteLineRole returns ErrNotFound if the line had no role.
+func (s *GuildStore) DeleteLineRole(ctx context.Context, guildID, lineID string) error {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM guild_line_roles WHERE guild_id = ? AND line_id = ?
+	`, guildID, lineID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EnqueueForLine queues a post in every guild that follows all lines or
+// has a role mapped for lineID (or ALL).
+func (s *GuildStore) EnqueueForLine(ctx context.Context, alertID int64, lineID string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO guild_deliveries (guild_id, alert_id, line_id, status, created_at)
+		SELECT g.guild_id, ?, ?, 'pending', ?
+		FROM guild_channels g
+		WHERE g.all_lines = 1 OR EXISTS (
+			SELECT 1 FROM guild_line_roles r
+			WHERE r.guild_id = g.guild_id AND (r.line_id = ? OR r.line_id = 'ALL')
+		)
+	`, alertID, lineID, at, lineID)
+	return err
+}
+
+// Pending returns up to limit queued guild posts, oldest first. A role
+// mapped to the line itself wins over one mapped to ALL.
+func (s *GuildStore) Pending(ctx context.Context, limit int) ([]PendingGuildDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT
+			d.id,
+			d.guild_id,
+			g.channel_id,
+			COALESCE(r.role_id, ra.role_id),
+			COALESCE(r.min_severity, ra.min_severity, ''),
+			`+prefixed("a", alertColumns)+`
+		FROM guild_deliveries d
+		JOIN guild_channels g ON g.guild_id = d.guild_id
+		JOIN alerts a ON a.id = d.alert_id
+		LEFT JOIN guild_line_roles r ON r.guild_id = d.guild_id AND r.line_id = d.line_id
+		LEFT JOIN guild_line_roles ra ON ra.guild_id = d.guild_id AND ra.line_id = 'ALL'
+		WHERE d.status = 'pending'
+		ORDER BY d.id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]PendingGuildDelivery, 0)
+	for rows.Next() {
+		var p PendingGuildDelivery
+		var roleID sql.NullString
+		a, err := scanAlert(scanFunc(func(dest ...any) error {
+			return rows.Scan(append([]any{&p.ID, &p.GuildID, &p.ChannelID, &roleID, &p.MinSeverity}, dest...)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		p.RoleID = nullString(roleID)
+		p.Alert = a
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *GuildStore) MarkSent(ctx context.Context, id int64, messageID string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE guild_deliveries
+		SET status='sent', message_id=?, last_error=NULL, sent_at=?
+		WHERE id=?
+	`, nullIfEmpty(&messageID), at, id)
+	return err
+}
+
+func (s *GuildStore) MarkFailed(ctx context.Context, id int64, msg string) error {
+	msg = strings.TrimSpace(msg)
+	if len(msg) > 400 {
+		msg = msg[:400]
+	}
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE guild_deliveries
+		SET status='failed', last_error=?, sent_at=NULL
+		WHERE id=?
+	`, msg, id)
+	return err
+}
+
+// Thread returns the thread a guild opened for a GTFS-RT alert.
+func (s *GuildStore) Thread(ctx context.Context, guildID, alertID string) (string, error) {
+	var threadID string
+	err := s.q.QueryRowContext(ctx, `
+		SELECT thread_id
+		FROM guild_alert_threads
+		WHERE guild_id = ? AND alert_id = ?
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, guildID, alertID).Scan(&threadID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return threadID, err
+}
+
+// AddThread records that lineID's posts about alertID go to threadID,
+// reopening the row if the line had already been resolved.
+func (s *GuildStore) AddThread(ctx context.Context, guildID, alertID, lineID, threadID string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO guild_alert_threads (guild_id, alert_id, line_id, thread_id, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(guild_id, alert_id, line_id) DO UPDATE SET
+			thread_id   = excluded.thread_id,
+			resolved_at = NULL
+	`, guildID, alertID, lineID, threadID, at)
+	return err
+}
+
+// OpenThreads returns the threads still open for lineID in a guild.
+func (s *GuildStore) OpenThreads(ctx context.Context, guildID, lineID string) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT DISTINCT thread_id
+		FROM guild_alert_threads
+		WHERE guild_id = ? AND line_id = ? AND resolved_at IS NULL
+	`, guildID, lineID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// ResolveLine marks lineID resolved in every open thread of a guild and
+// returns the threads that have no unresolved lines left. Run it inside
+// WithTx so the threads it reads are the ones it updates.
+func (s *GuildStore) ResolveLine(ctx context.Context, guildID, lineID string, at time.Time) ([]string, error) {
+	threads, err := s.OpenThreads(ctx, guildID, lineID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE guild_alert_threads
+		SET resolved_at = ?
+		WHERE guild_id = ? AND line_id = ? AND resolved_at IS NULL
+	`, at, guildID, lineID); err != nil {
+		return nil, err
+	}
+
+	done := make([]string, 0, len(threads))
+	for _, id := range threads {
+		var open int
+		if err := s.q.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM guild_alert_threads
+			WHERE thread_id = ? AND resolved_at IS NULL
+		`, id).Scan(&open); err != nil {
+			return nil, err
+		}
+		if open == 0 {
+			done = append(done, id)
+		}
+	}
+	return done, nil
+}
+
+// DeleteThread forgets a thread, e.g. after it was deleted in Discord.
+func (s *GuildStore) DeleteThread(ctx context.Context, threadID string) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM guild_alert_threads WHERE thread_id = ?`, threadID)
+	return err
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuildPending(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		at := day(2025, 5, 1, 9*time.Hour)
+		gs := d.Guilds()
+
+		// roles follows every line with a catch-all role and its own role
+		// for F; plain follows every line with no roles; picky only
+		// follows lines with a role, which is just G.
+		for _, c := range []GuildChannel{
+			{GuildID: "roles", ChannelID: "c-roles", AllLines: true},
+			{GuildID: "plain", ChannelID: "c-plain", AllLines: true},
+			{GuildID: "picky", ChannelID: "c-picky"},
+		} {
+			if err := gs.SetChannel(ctx, c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, r := range []GuildLineRole{
+			{GuildID: "roles", LineID: "ALL", RoleID: "r-all"},
+			{GuildID: "roles", LineID: "F", RoleID: "r-f", MinSeverity: "NO_SERVICE"},
+			{GuildID: "picky", LineID: "G", RoleID: "r-g", MinSeverity: "SIGNIFICANT_DELAYS"},
+		} {
+			if err := gs.SetLineRole(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		alertF := insertAlert(t, d, "F", "", "Delays", "SIGNIFICANT_DELAYS", "F delays", at)
+		alertA := insertAlert(t, d, "A", "", "Delays", "SIGNIFICANT_DELAYS", "A delays", at)
+		alertG := insertAlert(t, d, "G", "", "Delays", "SIGNIFICANT_DELAYS", "G delays", at)
+		for _, e := range []struct {
+			id   int64
+			line string
+		}{{alertF, "F"}, {alertA, "A"}, {alertG, "G"}} {
+			if err := gs.EnqueueForLine(ctx, e.id, e.line, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		pending, err := gs.Pending(ctx, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		type key struct{ guild, line string }
+		type want struct{ channel, role, minSeverity string }
+		got := map[key]want{}
+		for _, p := range pending {
+			got[key{p.GuildID, p.Alert.LineID}] = want{p.ChannelID, deref(p.RoleID), p.MinSeverity}
+		}
+		expected := map[key]want{
+			// The line's own role wins over ALL.
+			{"roles", "F"}: {"c-roles", "r-f", "NO_SERVICE"},
+			// Lines without their own role fall back to ALL.
+			{"roles", "A"}: {"c-roles", "r-all", ""},
+			{"roles", "G"}: {"c-roles", "r-all", ""},
+			{"plain", "F"}: {"c-plain", "", ""},
+			{"plain", "A"}: {"c-plain", "", ""},
+			{"plain", "G"}: {"c-plain", "", ""},
+			{"picky", "G"}: {"c-picky", "r-g", "SIGNIFICANT_DELAYS"},
+		}
+		if len(got) != len(pending) || len(got) != len(expected) {
+			t.Fatalf("got %d pending posts %v, want %d", len(pending), got, len(expected))
+		}
+		for k, w := range expected {
+			if got[k] != w {
+				t.Errorf("%s/%s = %+v, want %+v", k.guild, k.line, got[k], w)
+			}
+		}
+		for i := 1; i < len(pending); i++ {
+			if pending[i].ID < pending[i-1].ID {
+				t.Fatalf("pending posts not oldest first")
+			}
+		}
+
+		// Sent and failed posts leave the queue.
+		if err := gs.MarkSent(ctx, pending[0].ID, "m1", at); err != nil {
+			t.Fatal(err)
+		}
+		if err := gs.MarkFailed(ctx, pending[1].ID, "Missing Access"); err != nil {
+			t.Fatal(err)
+		}
+		after, err := gs.Pending(ctx, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != len(pending)-2 {
+			t.Errorf("%d pending after marking 2, want %d", len(after), len(pending)-2)
+		}
+
+		// Turning a guild off drops its queue.
+		if err := gs.DeleteChannel(ctx, "plain"); err != nil {
+			t.Fatal(err)
+		}
+		after, err = gs.Pending(ctx, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range after {
+			if p.GuildID == "plain" {
+				t.Errorf("post %d for a deleted channel still pending", p.ID)
+			}
+		}
+	})
+}
+
+func TestGuildThreads(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		at := day(2025, 5, 1, 9*time.Hour)
+		gs := d.Guilds()
+
+		for _, g := range []string{"g1", "g2"} {
+			if err := gs.SetChannel(ctx, GuildChannel{GuildID: g, ChannelID: "c-" + g, AllLines: true}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := gs.Thread(ctx, "g1", "MTA:1"); err != ErrNotFound {
+			t.Fatalf("Thread before any = %v, want ErrNotFound", err)
+		}
+
+		// MTA:1 covers F and M in one thread; MTA:2 covers F alone; g2
+		// has its own thread for MTA:1.
+		for _, th := range []struct{ guild, alert, line, thread string }{
+			{"g1", "MTA:1", "F", "t1"},
+			{"g1", "MTA:1", "M", "t1"},
+			{"g1", "MTA:2", "F", "t2"},
+			{"g2", "MTA:1", "F", "t9"},
+		} {
+			if err := gs.AddThread(ctx, th.guild, th.alert, th.line, th.thread, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if id, err := gs.Thread(ctx, "g1", "MTA:1"); err != nil || id != "t1" {
+			t.Errorf("Thread(g1, MTA:1) = %q, %v; want t1", id, err)
+		}
+		open, err := gs.OpenThreads(ctx, "g1", "F")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(open)
+		if strings.Join(open, ",") != "t1,t2" {
+			t.Errorf("OpenThreads(g1, F) = %v, want t1 and t2", open)
+		}
+
+		resolve := func(guild, line string) []string {
+			t.Helper()
+			var done []string
+			err := d.WithTx(ctx, func(tx *Tx) error {
+				var err error
+				done, err = tx.Guilds().ResolveLine(ctx, guild, line, at.Add(time.Hour))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(done)
+			return done
+		}
+
+		// Resolving F finishes t2, but t1 still has M open. g2 is untouched.
+		if done := resolve("g1", "F"); strings.Join(done, ",") != "t2" {
+			t.Errorf("ResolveLine(F) done = %v, want t2", done)
+		}
+		if open, _ := gs.OpenThreads(ctx, "g1", "F"); len(open) != 0 {
+			t.Errorf("F still open in %v", open)
+		}
+		if open, _ := gs.OpenThreads(ctx, "g2", "F"); len(open) != 1 {
+			t.Errorf("g2 threads = %v, want its own left open", open)
+		}
+
+		// Resolving again finds nothing to do.
+		if done := resolve("g1", "F"); len(done) != 0 {
+			t.Errorf("second ResolveLine(F) done = %v, want none", done)
+		}
+
+		if done := resolve("g1", "M"); strings.Join(done, ",") != "t1" {
+			t.Errorf("ResolveLine(M) done = %v, want t1", done)
+		}
+
+		// The alert spreading back to F reopens its row.
+		if err := gs.AddThread(ctx, "g1", "MTA:1", "F", "t1", at.Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if open, _ := gs.OpenThreads(ctx, "g1", "F"); strings.Join(open, ",") != "t1" {
+			t.Errorf("OpenThreads(g1, F) after reopening = %v, want t1", open)
+		}
+		if open, _ := gs.OpenThreads(ctx, "g1", "M"); len(open) != 0 {
+			t.Errorf("reopening F reopened M: %v", open)
+		}
+
+		// A deleted thread is forgotten for every line.
+		if err := gs.DeleteThread(ctx, "t1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gs.Thread(ctx, "g1", "MTA:1"); err != ErrNotFound {
+			t.Errorf("Thread after delete = %v, want ErrNotFound", err)
+		}
+		if id, err := gs.Thread(ctx, "g2", "MTA:1"); err != nil || id != "t9" {
+			t.Errorf("g2 thread = %q, %v; want t9 kept", id, err)
+		}
+	})
+}
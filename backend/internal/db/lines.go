@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// StatusGoodService is recorded when a line's last active alert clears.
+const StatusGoodService = "Good Service"
+
+// IsDisrupted reports whether status describes anything other than normal
+// service. The empty string is the "old status" of a line's first alert.
+func IsDisrupted(status string) bool {
+	return status != "" && status != StatusGoodService
+}
+
+type LineStatus struct {
+	LineID      string    `json:"line_id"`
+	Status      string    `json:"status"`
+	Header      *string   `json:"header,omitempty"`
+	Body        *string   `json:"body,omitempty"`
+	Effect      *string   `json:"effect,omitempty"`
+	ContentHash string    `json:"-"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type LineStatusStore struct {
+	q Querier
+}
+
+const lineStatusColumns = `line_id, status, header, body, effect, content_hash, updated_at`
+
+func scanLineStatus(sc interface{ Scan(...any) error }) (LineStatus, error) {
+	var ls LineStatus
+	var header, body, effect, hash sql.NullString
+	var updated sqlTime
+	if err := sc.Scan(&ls.LineID, &ls.Status, &header, &body, &effect, &hash, &updated); err != nil {
+		return LineStatus{}, err
+	}
+	ls.Header = nullString(header)
+	ls.Body = nullString(body)
+	ls.Effect = nullString(effect)
+	ls.ContentHash = hash.String
+	ls.UpdatedAt = updated.Time
+	return ls, nil
+}
+
+func (s *LineStatusStore) List(ctx context.Context) ([]LineStatus, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+lineStatusColumns+`
+		FROM line_status
+		ORDER BY line_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]LineStatus, 0)
+	for rows.Next() {
+		ls, err := scanLineStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ls)
+	}
+	return out, rows.Err()
+}
+
+func (s *LineStatusStore) Get(ctx context.Context, lineID string) (LineStatus, error) {
+	ls, err := scanLineStatus(s.q.QueryRowContext(ctx, `
+		SELECT `+lineStatusColumns+`
+		FROM line_status
+		WHERE line_id = ?
+	`, lineID))
+	if err == sql.ErrNoRows {
+		return LineStatus{}, ErrNotFound
+	}
+	return ls, err
+}
+
+func (s *LineStatusStore) Upsert(ctx context.Context, ls LineStatus) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO line_status (line_id, status, header, body, effect, content_hash, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(line_id) DO UPDATE SET
+			status       = excluded.status,
+			header       = excluded.header,
+			body         = excluded.body,
+			effect       = excluded.effect,
+			content_hash = excluded.content_hash,
+			updated_at   = excluded.updated_at
+	`, ls.LineID, ls.Status, nullIfEmpty(ls.Header), nullIfEmpty(ls.Body), nullIfEmpty(ls.Effect), ls.ContentHash, ls.UpdatedAt)
+	return err
+}
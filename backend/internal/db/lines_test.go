@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLineStatusStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		store := d.Lines()
+
+		if _, err := store.Get(ctx, "A"); err != ErrNotFound {
+			t.Fatalf("Get on empty table: %v, want ErrNotFound", err)
+		}
+
+		header, blank := "Delays", "  "
+		first := LineStatus{LineID: "C", Status: "Delays", Header: &header, Body: &blank, ContentHash: "h1", UpdatedAt: day(2025, 1, 2, 0)}
+		if err := store.Upsert(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Upsert(ctx, LineStatus{LineID: "A", Status: StatusGoodService, UpdatedAt: day(2025, 1, 2, 0)}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get(ctx, "C")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != "Delays" || deref(got.Header) != "Delays" || got.ContentHash != "h1" || !got.UpdatedAt.Equal(first.UpdatedAt) {
+			t.Errorf("Get = %+v", got)
+		}
+		if got.Body != nil {
+			t.Errorf("blank body stored as %q, want NULL", *got.Body)
+		}
+
+		updated := first
+		updated.Status, updated.Header, updated.ContentHash = "No Service", nil, "h2"
+		updated.UpdatedAt = day(2025, 1, 2, 5*time.Minute)
+		if err := store.Upsert(ctx, updated); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = store.Get(ctx, "C")
+		if got.Status != "No Service" || got.Header != nil || got.ContentHash != "h2" || !got.UpdatedAt.Equal(updated.UpdatedAt) {
+			t.Errorf("after update Get = %+v", got)
+		}
+
+		all, err := store.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 2 || all[0].LineID != "A" || all[1].LineID != "C" {
+			t.Errorf("List = %+v, want A then C", all)
+		}
+	})
+}
+
+func TestIsDisrupted(t *testing.T) {
+	for status, want := range map[string]bool{"": false, StatusGoodService: false, "Delays": true, "No Service": true} {
+		if got := IsDisrupted(status); got != want {
+			t.Errorf("IsDisrupted(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
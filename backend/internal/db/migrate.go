@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change loaded from
+// migrations/<dialect>/NNNN_name.{up,down}.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations(dialect Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		numPart, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(numPart)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version: %w", name, err)
+		}
+
+		b, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func (d *DB) ensureMigrationsTable(ctx context.Context) error {
+	timeType := "DATETIME"
+	if d.Dialect == Postgres {
+		timeType = "TIMESTAMPTZ"
+	}
+	_, err := d.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at `+timeType+` NOT NULL
+		)
+	`)
+	return err
+}
+
+func (d *DB) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := d.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		out[v] = at
+	}
+	return out, rows.Err()
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an
+// empty database.
+func (d *DB) SchemaVersion(ctx context.Context) (int, error) {
+	if err := d.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+	var v sql.NullInt64
+	if err := d.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&v); err != nil {
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+// LatestSchemaVersion is the version the embedded migrations bring a
+// database up to.
+func LatestSchemaVersion(dialect Dialect) (int, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+func (d *DB) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := loadMigrations(d.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		st := MigrationState{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			st.AppliedAt = &at
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// MigrateUp applies every pending migration in version order, each in its
+// own transaction, and returns how many were applied.
+func (d *DB) MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(d.Dialect)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("db: applying migration %04d_%s", m.Version, m.Name)
+		if err := d.runMigration(ctx, m.Up, func(tx *Tx) error {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the newest steps applied migrations.
+func (d *DB) MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := loadMigrations(d.Dialect)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return count, fmt.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+		log.Printf("db: reverting migration %04d_%s", m.Version, m.Name)
+		if err := d.runMigration(ctx, m.Down, func(tx *Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		}); err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (d *DB) runMigration(ctx context.Context, script string, record func(*Tx) error) error {
+	return d.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+		return record(tx)
+	})
+}
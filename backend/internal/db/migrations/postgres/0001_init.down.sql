@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_notifications_status;
+DROP TABLE IF EXISTS notifications;
+DROP INDEX IF EXISTS idx_alerts_line_created_at;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS line_status;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS users;
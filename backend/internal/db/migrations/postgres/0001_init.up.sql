@@ -0,0 +1,62 @@
+CREATE TABLE IF NOT EXISTS users (
+    id               BIGSERIAL PRIMARY KEY,
+    discord_id       TEXT NOT NULL UNIQUE,
+    discord_username TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL,
+    line_id     TEXT NOT NULL,
+    via_dm      INTEGER NOT NULL DEFAULT 1,   -- 0/1 for false/true
+    via_guild   INTEGER NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, line_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS line_status (
+    line_id      TEXT PRIMARY KEY,
+    status       TEXT NOT NULL,
+    header       TEXT,
+    body         TEXT,
+    effect       TEXT,
+    alert_id     TEXT,
+    content_hash TEXT,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id           BIGSERIAL PRIMARY KEY,
+    alert_id     TEXT NOT NULL,
+    line_id      TEXT NOT NULL,
+    old_status   TEXT,
+    new_status   TEXT,
+    header       TEXT,
+    body         TEXT,
+    effect       TEXT,
+    started_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_line_created_at
+ON alerts (line_id, created_at);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL,
+    alert_id      BIGINT NOT NULL,
+    line_id       TEXT NOT NULL,
+    channel_type  TEXT NOT NULL,   -- 'dm' for now
+    status        TEXT NOT NULL,   -- 'pending', 'sent', 'failed'
+    last_error    TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at       TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (alert_id) REFERENCES alerts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_status
+ON notifications(status);
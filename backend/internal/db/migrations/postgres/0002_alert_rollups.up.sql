@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS alert_daily_rollups (
+    day         TEXT NOT NULL,      -- YYYY-MM-DD (UTC)
+    line_id     TEXT NOT NULL,
+    new_status  TEXT NOT NULL DEFAULT '',
+    effect      TEXT NOT NULL DEFAULT '',
+    alerts      INTEGER NOT NULL,
+    PRIMARY KEY (day, line_id, new_status, effect)
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_created_at
+ON alerts (created_at);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_status_created_at
+ON notifications (status, created_at);
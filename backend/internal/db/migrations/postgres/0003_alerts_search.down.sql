@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_alerts_search;
+ALTER TABLE alerts DROP COLUMN IF EXISTS search;
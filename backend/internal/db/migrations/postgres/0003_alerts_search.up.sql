@@ -0,0 +1,4 @@
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', coalesce(header, '') || ' ' || coalesce(body, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_alerts_search ON alerts USING GIN (search);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS line_incident_daily;
+DROP TABLE IF EXISTS line_status_daily;
+DROP TABLE IF EXISTS stats_rollup_days;
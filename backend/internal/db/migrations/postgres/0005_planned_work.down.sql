@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_calendar_token;
+ALTER TABLE users DROP COLUMN calendar_token;
+DROP TABLE IF EXISTS planned_work;
@@ -0,0 +1,14 @@
+ALTER TABLE subscriptions ADD COLUMN via_slack INTEGER NOT NULL DEFAULT 0;
+
+-- Where a user's Slack notifications go: either an incoming webhook URL, or
+-- a bot token plus channel for workspaces that installed the app.
+CREATE TABLE IF NOT EXISTS slack_destinations (
+    user_id      BIGINT PRIMARY KEY,
+    webhook_url  TEXT,
+    bot_token    TEXT,
+    channel_id   TEXT,
+    team_id      TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN email_verify_token TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_verify_token
+ON users (email_verify_token);
+
+ALTER TABLE subscriptions ADD COLUMN via_email INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Provider-side id of a sent notification (Discord message id, Slack ts,
+-- email Message-ID, ...), for follow-ups and debugging.
+ALTER TABLE notifications ADD COLUMN external_id TEXT;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS guild_deliveries;
+DROP TABLE IF EXISTS guild_line_roles;
+DROP TABLE IF EXISTS guild_channels;
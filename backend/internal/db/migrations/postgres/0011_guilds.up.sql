@@ -0,0 +1,38 @@
+-- The channel a Discord server gets service alerts in. With all_lines
+-- unset, only lines that have a role mapped are posted.
+CREATE TABLE IF NOT EXISTS guild_channels (
+    guild_id    TEXT PRIMARY KEY,
+    channel_id  TEXT NOT NULL,
+    all_lines   INTEGER NOT NULL DEFAULT 1,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The role pinged for a line's alerts; 'ALL' covers lines with no role of
+-- their own. Alerts less severe than min_severity (a GTFS-RT effect, empty
+-- for any) are posted silently.
+CREATE TABLE IF NOT EXISTS guild_line_roles (
+    guild_id      TEXT NOT NULL,
+    line_id       TEXT NOT NULL,
+    role_id       TEXT NOT NULL,
+    min_severity  TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (guild_id, line_id)
+);
+
+CREATE TABLE IF NOT EXISTS guild_deliveries (
+    id          BIGSERIAL PRIMARY KEY,
+    guild_id    TEXT NOT NULL,
+    alert_id    BIGINT NOT NULL,
+    line_id     TEXT NOT NULL,
+    status      TEXT NOT NULL,   -- 'pending', 'sent', 'failed'
+    message_id  TEXT,
+    last_error  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at     TIMESTAMPTZ,
+    FOREIGN KEY (guild_id) REFERENCES guild_channels(guild_id) ON DELETE CASCADE,
+    FOREIGN KEY (alert_id) REFERENCES alerts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_guild_deliveries_status
+ON guild_deliveries (status, id);
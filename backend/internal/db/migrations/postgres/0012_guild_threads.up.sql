@@ -0,0 +1,19 @@
+-- The thread a guild's posts about one GTFS-RT alert go into. An alert
+-- covering several lines has a row per line sharing one thread, which is
+-- archived once every line has been resolved.
+CREATE TABLE IF NOT EXISTS guild_alert_threads (
+    guild_id     TEXT NOT NULL,
+    alert_id     TEXT NOT NULL,   -- GTFS-RT entity id (alerts.alert_id)
+    line_id      TEXT NOT NULL,
+    thread_id    TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at  TIMESTAMPTZ,
+    PRIMARY KEY (guild_id, alert_id, line_id),
+    FOREIGN KEY (guild_id) REFERENCES guild_channels(guild_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_guild_alert_threads_line
+ON guild_alert_threads (guild_id, line_id, resolved_at);
+
+CREATE INDEX IF NOT EXISTS idx_guild_alert_threads_thread
+ON guild_alert_threads (thread_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_notifications_status_created_at;
+DROP INDEX IF EXISTS idx_alerts_created_at;
+DROP TABLE IF EXISTS alert_daily_rollups;
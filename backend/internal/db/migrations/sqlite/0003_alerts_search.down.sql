@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS alerts_fts_au;
+DROP TRIGGER IF EXISTS alerts_fts_bu;
+DROP TRIGGER IF EXISTS alerts_fts_bd;
+DROP TRIGGER IF EXISTS alerts_fts_ai;
+DROP TABLE IF EXISTS alerts_fts;
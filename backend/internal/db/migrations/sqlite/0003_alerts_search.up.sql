@@ -0,0 +1,22 @@
+-- FTS4 rather than FTS5: go-sqlite3 only compiles FTS5 in with the
+-- sqlite_fts5 build tag, while FTS4 is always available.
+CREATE VIRTUAL TABLE IF NOT EXISTS alerts_fts USING fts4(content="alerts", header, body);
+
+INSERT INTO alerts_fts (docid, header, body)
+SELECT id, header, body FROM alerts;
+
+CREATE TRIGGER IF NOT EXISTS alerts_fts_ai AFTER INSERT ON alerts BEGIN
+    INSERT INTO alerts_fts (docid, header, body) VALUES (new.id, new.header, new.body);
+END;
+
+CREATE TRIGGER IF NOT EXISTS alerts_fts_bd BEFORE DELETE ON alerts BEGIN
+    DELETE FROM alerts_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS alerts_fts_bu BEFORE UPDATE ON alerts BEGIN
+    DELETE FROM alerts_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS alerts_fts_au AFTER UPDATE ON alerts BEGIN
+    INSERT INTO alerts_fts (docid, header, body) VALUES (new.id, new.header, new.body);
+END;
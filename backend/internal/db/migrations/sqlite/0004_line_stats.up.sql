@@ -0,0 +1,26 @@
+-- Daily rollups of the alerts transition log, one set per completed UTC day.
+CREATE TABLE IF NOT EXISTS stats_rollup_days (
+    day          TEXT PRIMARY KEY,   -- YYYY-MM-DD (UTC)
+    computed_at  DATETIME NOT NULL
+);
+
+-- Seconds each line spent in each status on a day.
+CREATE TABLE IF NOT EXISTS line_status_daily (
+    day      TEXT NOT NULL,
+    line_id  TEXT NOT NULL,
+    status   TEXT NOT NULL,
+    seconds  INTEGER NOT NULL,
+    PRIMARY KEY (day, line_id, status)
+);
+
+-- Incidents (good -> disrupted) started on a day by effect, and incidents
+-- resolved on that day with their total duration.
+CREATE TABLE IF NOT EXISTS line_incident_daily (
+    day                 TEXT NOT NULL,
+    line_id             TEXT NOT NULL,
+    effect              TEXT NOT NULL DEFAULT '',
+    started             INTEGER NOT NULL DEFAULT 0,
+    resolved            INTEGER NOT NULL DEFAULT 0,
+    resolution_seconds  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, line_id, effect)
+);
@@ -0,0 +1,25 @@
+-- Planned work seen in the feeds, one row per alert, line and active
+-- period, kept while the period hasn't ended so it can be exported ahead
+-- of time.
+CREATE TABLE IF NOT EXISTS planned_work (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    alert_id       TEXT NOT NULL,   -- GTFS-RT entity id
+    line_id        TEXT NOT NULL,
+    effect         TEXT,
+    header         TEXT,
+    body           TEXT,
+    starts_at      DATETIME NOT NULL,
+    ends_at        DATETIME,   -- NULL when open-ended
+    first_seen_at  DATETIME NOT NULL,
+    last_seen_at   DATETIME NOT NULL,
+    UNIQUE (alert_id, line_id, starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_planned_work_line_starts_at
+ON planned_work (line_id, starts_at);
+
+-- Secret used in calendar feed URLs, since calendar apps can't send auth.
+ALTER TABLE users ADD COLUMN calendar_token TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token
+ON users (calendar_token);
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id     INTEGER NOT NULL,
+    url         TEXT NOT NULL,
+    secret      TEXT NOT NULL,   -- HMAC-SHA256 key for the signature header
+    active      INTEGER NOT NULL DEFAULT 1,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Lines a webhook fires for; 'ALL' matches every line, as in subscriptions.
+CREATE TABLE IF NOT EXISTS webhook_lines (
+    webhook_id  INTEGER NOT NULL,
+    line_id     TEXT NOT NULL,
+    PRIMARY KEY (webhook_id, line_id),
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_lines_line
+ON webhook_lines (line_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id       INTEGER NOT NULL,
+    alert_id         INTEGER NOT NULL,
+    status           TEXT NOT NULL,   -- 'pending', 'sent', 'failed'
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  DATETIME NOT NULL,
+    response_code    INTEGER,
+    last_error       TEXT,
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at     DATETIME,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+    FOREIGN KEY (alert_id) REFERENCES alerts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status_next
+ON webhook_deliveries (status, next_attempt_at);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook
+ON webhook_deliveries (webhook_id, id);
@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions DROP COLUMN via_email;
+DROP INDEX IF EXISTS idx_users_email_verify_token;
+ALTER TABLE users DROP COLUMN email_verify_token;
+ALTER TABLE users DROP COLUMN email_verified_at;
+ALTER TABLE users DROP COLUMN email;
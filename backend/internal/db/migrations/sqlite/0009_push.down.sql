@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS push_destinations;
+ALTER TABLE subscriptions DROP COLUMN via_push;
@@ -0,0 +1,13 @@
+ALTER TABLE subscriptions ADD COLUMN via_push INTEGER NOT NULL DEFAULT 0;
+
+-- Where a user's push notifications go: an ntfy topic URL, or any HTTP
+-- endpoint that accepts a JSON push payload.
+CREATE TABLE IF NOT EXISTS push_destinations (
+    user_id     INTEGER PRIMARY KEY,
+    kind        TEXT NOT NULL,   -- 'ntfy' or 'http'
+    url         TEXT NOT NULL,
+    token       TEXT,            -- optional bearer token
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
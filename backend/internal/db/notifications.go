@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// PendingNotification is a queued delivery joined with the user and alert
+// it belongs to.
+type PendingNotification struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	DiscordID   string    `json:"discord_id"`
+	LineID      string    `json:"line_id"`
+	ChannelType string    `json:"channel_type"`
+	OldStatus   *string   `json:"old_status,omitempty"`
+	NewStatus   *string   `json:"new_status,omitempty"`
+	Header      *string   `json:"header,omitempty"`
+	Body        *string   `json:"body,omitempty"`
+	Effect      *string   `json:"effect,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type NotificationStore struct {
+	q Querier
+}
+
+// Channel types of rows in the notifications queue.
+const (
+	ChannelDM    = "dm"
+	ChannelSlack = "slack"
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+// EnqueueForLine queues a pending notification for every user subscribed to
+// lineID or to ALL, one per channel they enabled. Slack, push and email rows
+// are only queued for users who configured a destination or verified an
+// address.
+func (s *NotificationStore) EnqueueForLine(ctx context.Context, alertID int64, lineID string, at time.Time) error {
+	if _, err := s.q.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, alert_id, line_id, channel_type, status, created_at)
+		SELECT DISTINCT s.user_id, ?, ?, 'dm', 'pending', ?
+		FROM subscriptions s
+		WHERE (s.line_id = ? OR s.line_id = 'ALL') AND s.via_dm = 1
+	`, alertID, lineID, at, lineID); err != nil {
+		return err
+	}
+
+	if _, err := s.q.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, alert_id, line_id, channel_type, status, created_at)
+		SELECT DISTINCT s.user_id, ?, ?, 'slack', 'pending', ?
+		FROM subscriptions s
+		JOIN slack_destinations d ON d.user_id = s.user_id
+		WHERE (s.line_id = ? OR s.line_id = 'ALL') AND s.via_slack = 1
+	`, alertID, lineID, at, lineID); err != nil {
+		return err
+	}
+
+	if _, err := s.q.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, alert_id, line_id, channel_type, status, created_at)
+		SELECT DISTINCT s.user_id, ?, ?, 'push', 'pending', ?
+		FROM subscriptions s
+		JOIN push_destinations d ON d.user_id = s.user_id
+		WHERE (s.line_id = ? OR s.line_id = 'ALL') AND s.via_push = 1
+	`, alertID, lineID, at, lineID); err != nil {
+		return err
+	}
+
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, alert_id, line_id, channel_type, status, created_at)
+		SELECT DISTINCT s.user_id, ?, ?, 'email', 'pending', ?
+		FROM subscriptions s
+		JOIN users u ON u.id = s.user_id
+		WHERE (s.line_id = ? OR s.line_id = 'ALL') AND s.via_email = 1
+			AND u.email IS NOT NULL AND u.email_verified_at IS NOT NULL
+	`, alertID, lineID, at, lineID)
+	return err
+}
+
+// Pending returns up to limit pending notifications for channelType (every
+// channel if empty), oldest first when oldestFirst is set (dispatch order)
+// and newest first otherwise.
+func (s *NotificationStore) Pending(ctx context.Context, channelType string, limit int, oldestFirst bool) ([]PendingNotification, error) {
+	order := "DESC"
+	if oldestFirst {
+		order = "ASC"
+	}
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT
+			n.id,
+			n.user_id,
+			u.discord_id,
+			n.line_id,
+			n.channel_type,
+			a.old_status,
+			a.new_status,
+			a.header,
+			a.body,
+			a.effect,
+			n.created_at
+		FROM notifications n
+		JOIN users u ON u.id = n.user_id
+		JOIN alerts a ON a.id = n.alert_id
+		WHERE n.status = 'pending' AND (? = '' OR n.channel_type = ?)
+		ORDER BY n.id `+order+`
+		LIMIT ?
+	`, channelType, channelType, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]PendingNotification, 0)
+	for rows.Next() {
+		var n PendingNotification
+		var oldStatus, newStatus, header, body, effect sql.NullString
+		var created sqlTime
+
+		if err := rows.Scan(&n.ID, &n.UserID, &n.DiscordID, &n.LineID, &n.ChannelType, &oldStatus, &newStatus, &header, &body, &effect, &created); err != nil {
+			return nil, err
+		}
+
+		n.OldStatus = nullString(oldStatus)
+		n.NewStatus = nullString(newStatus)
+		n.Header = nullString(header)
+		n.Body = nullString(body)
+		n.Effect = nullString(effect)
+		n.CreatedAt = created.Time
+
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// MarkSent records a delivery. externalID is the provider's id for the sent
+// message, if it has one.
+func (s *NotificationStore) MarkSent(ctx context.Context, id int64, externalID string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE notifications
+		SET status='sent', sent_at=?, last_error=NULL, external_id=?
+		WHERE id=?
+	`, at, nullIfEmpty(&externalID), id)
+	return err
+}
+
+func (s *NotificationStore) MarkFailed(ctx context.Context, id int64, msg string) error {
+	msg = strings.TrimSpace(msg)
+	if len(msg) > 400 {
+		msg = msg[:400]
+	}
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE notifications
+		SET status='failed', last_error=?, sent_at=NULL
+		WHERE id=?
+	`, msg, id)
+	return err
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotificationStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		at := day(2025, 5, 1, 9*time.Hour)
+
+		// dm follows A by DM; all follows every line on every channel but
+		// only has Slack configured; mail has an unverified address;
+		// verified has a verified one.
+		dm := createUser(t, d, "1")
+		all := createUser(t, d, "2")
+		mail := createUser(t, d, "3")
+		verified := createUser(t, d, "4")
+
+		mustReplace := func(u User, lines []string, via Channels) {
+			t.Helper()
+			if err := d.Subscriptions().ReplaceForUser(ctx, u.ID, lines, via); err != nil {
+				t.Fatal(err)
+			}
+		}
+		mustReplace(dm, []string{"A", "C"}, Channels{DM: true})
+		mustReplace(all, []string{"ALL"}, Channels{DM: true, Slack: true, Email: true, Push: true})
+		mustReplace(mail, []string{"A"}, Channels{Email: true})
+		mustReplace(verified, []string{"A"}, Channels{Email: true})
+
+		hook := "https://hooks.slack.com/services/T/B/X"
+		if err := d.SlackDestinations().Upsert(ctx, SlackDestination{UserID: all.ID, WebhookURL: &hook}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Users().SetEmail(ctx, mail.ID, "mail@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		token, err := d.Users().SetEmail(ctx, verified.ID, "verified@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Users().VerifyEmail(ctx, token, at); err != nil {
+			t.Fatal(err)
+		}
+
+		alertA := insertAlert(t, d, "A", "", "Delays", "SIGNIFICANT_DELAYS", "Delays", at)
+		alertF := insertAlert(t, d, "F", "", "No Service", "NO_SERVICE", "No F", at)
+		if err := d.Notifications().EnqueueForLine(ctx, alertA, "A", at); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Notifications().EnqueueForLine(ctx, alertF, "F", at.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		pending, err := d.Notifications().Pending(ctx, "", 50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(pending))
+		for _, n := range pending {
+			got = append(got, n.LineID+":"+n.DiscordID+":"+n.ChannelType)
+		}
+		sort.Strings(got)
+		want := []string{"A:1:dm", "A:2:dm", "A:2:slack", "A:4:email", "F:2:dm", "F:2:slack"}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("queued %v, want %v", got, want)
+		}
+		for i := 1; i < len(pending); i++ {
+			if pending[i].ID < pending[i-1].ID {
+				t.Fatalf("oldestFirst returned ids out of order")
+			}
+		}
+
+		slack, _ := d.Notifications().Pending(ctx, ChannelSlack, 50, false)
+		if len(slack) != 2 || slack[0].LineID != "F" || slack[1].LineID != "A" {
+			t.Fatalf("newest-first slack queue = %+v", slack)
+		}
+		if deref(slack[0].Effect) != "NO_SERVICE" || deref(slack[0].NewStatus) != "No Service" {
+			t.Errorf("pending row not joined with its alert: %+v", slack[0])
+		}
+
+		if err := d.Notifications().MarkSent(ctx, slack[0].ID, "ts-1", at); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Notifications().MarkFailed(ctx, slack[1].ID, strings.Repeat("x", 500)); err != nil {
+			t.Fatal(err)
+		}
+		if rest, _ := d.Notifications().Pending(ctx, ChannelSlack, 50, true); len(rest) != 0 {
+			t.Errorf("marked rows still pending: %+v", rest)
+		}
+
+		var status, externalID string
+		if err := d.QueryRow(`SELECT status, external_id FROM notifications WHERE id = ?`, slack[0].ID).Scan(&status, &externalID); err != nil {
+			t.Fatal(err)
+		}
+		if status != "sent" || externalID != "ts-1" {
+			t.Errorf("sent row = %s %s", status, externalID)
+		}
+		var lastError string
+		if err := d.QueryRow(`SELECT status, last_error FROM notifications WHERE id = ?`, slack[1].ID).Scan(&status, &lastError); err != nil {
+			t.Fatal(err)
+		}
+		if status != "failed" || len(lastError) != 400 {
+			t.Errorf("failed row = %s with %d-byte error", status, len(lastError))
+		}
+	})
+}
+
+// Subscriptions stored without a via_dm value, as every one was before the
+// other channels existed, still get DMs, and a user following a line both
+// directly and through ALL gets one DM, not two.
+func TestEnqueueDMs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		at := day(2025, 5, 1, 9*time.Hour)
+
+		legacy := createUser(t, d, "1")
+		both := createUser(t, d, "2")
+		off := createUser(t, d, "3")
+
+		if _, err := d.ExecContext(ctx, `INSERT INTO subscriptions (user_id, line_id) VALUES (?, 'A')`, legacy.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Subscriptions().ReplaceForUser(ctx, both.ID, []string{"A", "ALL"}, Channels{DM: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Subscriptions().ReplaceForUser(ctx, off.ID, []string{"A"}, Channels{Guild: true}); err != nil {
+			t.Fatal(err)
+		}
+		if subs, err := d.Subscriptions().ListForUser(ctx, legacy.ID); err != nil || len(subs) != 1 || !subs[0].ViaDM {
+			t.Fatalf("legacy subscription = %+v, %v; want via_dm set", subs, err)
+		}
+
+		alert := insertAlert(t, d, "A", "", "Delays", "SIGNIFICANT_DELAYS", "Delays", at)
+		if err := d.Notifications().EnqueueForLine(ctx, alert, "A", at); err != nil {
+			t.Fatal(err)
+		}
+
+		pending, err := d.Notifications().Pending(ctx, ChannelDM, 50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(pending))
+		for _, n := range pending {
+			got = append(got, n.DiscordID)
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != "1 2" {
+			t.Errorf("DMs queued for %v, want [1 2]", got)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PlannedWork is one active period of a planned service change on a line.
+type PlannedWork struct {
+	ID          int64      `json:"id"`
+	AlertID     string     `json:"alert_id"`
+	LineID      string     `json:"line_id"`
+	Effect      *string    `json:"effect,omitempty"`
+	Header      *string    `json:"header,omitempty"`
+	Body        *string    `json:"body,omitempty"`
+	StartsAt    time.Time  `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+
+	// RefreshOnly marks a period of an ordinary alert that has already
+	// started. Sync keeps such a period going if it was recorded while
+	// still upcoming but never adds it.
+	RefreshOnly bool `json:"-"`
+}
+
+type PlannedWorkStore struct {
+	q Querier
+}
+
+func (d *DB) PlannedWork() *PlannedWorkStore { return &PlannedWorkStore{q: d} }
+func (t *Tx) PlannedWork() *PlannedWorkStore { return &PlannedWorkStore{q: t} }
+
+// How long finished planned work stays around for calendar clients.
+const plannedWorkKeep = 30 * 24 * time.Hour
+
+const plannedWorkColumns = `id, alert_id, line_id, effect, header, body, starts_at, ends_at, first_seen_at, last_seen_at`
+
+// Sync records the planned work seen in one poll. When complete is true the
+// poll covered every feed, so anything not seen is treated as withdrawn:
+// future periods are dropped and running ones end at their last sighting,
+// or at their start if they were never seen running.
+func (s *PlannedWorkStore) Sync(ctx context.Context, items []PlannedWork, complete bool, now time.Time) error {
+	for _, pw := range items {
+		if pw.RefreshOnly {
+			if _, err := s.q.ExecContext(ctx, `
+				UPDATE planned_work SET effect = ?, header = ?, body = ?, ends_at = ?, last_seen_at = ?
+				WHERE alert_id = ? AND line_id = ? AND starts_at = ?
+			`, nullIfEmpty(pw.Effect), nullIfEmpty(pw.Header), nullIfEmpty(pw.Body), pw.EndsAt, now,
+				pw.AlertID, pw.LineID, pw.StartsAt); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO planned_work (alert_id, line_id, effect, header, body, starts_at, ends_at, first_seen_at, last_seen_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(alert_id, line_id, starts_at) DO UPDATE SET
+				effect       = excluded.effect,
+				header       = excluded.header,
+				body         = excluded.body,
+				ends_at      = excluded.ends_at,
+				last_seen_at = excluded.last_seen_at
+		`, pw.AlertID, pw.LineID, nullIfEmpty(pw.Effect), nullIfEmpty(pw.Header), nullIfEmpty(pw.Body),
+			pw.StartsAt, pw.EndsAt, now, now); err != nil {
+			return err
+		}
+	}
+
+	if !complete {
+		return nil
+	}
+
+	if _, err := s.q.ExecContext(ctx, `
+		DELETE FROM planned_work
+		WHERE last_seen_at < ? AND starts_at > ?
+	`, now, now); err != nil {
+		return err
+	}
+
+	if _, err := s.q.ExecContext(ctx, `
+		UPDATE planned_work
+		SET ends_at = CASE WHEN last_seen_at > starts_at THEN last_seen_at ELSE starts_at END
+		WHERE last_seen_at < ? AND starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)
+	`, now, now, now); err != nil {
+		return err
+	}
+
+	_, err := s.q.ExecContext(ctx, `
+		DELETE FROM planned_work
+		WHERE ends_at IS NOT NULL AND ends_at < ?
+	`, now.Add(-plannedWorkKeep))
+	return err
+}
+
+// Overlapping returns planned work on lineIDs (every line if empty) that is
+// in effect at some point in [from, to), earliest first.
+func (s *PlannedWorkStore) Overlapping(ctx context.Context, lineIDs []string, from, to time.Time) ([]PlannedWork, error) {
+	query := `
+		SELECT ` + plannedWorkColumns + `
+		FROM planned_work
+		WHERE starts_at < ? AND (ends_at IS NULL OR ends_at > ?)`
+	args := []any{to, from}
+	if len(lineIDs) > 0 {
+		query += ` AND line_id IN (` + placeholders(len(lineIDs)) + `)`
+		for _, l := range lineIDs {
+			args = append(args, l)
+		}
+	}
+	query += ` ORDER BY starts_at, line_id, id`
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]PlannedWork, 0)
+	for rows.Next() {
+		var pw PlannedWork
+		var effect, header, body sql.NullString
+		var starts, ends, first, last sqlTime
+		if err := rows.Scan(&pw.ID, &pw.AlertID, &pw.LineID, &effect, &header, &body, &starts, &ends, &first, &last); err != nil {
+			return nil, err
+		}
+		pw.Effect = nullString(effect)
+		pw.Header = nullString(header)
+		pw.Body = nullString(body)
+		pw.StartsAt = starts.Time
+		pw.EndsAt = ends.ptr()
+		pw.FirstSeenAt = first.Time
+		pw.LastSeenAt = last.Time
+		out = append(out, pw)
+	}
+	return out, rows.Err()
+}
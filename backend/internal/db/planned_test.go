@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPlannedWorkStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		store := d.PlannedWork()
+		now := day(2025, 7, 10, 12*time.Hour)
+
+		end := now.Add(48 * time.Hour)
+		running := PlannedWork{AlertID: "pw1", LineID: "F", StartsAt: now.Add(-time.Hour), EndsAt: &end}
+		future := PlannedWork{AlertID: "pw2", LineID: "G", StartsAt: now.Add(72 * time.Hour)}
+		if err := store.Sync(ctx, []PlannedWork{running, future}, true, now); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Overlapping(ctx, nil, now, now.Add(7*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].AlertID != "pw1" || got[1].AlertID != "pw2" {
+			t.Fatalf("Overlapping = %+v", got)
+		}
+		if got, _ := store.Overlapping(ctx, []string{"G"}, now, now.Add(7*24*time.Hour)); len(got) != 1 || got[0].LineID != "G" {
+			t.Errorf("Overlapping G = %+v", got)
+		}
+
+		// An incomplete poll that saw nothing changes nothing.
+		later := now.Add(5 * time.Minute)
+		if err := store.Sync(ctx, nil, false, later); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := store.Overlapping(ctx, nil, later, later.Add(7*24*time.Hour)); len(got) != 2 {
+			t.Fatalf("incomplete poll withdrew planned work: %+v", got)
+		}
+
+		// A complete poll that saw nothing drops the future period and
+		// ends the running one at its last sighting.
+		if err := store.Sync(ctx, nil, true, later); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = store.Overlapping(ctx, nil, now.Add(-2*time.Hour), later.Add(7*24*time.Hour))
+		if len(got) != 1 || got[0].AlertID != "pw1" {
+			t.Fatalf("after withdrawal Overlapping = %+v", got)
+		}
+		if got[0].EndsAt == nil || !got[0].EndsAt.Equal(now) {
+			t.Errorf("withdrawn work ends at %v, want %v", got[0].EndsAt, now)
+		}
+
+		// A started period of an ordinary alert is refreshed if it was
+		// recorded while upcoming, and never added otherwise.
+		upcoming := PlannedWork{AlertID: "pw3", LineID: "A", StartsAt: later.Add(time.Hour)}
+		if err := store.Sync(ctx, []PlannedWork{upcoming}, true, later); err != nil {
+			t.Fatal(err)
+		}
+		started := later.Add(2 * time.Hour)
+		upcoming.RefreshOnly = true
+		unknown := PlannedWork{AlertID: "pw4", LineID: "C", StartsAt: later, RefreshOnly: true}
+		if err := store.Sync(ctx, []PlannedWork{upcoming, unknown}, true, started); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = store.Overlapping(ctx, []string{"A", "C"}, started, started.Add(time.Hour))
+		if len(got) != 1 || got[0].AlertID != "pw3" || got[0].EndsAt != nil || !got[0].LastSeenAt.Equal(started) {
+			t.Fatalf("after refresh Overlapping = %+v", got)
+		}
+
+		// Withdrawn work that was never seen running ends where it started,
+		// not before.
+		early := PlannedWork{AlertID: "pw5", LineID: "E", StartsAt: started.Add(time.Hour)}
+		if err := store.Sync(ctx, []PlannedWork{early}, true, started); err != nil {
+			t.Fatal(err)
+		}
+		gone := started.Add(3 * time.Hour)
+		if err := store.Sync(ctx, nil, true, gone); err != nil {
+			t.Fatal(err)
+		}
+		var ends sqlTime
+		if err := d.QueryRow(`SELECT ends_at FROM planned_work WHERE alert_id = 'pw5'`).Scan(&ends); err != nil {
+			t.Fatal(err)
+		}
+		if !ends.Valid || !ends.Time.Equal(early.StartsAt) {
+			t.Errorf("pw5 ends at %v, want %v", ends.Time, early.StartsAt)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Kinds of push destination.
+const (
+	PushNtfy = "ntfy"
+	PushHTTP = "http"
+)
+
+// PushDestination is where a user's push notifications are POSTed. Token,
+// when set, is sent as a bearer token and never serialised.
+type PushDestination struct {
+	UserID    int64     `json:"-"`
+	Kind      string    `json:"kind"`
+	URL       string    `json:"url"`
+	Token     *string   `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PushDestinationStore struct {
+	q Querier
+}
+
+func (d *DB) PushDestinations() *PushDestinationStore { return &PushDestinationStore{q: d} }
+func (t *Tx) PushDestinations() *PushDestinationStore { return &PushDestinationStore{q: t} }
+
+func (s *PushDestinationStore) Get(ctx context.Context, userID int64) (PushDestination, error) {
+	var d PushDestination
+	var token sql.NullString
+	var created, updated sqlTime
+	err := s.q.QueryRowContext(ctx, `
+		SELECT user_id, kind, url, token, created_at, updated_at
+		FROM push_destinations
+		WHERE user_id = ?
+	`, userID).Scan(&d.UserID, &d.Kind, &d.URL, &token, &created, &updated)
+	if err == sql.ErrNoRows {
+		return PushDestination{}, ErrNotFound
+	}
+	if err != nil {
+		return PushDestination{}, err
+	}
+	d.Token = nullString(token)
+	d.CreatedAt = created.Time
+	d.UpdatedAt = updated.Time
+	return d, nil
+}
+
+// Upsert sets the user's push destination, replacing any previous one.
+func (s *PushDestinationStore) Upsert(ctx context.Context, d PushDestination) error {
+	now := time.Now()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO push_destinations (user_id, kind, url, token, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			kind       = excluded.kind,
+			url        = excluded.url,
+			token      = excluded.token,
+			updated_at = excluded.updated_at
+	`, d.UserID, d.Kind, d.URL, nullIfEmpty(d.Token), now, now)
+	return err
+}
+
+func (s *PushDestinationStore) Delete(ctx context.Context, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM push_destinations WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RetentionPolicy says how long each kind of row is kept. A zero duration
+// keeps rows forever.
+type RetentionPolicy struct {
+	// The notification windows also apply to webhook and guild deliveries;
+	// resolved guild threads are forgotten after SentNotifications.
+	SentNotifications   time.Duration
+	FailedNotifications time.Duration
+	// Alerts older than this are folded into alert_daily_rollups and
+	// deleted, along with any sent or failed notifications for them.
+	Alerts time.Duration
+}
+
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		SentNotifications:   30 * 24 * time.Hour,
+		FailedNotifications: 30 * 24 * time.Hour,
+		Alerts:              365 * 24 * time.Hour,
+	}
+}
+
+type PruneReport struct {
+	DryRun              bool
+	SentNotifications   int64
+	FailedNotifications int64
+	WebhookDeliveries   int64
+	GuildDeliveries     int64
+	GuildThreads        int64
+	RollupRows          int64
+	Alerts              int64
+}
+
+func (r PruneReport) String() string {
+	verb := "deleted"
+	if r.DryRun {
+		verb = "would delete"
+	}
+	return fmt.Sprintf("%s %d sent notifications, %d failed notifications, %d webhook deliveries, %d guild deliveries, %d resolved guild threads, %d alerts (%d daily rollup rows)",
+		verb, r.SentNotifications, r.FailedNotifications, r.WebhookDeliveries, r.GuildDeliveries, r.GuildThreads, r.Alerts, r.RollupRows)
+}
+
+// Alerts that still have a pending notification, webhook or guild delivery
+// are never pruned, so senders can always resolve what they are about to send.
+const prunableAlert = `
+	created_at < ?
+	AND NOT EXISTS (
+		SELECT 1 FROM notifications n
+		WHERE n.alert_id = alerts.id AND n.status = 'pending'
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM webhook_deliveries d
+		WHERE d.alert_id = alerts.id AND d.status = 'pending'
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM guild_deliveries g
+		WHERE g.alert_id = alerts.id AND g.status = 'pending'
+	)`
+
+// Prune applies policy relative to now. With dryRun set it only counts what
+// would be removed.
+func (d *DB) Prune(ctx context.Context, policy RetentionPolicy, now time.Time, dryRun bool) (PruneReport, error) {
+	report := PruneReport{DryRun: dryRun}
+
+	err := d.WithTx(ctx, func(tx *Tx) error {
+		var err error
+
+		if policy.SentNotifications > 0 {
+			report.SentNotifications, err = pruneRows(ctx, tx, dryRun, "notifications",
+				`status = 'sent' AND created_at < ?`, now.Add(-policy.SentNotifications))
+			if err != nil {
+				return err
+			}
+		}
+
+		if policy.FailedNotifications > 0 {
+			report.FailedNotifications, err = pruneRows(ctx, tx, dryRun, "notifications",
+				`status = 'failed' AND created_at < ?`, now.Add(-policy.FailedNotifications))
+			if err != nil {
+				return err
+			}
+		}
+
+		for status, keep := range map[string]time.Duration{"sent": policy.SentNotifications, "failed": policy.FailedNotifications} {
+			if keep <= 0 {
+				continue
+			}
+			n, err := pruneRows(ctx, tx, dryRun, "webhook_deliveries",
+				`status = ? AND created_at < ?`, status, now.Add(-keep))
+			if err != nil {
+				return err
+			}
+			report.WebhookDeliveries += n
+
+			n, err = pruneRows(ctx, tx, dryRun, "guild_deliveries",
+				`status = ? AND created_at < ?`, status, now.Add(-keep))
+			if err != nil {
+				return err
+			}
+			report.GuildDeliveries += n
+		}
+
+		if policy.SentNotifications > 0 {
+			report.GuildThreads, err = pruneRows(ctx, tx, dryRun, "guild_alert_threads",
+				`resolved_at < ?`, now.Add(-policy.SentNotifications))
+			if err != nil {
+				return err
+			}
+		}
+
+		if policy.Alerts > 0 {
+			cutoff := now.Add(-policy.Alerts)
+
+			report.RollupRows, err = rollupAlerts(ctx, tx, dryRun, cutoff)
+			if err != nil {
+				return err
+			}
+
+			report.Alerts, err = pruneRows(ctx, tx, dryRun, "alerts", prunableAlert, cutoff)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return report, err
+}
+
+func pruneRows(ctx context.Context, tx *Tx, dryRun bool, table, where string, args ...any) (int64, error) {
+	if dryRun {
+		var n int64
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(&n)
+		return n, err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// rollupAlerts adds per-day counts for alerts about to be pruned to
+// alert_daily_rollups and returns how many (day, line, status, effect)
+// groups were touched.
+func rollupAlerts(ctx context.Context, tx *Tx, dryRun bool, cutoff time.Time) (int64, error) {
+	day := tx.Dialect.dayExpr("created_at")
+	groups := `
+		SELECT ` + day + ` AS day, line_id, COALESCE(new_status, '') AS new_status, COALESCE(effect, '') AS effect, COUNT(*) AS alerts
+		FROM alerts
+		WHERE ` + prunableAlert + `
+		GROUP BY 1, 2, 3, 4`
+
+	if dryRun {
+		var n int64
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+groups+`) g`, cutoff).Scan(&n)
+		return n, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO alert_daily_rollups (day, line_id, new_status, effect, alerts)
+		`+groups+`
+		ON CONFLICT (day, line_id, new_status, effect) DO UPDATE SET
+			alerts = alert_daily_rollups.alerts + excluded.alerts
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+type VacuumMode string
+
+const (
+	VacuumNone        VacuumMode = "none"
+	VacuumIncremental VacuumMode = "incremental"
+	VacuumFull        VacuumMode = "full"
+)
+
+// ErrNotIncremental is returned by an incremental Vacuum of a SQLite file
+// created before incremental auto-vacuum was the default. A full Vacuum
+// converts it.
+var ErrNotIncremental = errors.New("db: SQLite file is not in incremental auto-vacuum mode; convert it once with `nyctcord prune -vacuum full`")
+
+// Vacuum reclaims space freed by Prune.
+//
+// On SQLite an incremental vacuum only returns free pages, and only works
+// on a file in incremental auto-vacuum mode, which new databases are. A
+// full vacuum rewrites the file, switching it to incremental mode if it
+// wasn't, and holds the write lock throughout, so the other processes
+// stall while it runs.
+func (d *DB) Vacuum(ctx context.Context, mode VacuumMode) error {
+	var stmts []string
+
+	switch {
+	case mode == VacuumNone || mode == "":
+		return nil
+	case d.Dialect == SQLite && (mode == VacuumFull || mode == VacuumIncremental):
+		// The statements depend on the file's mode; see sqliteVacuum.
+	case d.Dialect == Postgres && mode == VacuumFull:
+		stmts = []string{`VACUUM FULL ANALYZE alerts, notifications`}
+	case d.Dialect == Postgres && mode == VacuumIncremental:
+		stmts = []string{`VACUUM ANALYZE alerts, notifications`}
+	default:
+		return fmt.Errorf("unknown vacuum mode %q", mode)
+	}
+
+	if d.Dialect == SQLite {
+		d.writeMu.Lock()
+		defer d.writeMu.Unlock()
+	}
+
+	// VACUUM can't run inside a transaction, and on SQLite the pragma and
+	// VACUUM have to share a connection.
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if d.Dialect == SQLite {
+		stmts, err = sqliteVacuum(ctx, conn, mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range stmts {
+		if d.Dialect == SQLite {
+			err = drain(ctx, conn, stmt)
+		} else {
+			_, err = conn.ExecContext(ctx, stmt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drain runs stmt and reads every row it returns. PRAGMA incremental_vacuum
+// frees a page per row stepped, so Exec, which steps once, would free just
+// one.
+func drain(ctx context.Context, conn *sql.Conn, stmt string) error {
+	rows, err := conn.QueryContext(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// autoVacuumIncremental is PRAGMA auto_vacuum's value for INCREMENTAL.
+const autoVacuumIncremental = 2
+
+func sqliteVacuum(ctx context.Context, conn *sql.Conn, mode VacuumMode) ([]string, error) {
+	var current int
+	if err := conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&current); err != nil {
+		return nil, err
+	}
+	switch {
+	case mode == VacuumFull && current != autoVacuumIncremental:
+		log.Printf("db: switching to incremental auto-vacuum")
+		return []string{`PRAGMA auto_vacuum = INCREMENTAL`, `VACUUM`}, nil
+	case mode == VacuumFull:
+		return []string{`VACUUM`}, nil
+	case current != autoVacuumIncremental:
+		return nil, ErrNotIncremental
+	default:
+		return []string{`PRAGMA incremental_vacuum`}, nil
+	}
+}
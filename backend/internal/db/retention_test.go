@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pragma(t *testing.T, d *DB, name string) int {
+	t.Helper()
+	var v int
+	if err := d.QueryRowContext(context.Background(), `PRAGMA `+name).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// churn inserts and deletes enough alerts to leave free pages behind.
+func churn(t *testing.T, d *DB) {
+	t.Helper()
+	ctx := context.Background()
+	at := day(2025, 5, 1, 0)
+	body := strings.Repeat("delays ", 500)
+	for i := range 200 {
+		insertAlert(t, d, "F", "", "Delays", "SIGNIFICANT_DELAYS", body, at.Add(time.Duration(i)*time.Minute))
+	}
+	if _, err := d.ExecContext(ctx, `DELETE FROM alerts`); err != nil {
+		t.Fatal(err)
+	}
+	if n := pragma(t, d, "freelist_count"); n == 0 {
+		t.Fatal("deleting alerts freed no pages")
+	}
+}
+
+func TestVacuumSQLite(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("new database", func(t *testing.T) {
+		d, err := Open(filepath.Join(t.TempDir(), "new.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+
+		if got := pragma(t, d, "auto_vacuum"); got != autoVacuumIncremental {
+			t.Fatalf("auto_vacuum = %d on a new database, want incremental", got)
+		}
+		churn(t, d)
+		if err := d.Vacuum(ctx, VacuumIncremental); err != nil {
+			t.Fatal(err)
+		}
+		if n := pragma(t, d, "freelist_count"); n != 0 {
+			t.Errorf("%d free pages left after an incremental vacuum", n)
+		}
+	})
+
+	t.Run("existing database", func(t *testing.T) {
+		// Created the way databases were before incremental auto-vacuum
+		// was a default.
+		path := filepath.Join(t.TempDir(), "old.db")
+		d, err := Open(path + "?_auto_vacuum=none")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		if got := pragma(t, d, "auto_vacuum"); got != 0 {
+			t.Fatalf("auto_vacuum = %d, want none", got)
+		}
+		churn(t, d)
+
+		// An incremental run leaves the file alone and says why.
+		if err := d.Vacuum(ctx, VacuumIncremental); !errors.Is(err, ErrNotIncremental) {
+			t.Fatalf("incremental Vacuum = %v, want ErrNotIncremental", err)
+		}
+		if got := pragma(t, d, "auto_vacuum"); got != 0 {
+			t.Fatalf("auto_vacuum = %d after an incremental Vacuum, want none", got)
+		}
+
+		// A full run converts the file.
+		if err := d.Vacuum(ctx, VacuumFull); err != nil {
+			t.Fatal(err)
+		}
+		if got := pragma(t, d, "auto_vacuum"); got != autoVacuumIncremental {
+			t.Fatalf("auto_vacuum = %d after Vacuum, want incremental", got)
+		}
+		if n := pragma(t, d, "freelist_count"); n != 0 {
+			t.Errorf("%d free pages left after the conversion", n)
+		}
+
+		// Later runs are incremental and still reclaim space.
+		churn(t, d)
+		if err := d.Vacuum(ctx, VacuumIncremental); err != nil {
+			t.Fatal(err)
+		}
+		if n := pragma(t, d, "freelist_count"); n != 0 {
+			t.Errorf("%d free pages left after an incremental vacuum", n)
+		}
+	})
+
+	t.Run("modes", func(t *testing.T) {
+		d := openSQLite(t)
+		for _, mode := range []VacuumMode{VacuumNone, "", VacuumFull, VacuumIncremental} {
+			if err := d.Vacuum(ctx, mode); err != nil {
+				t.Errorf("Vacuum(%q) = %v", mode, err)
+			}
+		}
+		if err := d.Vacuum(ctx, "sometimes"); err == nil {
+			t.Error("unknown mode accepted")
+		}
+	})
+}
+
+func TestPrune(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		now := day(2025, 7, 1, 12*time.Hour)
+		ago := func(days int) time.Time { return now.Add(-time.Duration(days) * 24 * time.Hour) }
+		exec := func(query string, args ...any) {
+			t.Helper()
+			if _, err := d.ExecContext(ctx, query, args...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		count := func(table string) int {
+			t.Helper()
+			var n int
+			if err := d.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+
+		u, err := d.Users().Upsert(ctx, "1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hook, err := d.Webhooks().Create(ctx, u.ID, "https://example.com/hook", []string{"ALL"}, ago(500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Guilds().SetChannel(ctx, GuildChannel{GuildID: "g", ChannelID: "c", AllLines: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Two old alerts go; an old one with a pending notification and a
+		// recent one stay.
+		oldA := insertAlert(t, d, "F", "Good Service", "Delays", "SIGNIFICANT_DELAYS", "old", ago(400))
+		insertAlert(t, d, "F", "Good Service", "Delays", "SIGNIFICANT_DELAYS", "old", ago(400).Add(time.Hour))
+		oldPending := insertAlert(t, d, "F", "Delays", "No Service", "NO_SERVICE", "old", ago(400))
+		recent := insertAlert(t, d, "G", "Good Service", "Delays", "SIGNIFICANT_DELAYS", "recent", ago(10))
+
+		notify := func(alertID int64, status string, at time.Time) {
+			exec(`INSERT INTO notifications (user_id, alert_id, line_id, channel_type, status, created_at) VALUES (?, ?, 'F', 'dm', ?, ?)`,
+				u.ID, alertID, status, at)
+		}
+		notify(oldA, "sent", ago(400))
+		notify(recent, "sent", ago(40))
+		notify(recent, "sent", ago(20))
+		notify(recent, "failed", ago(10))
+		notify(recent, "failed", ago(5))
+		notify(oldPending, "pending", ago(400))
+
+		webhookDelivery := func(status string, at time.Time) {
+			exec(`INSERT INTO webhook_deliveries (webhook_id, alert_id, status, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+				hook.ID, recent, status, at, at)
+		}
+		webhookDelivery("sent", ago(40))
+		webhookDelivery("sent", ago(20))
+		webhookDelivery("failed", ago(10))
+		webhookDelivery("pending", ago(40))
+
+		guildDelivery := func(status string, at time.Time) {
+			exec(`INSERT INTO guild_deliveries (guild_id, alert_id, line_id, status, created_at) VALUES ('g', ?, 'G', ?, ?)`,
+				recent, status, at)
+		}
+		guildDelivery("sent", ago(40))
+		guildDelivery("failed", ago(5))
+		guildDelivery("pending", ago(40))
+
+		for _, th := range []struct {
+			alert    string
+			resolved *time.Time
+		}{
+			{"MTA:1", ptrTime(ago(40))},
+			{"MTA:2", ptrTime(ago(20))},
+			{"MTA:3", nil},
+		} {
+			if err := d.Guilds().AddThread(ctx, "g", th.alert, "G", "t-"+th.alert, ago(60)); err != nil {
+				t.Fatal(err)
+			}
+			if th.resolved != nil {
+				exec(`UPDATE guild_alert_threads SET resolved_at = ? WHERE alert_id = ?`, *th.resolved, th.alert)
+			}
+		}
+
+		policy := RetentionPolicy{
+			SentNotifications:   30 * 24 * time.Hour,
+			FailedNotifications: 7 * 24 * time.Hour,
+			Alerts:              365 * 24 * time.Hour,
+		}
+		want := PruneReport{
+			SentNotifications:   2,
+			FailedNotifications: 1,
+			WebhookDeliveries:   2,
+			GuildDeliveries:     1,
+			GuildThreads:        1,
+			RollupRows:          1,
+			Alerts:              2,
+		}
+		tables := map[string]int{
+			"alerts": 4, "notifications": 6, "webhook_deliveries": 4,
+			"guild_deliveries": 3, "guild_alert_threads": 3, "alert_daily_rollups": 0,
+		}
+		checkTables := func(when string) {
+			t.Helper()
+			for table, n := range tables {
+				if got := count(table); got != n {
+					t.Errorf("%s: %s has %d rows, want %d", when, table, got, n)
+				}
+			}
+		}
+
+		dry := want
+		dry.DryRun = true
+		if got, err := d.Prune(ctx, policy, now, true); err != nil || got != dry {
+			t.Fatalf("dry run = %+v, %v; want %+v", got, err, dry)
+		}
+		checkTables("after dry run")
+
+		if got, err := d.Prune(ctx, policy, now, false); err != nil || got != want {
+			t.Fatalf("Prune = %+v, %v; want %+v", got, err, want)
+		}
+		tables = map[string]int{
+			"alerts": 2, "notifications": 3, "webhook_deliveries": 2,
+			"guild_deliveries": 2, "guild_alert_threads": 2, "alert_daily_rollups": 1,
+		}
+		checkTables("after prune")
+
+		// Both pruned alerts were counted in the same rollup row.
+		var rolled int
+		if err := d.QueryRowContext(ctx, `SELECT alerts FROM alert_daily_rollups WHERE line_id = 'F'`).Scan(&rolled); err != nil {
+			t.Fatal(err)
+		}
+		if rolled != 2 {
+			t.Errorf("rollup counts %d alerts, want 2", rolled)
+		}
+		if _, err := d.Alerts().Get(ctx, oldPending); err != nil {
+			t.Errorf("alert with a pending notification was pruned: %v", err)
+		}
+
+		// Pruning again finds nothing, and a zero policy keeps everything.
+		if got, err := d.Prune(ctx, policy, now, false); err != nil || got != (PruneReport{}) {
+			t.Errorf("second Prune = %+v, %v", got, err)
+		}
+		if got, err := d.Prune(ctx, RetentionPolicy{}, now.AddDate(10, 0, 0), false); err != nil || got != (PruneReport{}) {
+			t.Errorf("Prune with a zero policy = %+v, %v", got, err)
+		}
+		checkTables("after zero policy")
+	})
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is an alert matching a full-text query. Snippet is an
+// excerpt with matched terms wrapped in ** so it renders as bold in Discord
+// and Markdown.
+type SearchResult struct {
+	Alert
+	Snippet string `json:"snippet"`
+}
+
+// Search runs a full-text query over alert headers and bodies, best match
+// first (bm25 on SQLite, ts_rank on PostgreSQL) with ties broken newest
+// first. Words are ANDed together; a trailing * does a prefix match.
+func (s *AlertStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	var sqlText string
+	var args []any
+
+	if s.dialect == Postgres {
+		sqlText = `
+			SELECT ` + prefixed("a", alertColumns) + `,
+				ts_headline('english', coalesce(a.header, '') || ' ' || coalesce(a.body, ''),
+					websearch_to_tsquery('english', ?),
+					'StartSel=**, StopSel=**, MaxWords=24, MinWords=8, MaxFragments=1')
+			FROM alerts a
+			WHERE a.search @@ websearch_to_tsquery('english', ?)
+			ORDER BY ts_rank(a.search, websearch_to_tsquery('english', ?)) DESC, a.id DESC
+			LIMIT ?`
+		args = []any{query, query, query, limit}
+	} else {
+		match := ftsMatch(query)
+		if match == "" {
+			return []SearchResult{}, nil
+		}
+		// Header matches weigh double: they name the line and the problem.
+		sqlText = `
+			SELECT ` + prefixed("a", alertColumns) + `,
+				snippet(alerts_fts, '**', '**', '…', -1, 16)
+			FROM alerts_fts
+			JOIN alerts a ON a.id = alerts_fts.docid
+			WHERE alerts_fts MATCH ?
+			ORDER BY bm25(matchinfo(alerts_fts, 'pcnalx'), 2.0, 1.0), a.id DESC
+			LIMIT ?`
+		args = []any{match, limit}
+	}
+
+	rows, err := s.q.QueryContext(ctx, sqlText, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SearchResult, 0)
+	for rows.Next() {
+		var r SearchResult
+		var snippet *string
+		a, err := scanAlert(scanFunc(func(dest ...any) error {
+			return rows.Scan(append(dest, &snippet)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		r.Alert = a
+		if snippet != nil {
+			r.Snippet = *snippet
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+type scanFunc func(dest ...any) error
+
+func (f scanFunc) Scan(dest ...any) error { return f(dest...) }
+
+func prefixed(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, p := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ftsMatch turns free text into an FTS MATCH expression of quoted terms so
+// punctuation in user input ("G-train", "Hoyt-Schermerhorn") can't be read
+// as query syntax.
+func ftsMatch(q string) string {
+	fields := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '*'
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		prefix := strings.HasSuffix(f, "*")
+		f = strings.ReplaceAll(f, "*", "")
+		if f == "" {
+			continue
+		}
+		if prefix {
+			f += "*"
+		}
+		terms = append(terms, `"`+f+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// bm25 scores an FTS4 row from matchinfo(alerts_fts, 'pcnalx'), which is
+// what FTS5's built-in bm25 computes but FTS4 lacks. Each column is scored
+// on its own and scaled by its weight (1 when not given). Like FTS5's, the
+// result is negative so better matches sort first in ascending order.
+// It is registered as a SQL function on every SQLite connection.
+func bm25(matchinfo []byte, weights ...float64) float64 {
+	const k1, b = 1.2, 0.75
+
+	info := make([]uint32, len(matchinfo)/4)
+	for i := range info {
+		info[i] = binary.NativeEndian.Uint32(matchinfo[i*4:])
+	}
+	if len(info) < 3 {
+		return 0
+	}
+	phrases, cols, rows := int(info[0]), int(info[1]), float64(info[2])
+	if len(info) < 3+2*cols {
+		return 0
+	}
+	avgLen := info[3 : 3+cols]
+	rowLen := info[3+cols : 3+2*cols]
+	hits := info[3+2*cols:]
+	if len(hits) < 3*phrases*cols {
+		return 0
+	}
+
+	score := 0.0
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < cols; c++ {
+			x := hits[3*(p*cols+c):]
+			tf, docs := float64(x[0]), float64(x[2])
+			if tf == 0 {
+				continue
+			}
+			weight := 1.0
+			if c < len(weights) {
+				weight = weights[c]
+			}
+			// Clamped like FTS5 so terms in most rows still count a little.
+			idf := math.Max(math.Log((rows-docs+0.5)/(docs+0.5)), 1e-6)
+			norm := 1 - b + b*float64(rowLen[c])/math.Max(float64(avgLen[c]), 1)
+			score += weight * idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return -score
+}
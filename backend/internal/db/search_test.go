@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFTSMatch(t *testing.T) {
+	tests := map[string]string{
+		"signal problems":     `"signal" "problems"`,
+		"Hoyt-Schermerhorn":   `"Hoyt" "Schermerhorn"`,
+		"sched*":              `"sched*"`,
+		`"quoted" OR NOT x)`:  `"quoted" "OR" "NOT" "x"`,
+		" *** ":               ``,
+		"59 St–Columbus Circ": `"59" "St" "Columbus" "Circ"`,
+	}
+	for in, want := range tests {
+		if got := ftsMatch(in); got != want {
+			t.Errorf("ftsMatch(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		at := day(2025, 8, 1, 0)
+
+		insert := func(line, header, body string, at time.Time) int64 {
+			t.Helper()
+			id, err := d.Alerts().Insert(ctx, Alert{LineID: line, Header: &header, Body: &body, CreatedAt: at})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+		inBody := insert("A", "Delays", "Trains are delayed because of signal problems at Jay St", at)
+		inHeader := insert("F", "Signal problems at Jay St", "Expect delays", at.Add(-time.Hour))
+		insert("G", "Good service", "", at.Add(time.Hour))
+
+		got, err := d.Alerts().Search(ctx, "signal problems", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("Search returned %d results, want 2: %+v", len(got), got)
+		}
+		// The header match ranks first even though it is older.
+		if got[0].ID != inHeader || got[1].ID != inBody {
+			t.Errorf("ranking = %d, %d; want %d, %d", got[0].ID, got[1].ID, inHeader, inBody)
+		}
+		if !strings.Contains(got[0].Snippet, "**") {
+			t.Errorf("snippet %q has no highlight", got[0].Snippet)
+		}
+
+		if got, _ := d.Alerts().Search(ctx, "sign*", 10); len(got) != 2 {
+			t.Errorf("prefix search returned %d results, want 2", len(got))
+		}
+
+		// The index follows updates and deletes on alerts.
+		if _, err := d.Exec(`UPDATE alerts SET header = 'Switch problems' WHERE id = ?`, inHeader); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Exec(`DELETE FROM alerts WHERE id = ?`, inBody); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := d.Alerts().Search(ctx, "signal", 10); len(got) != 0 {
+			t.Errorf("stale index: %+v", got)
+		}
+		if got, _ := d.Alerts().Search(ctx, "switch", 10); len(got) != 1 || got[0].ID != inHeader {
+			t.Errorf("updated row not found: %+v", got)
+		}
+	})
+}
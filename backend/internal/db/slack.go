@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SlackDestination is where a user's Slack notifications are posted. Exactly
+// one of WebhookURL or BotToken (with ChannelID) is set. Both are secrets
+// and never serialised.
+type SlackDestination struct {
+	UserID     int64     `json:"-"`
+	WebhookURL *string   `json:"-"`
+	BotToken   *string   `json:"-"`
+	ChannelID  *string   `json:"channel_id,omitempty"`
+	TeamID     *string   `json:"team_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type SlackDestinationStore struct {
+	q Querier
+}
+
+func (d *DB) SlackDestinations() *SlackDestinationStore { return &SlackDestinationStore{q: d} }
+func (t *Tx) SlackDestinations() *SlackDestinationStore { return &SlackDestinationStore{q: t} }
+
+func (s *SlackDestinationStore) Get(ctx context.Context, userID int64) (SlackDestination, error) {
+	var d SlackDestination
+	var webhookURL, botToken, channelID, teamID sql.NullString
+	var created, updated sqlTime
+	err := s.q.QueryRowContext(ctx, `
+		SELECT user_id, webhook_url, bot_token, channel_id, team_id, created_at, updated_at
+		FROM slack_destinations
+		WHERE user_id = ?
+	`, userID).Scan(&d.UserID, &webhookURL, &botToken, &channelID, &teamID, &created, &updated)
+	if err == sql.ErrNoRows {
+		return SlackDestination{}, ErrNotFound
+	}
+	if err != nil {
+		return SlackDestination{}, err
+	}
+	d.WebhookURL = nullString(webhookURL)
+	d.BotToken = nullString(botToken)
+	d.ChannelID = nullString(channelID)
+	d.TeamID = nullString(teamID)
+	d.CreatedAt = created.Time
+	d.UpdatedAt = updated.Time
+	return d, nil
+}
+
+// Upsert sets the user's Slack destination, replacing any previous one.
+func (s *SlackDestinationStore) Upsert(ctx context.Context, d SlackDestination) error {
+	now := time.Now()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO slack_destinations (user_id, webhook_url, bot_token, channel_id, team_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			webhook_url = excluded.webhook_url,
+			bot_token   = excluded.bot_token,
+			channel_id  = excluded.channel_id,
+			team_id     = excluded.team_id,
+			updated_at  = excluded.updated_at
+	`, d.UserID, nullIfEmpty(d.WebhookURL), nullIfEmpty(d.BotToken), nullIfEmpty(d.ChannelID), nullIfEmpty(d.TeamID), now, now)
+	return err
+}
+
+func (s *SlackDestinationStore) Delete(ctx context.Context, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `DELETE FROM slack_destinations WHERE user_id = ?`, userID)
+	return err
+}
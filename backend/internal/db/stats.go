@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DayLayout is the format of the day column in the rollup tables.
+const DayLayout = "2006-01-02"
+
+type DailyStatus struct {
+	Day     string
+	LineID  string
+	Status  string
+	Seconds int64
+}
+
+type DailyIncidents struct {
+	Day               string
+	LineID            string
+	Effect            string
+	Started           int64
+	Resolved          int64
+	ResolutionSeconds int64
+}
+
+type StatsStore struct {
+	q Querier
+}
+
+func (d *DB) Stats() *StatsStore { return &StatsStore{q: d} }
+func (t *Tx) Stats() *StatsStore { return &StatsStore{q: t} }
+
+// RolledUpDays returns which days in [fromDay, toDay] already have rollups.
+func (s *StatsStore) RolledUpDays(ctx context.Context, fromDay, toDay string) (map[string]bool, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT day FROM stats_rollup_days
+		WHERE day >= ? AND day <= ?
+	`, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		out[day] = true
+	}
+	return out, rows.Err()
+}
+
+// SaveDay stores the rollups for one day. It is a no-op if the day was
+// already saved, so concurrent callers can race safely inside WithTx.
+func (s *StatsStore) SaveDay(ctx context.Context, day string, statuses []DailyStatus, incidents []DailyIncidents, at time.Time) error {
+	var existing string
+	err := s.q.QueryRowContext(ctx, `SELECT day FROM stats_rollup_days WHERE day = ?`, day).Scan(&existing)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	for _, st := range statuses {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO line_status_daily (day, line_id, status, seconds)
+			VALUES (?, ?, ?, ?)
+		`, day, st.LineID, st.Status, st.Seconds); err != nil {
+			return err
+		}
+	}
+
+	for _, inc := range incidents {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO line_incident_daily (day, line_id, effect, started, resolved, resolution_seconds)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, day, inc.LineID, inc.Effect, inc.Started, inc.Resolved, inc.ResolutionSeconds); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO stats_rollup_days (day, computed_at) VALUES (?, ?)
+	`, day, at)
+	return err
+}
+
+// StatusDays returns per-day status seconds in [fromDay, toDay]. An empty
+// lineID means every line.
+func (s *StatsStore) StatusDays(ctx context.Context, lineID, fromDay, toDay string) ([]DailyStatus, error) {
+	query := `
+		SELECT day, line_id, status, seconds
+		FROM line_status_daily
+		WHERE day >= ? AND day <= ?`
+	args := []any{fromDay, toDay}
+	if lineID != "" {
+		query += ` AND line_id = ?`
+		args = append(args, lineID)
+	}
+	query += ` ORDER BY line_id, day, status`
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]DailyStatus, 0)
+	for rows.Next() {
+		var d DailyStatus
+		if err := rows.Scan(&d.Day, &d.LineID, &d.Status, &d.Seconds); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// IncidentDays returns per-day incident counts in [fromDay, toDay]. An
+// empty lineID means every line.
+func (s *StatsStore) IncidentDays(ctx context.Context, lineID, fromDay, toDay string) ([]DailyIncidents, error) {
+	query := `
+		SELECT day, line_id, effect, started, resolved, resolution_seconds
+		FROM line_incident_daily
+		WHERE day >= ? AND day <= ?`
+	args := []any{fromDay, toDay}
+	if lineID != "" {
+		query += ` AND line_id = ?`
+		args = append(args, lineID)
+	}
+	query += ` ORDER BY line_id, day, effect`
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]DailyIncidents, 0)
+	for rows.Next() {
+		var d DailyIncidents
+		if err := rows.Scan(&d.Day, &d.LineID, &d.Effect, &d.Started, &d.Resolved, &d.ResolutionSeconds); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
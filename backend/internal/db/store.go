@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Querier is the subset of *DB and *Tx the stores need, so every store
+// method can run either standalone or inside WithTx.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (d *DB) Lines() *LineStatusStore           { return &LineStatusStore{q: d} }
+func (d *DB) Alerts() *AlertStore               { return &AlertStore{q: d, dialect: d.Dialect} }
+func (d *DB) Subscriptions() *SubscriptionStore { return &SubscriptionStore{q: d} }
+func (d *DB) Notifications() *NotificationStore { return &NotificationStore{q: d} }
+func (d *DB) Users() *UserStore                 { return &UserStore{q: d} }
+func (t *Tx) Lines() *LineStatusStore           { return &LineStatusStore{q: t} }
+func (t *Tx) Alerts() *AlertStore               { return &AlertStore{q: t, dialect: t.Dialect} }
+func (t *Tx) Subscriptions() *SubscriptionStore { return &SubscriptionStore{q: t} }
+func (t *Tx) Notifications() *NotificationStore { return &NotificationStore{q: t} }
+func (t *Tx) Users() *UserStore                 { return &UserStore{q: t} }
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	TimeLayout,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// sqlTime scans a timestamp whether the driver returns a time.Time (Postgres,
+// or SQLite columns declared DATETIME) or plain text (SQLite expressions).
+// Results are always in UTC.
+type sqlTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *sqlTime) Scan(v any) error {
+	switch x := v.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = x.UTC(), true
+		return nil
+	case []byte:
+		return t.parse(string(x))
+	case string:
+		return t.parse(x)
+	default:
+		return fmt.Errorf("db: cannot scan %T into time", v)
+	}
+}
+
+func (t *sqlTime) parse(s string) error {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time, t.Valid = parsed.UTC(), true
+			return nil
+		}
+	}
+	return fmt.Errorf("db: unrecognised timestamp %q", s)
+}
+
+func (t sqlTime) ptr() *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	v := s.String
+	return &v
+}
+
+// nullIfEmpty stores blank strings as NULL.
+func nullIfEmpty(s *string) any {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil
+	}
+	return *s
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
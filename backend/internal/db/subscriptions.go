@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+type Subscription struct {
+	ID       int64     `json:"id"`
+	UserID   int64     `json:"-"`
+	LineID   string    `json:"line_id"`
+	ViaDM    bool      `json:"via_dm"`
+	ViaGuild bool      `json:"via_guild"`
+	ViaSlack bool      `json:"via_slack"`
+	ViaEmail bool      `json:"via_email"`
+	ViaPush  bool      `json:"via_push"`
+	Created  time.Time `json:"created_at"`
+}
+
+// Channels says where notifications for a subscription are delivered.
+type Channels struct {
+	DM    bool
+	Guild bool
+	Slack bool
+	Email bool
+	Push  bool
+}
+
+type SubscriptionStore struct {
+	q Querier
+}
+
+func (s *SubscriptionStore) ListForUser(ctx context.Context, userID int64) ([]Subscription, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, user_id, line_id, via_dm, via_guild, via_slack, via_email, via_push, created_at
+		FROM subscriptions
+		WHERE user_id = ?
+		ORDER BY line_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Subscription, 0)
+	for rows.Next() {
+		var sub Subscription
+		var viaDMInt, viaGuildInt, viaSlackInt, viaEmailInt, viaPushInt int
+		var created sqlTime
+
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.LineID, &viaDMInt, &viaGuildInt, &viaSlackInt, &viaEmailInt, &viaPushInt, &created); err != nil {
+			return nil, err
+		}
+
+		sub.ViaDM = viaDMInt == 1
+		sub.ViaGuild = viaGuildInt == 1
+		sub.ViaSlack = viaSlackInt == 1
+		sub.ViaEmail = viaEmailInt == 1
+		sub.ViaPush = viaPushInt == 1
+		sub.Created = created.Time
+
+		out = append(out, sub)
+	}
+	return out, rows.Err()
+}
+
+// ReplaceForUser swaps the user's subscriptions for lines. Run it inside
+// WithTx so readers never see the empty intermediate state.
+func (s *SubscriptionStore) ReplaceForUser(ctx context.Context, userID int64, lines []string, via Channels) error {
+	if _, err := s.q.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO subscriptions (user_id, line_id, via_dm, via_guild, via_slack, via_email, via_push)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, userID, line, boolInt(via.DM), boolInt(via.Guild), boolInt(via.Slack), boolInt(via.Email), boolInt(via.Push)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisableEmail turns off email delivery on all of the user's subscriptions,
+// which is what an unsubscribe link does.
+func (s *SubscriptionStore) DisableEmail(ctx context.Context, userID int64) error {
+	_, err := s.q.ExecContext(ctx, `UPDATE subscriptions SET via_email = 0 WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func createUser(t *testing.T, d *DB, discordID string) User {
+	t.Helper()
+	u, err := d.Users().Upsert(context.Background(), discordID, nil)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return u
+}
+
+func TestSubscriptionStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		alice := createUser(t, d, "100")
+		bob := createUser(t, d, "200")
+
+		err := d.WithTx(ctx, func(tx *Tx) error {
+			return tx.Subscriptions().ReplaceForUser(ctx, alice.ID, []string{"F", "A"}, Channels{DM: true, Email: true})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Subscriptions().ReplaceForUser(ctx, bob.ID, []string{"ALL"}, Channels{Slack: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		subs, err := d.Subscriptions().ListForUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subs) != 2 || subs[0].LineID != "A" || subs[1].LineID != "F" {
+			t.Fatalf("ListForUser = %+v, want A and F", subs)
+		}
+		for _, s := range subs {
+			if !s.ViaDM || !s.ViaEmail || s.ViaSlack || s.ViaGuild || s.ViaPush {
+				t.Errorf("subscription %s channels = %+v", s.LineID, s)
+			}
+		}
+
+		if err := d.Subscriptions().ReplaceForUser(ctx, alice.ID, []string{"G"}, Channels{Push: true, Email: true}); err != nil {
+			t.Fatal(err)
+		}
+		subs, _ = d.Subscriptions().ListForUser(ctx, alice.ID)
+		if len(subs) != 1 || subs[0].LineID != "G" || !subs[0].ViaPush || subs[0].ViaDM {
+			t.Errorf("after replace ListForUser = %+v", subs)
+		}
+
+		if err := d.Subscriptions().DisableEmail(ctx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		subs, _ = d.Subscriptions().ListForUser(ctx, alice.ID)
+		if subs[0].ViaEmail || !subs[0].ViaPush {
+			t.Errorf("DisableEmail left %+v", subs[0])
+		}
+
+		others, _ := d.Subscriptions().ListForUser(ctx, bob.ID)
+		if len(others) != 1 || others[0].LineID != "ALL" || !others[0].ViaSlack {
+			t.Errorf("other user's subscriptions changed: %+v", others)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"time"
+)
+
+type User struct {
+	ID              int64     `json:"id"`
+	DiscordID       string    `json:"discord_id"`
+	DiscordUsername *string   `json:"discord_username,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type UserStore struct {
+	q Querier
+}
+
+const userColumns = `id, discord_id, discord_username, created_at, updated_at`
+
+func scanUser(sc interface{ Scan(...any) error }) (User, error) {
+	var u User
+	var username sql.NullString
+	var created, updated sqlTime
+	if err := sc.Scan(&u.ID, &u.DiscordID, &username, &created, &updated); err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, ErrNotFound
+		}
+		return User{}, err
+	}
+	u.DiscordUsername = nullString(username)
+	u.CreatedAt = created.Time
+	u.UpdatedAt = updated.Time
+	return u, nil
+}
+
+func (s *UserStore) Get(ctx context.Context, id int64) (User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (s *UserStore) GetByDiscordID(ctx context.Context, discordID string) (User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE discord_id = ?`, discordID))
+}
+
+// Upsert creates the user on first sight and refreshes their username
+// afterwards.
+func (s *UserStore) Upsert(ctx context.Context, discordID string, username *string) (User, error) {
+	now := time.Now()
+	return scanUser(s.q.QueryRowContext(ctx, `
+		INSERT INTO users (discord_id, discord_username, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(discord_id) DO UPDATE SET
+			discord_username = excluded.discord_username,
+			updated_at       = excluded.updated_at
+		RETURNING `+userColumns+`
+	`, discordID, nullIfEmpty(username), now, now))
+}
+
+// NewToken returns a random URL-safe secret.
+func NewToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CalendarToken returns the user's calendar feed token, creating one if
+// they don't have one yet. rotate replaces any existing token, which
+// invalidates previously shared calendar URLs.
+func (s *UserStore) CalendarToken(ctx context.Context, userID int64, rotate bool) (string, error) {
+	if !rotate {
+		var token sql.NullString
+		err := s.q.QueryRowContext(ctx, `SELECT calendar_token FROM users WHERE id = ?`, userID).Scan(&token)
+		if err == sql.ErrNoRows {
+			return "", ErrNotFound
+		}
+		if err != nil {
+			return "", err
+		}
+		if token.Valid && token.String != "" {
+			return token.String, nil
+		}
+	}
+
+	token := NewToken()
+	res, err := s.q.ExecContext(ctx, `UPDATE users SET calendar_token = ?, updated_at = ? WHERE id = ?`, token, time.Now(), userID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (s *UserStore) GetByCalendarToken(ctx context.Context, token string) (User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE calendar_token = ?`, token))
+}
+
+// EmailStatus is the user's email address and whether it is verified.
+type EmailStatus struct {
+	Email      *string    `json:"email"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+}
+
+func (s *UserStore) EmailStatus(ctx context.Context, userID int64) (EmailStatus, error) {
+	var st EmailStatus
+	var email sql.NullString
+	var verified sqlTime
+	err := s.q.QueryRowContext(ctx, `SELECT email, email_verified_at FROM users WHERE id = ?`, userID).Scan(&email, &verified)
+	if err == sql.ErrNoRows {
+		return EmailStatus{}, ErrNotFound
+	}
+	if err != nil {
+		return EmailStatus{}, err
+	}
+	st.Email = nullString(email)
+	st.VerifiedAt = verified.ptr()
+	return st, nil
+}
+
+// VerifiedEmail returns the user's address, or ErrNotFound if they have
+// none or haven't verified it.
+func (s *UserStore) VerifiedEmail(ctx context.Context, userID int64) (string, error) {
+	st, err := s.EmailStatus(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if st.Email == nil || st.VerifiedAt == nil {
+		return "", ErrNotFound
+	}
+	return *st.Email, nil
+}
+
+// SetEmail stores an unverified address for the user and returns the token
+// that verifies it. An empty email clears the address.
+func (s *UserStore) SetEmail(ctx context.Context, userID int64, email string) (string, error) {
+	var token any
+	var tokenStr string
+	if email != "" {
+		tokenStr = NewToken()
+		token = tokenStr
+	}
+
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE users
+		SET email = ?, email_verified_at = NULL, email_verify_token = ?, updated_at = ?
+		WHERE id = ?
+	`, nullIfEmpty(&email), token, time.Now(), userID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrNotFound
+	}
+	return tokenStr, nil
+}
+
+// VerifyEmail marks the address holding token as verified and returns the
+// user's ID. Tokens are single use.
+func (s *UserStore) VerifyEmail(ctx context.Context, token string, at time.Time) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx, `
+		UPDATE users
+		SET email_verified_at = ?, email_verify_token = NULL, updated_at = ?
+		WHERE email_verify_token = ? AND email IS NOT NULL
+		RETURNING id
+	`, at, at, token).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUserStore(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, d *DB) {
+		ctx := context.Background()
+		store := d.Users()
+
+		name := "rider"
+		u, err := store.Upsert(ctx, "42", &name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renamed := "rider2"
+		again, err := store.Upsert(ctx, "42", &renamed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.ID != u.ID || deref(again.DiscordUsername) != "rider2" {
+			t.Errorf("second Upsert = %+v, want same user renamed", again)
+		}
+		if got, err := store.GetByDiscordID(ctx, "42"); err != nil || got.ID != u.ID {
+			t.Errorf("GetByDiscordID = %+v, %v", got, err)
+		}
+		if _, err := store.Get(ctx, u.ID+100); err != ErrNotFound {
+			t.Errorf("Get missing = %v, want ErrNotFound", err)
+		}
+
+		token, err := store.CalendarToken(ctx, u.ID, false)
+		if err != nil || token == "" {
+			t.Fatalf("CalendarToken = %q, %v", token, err)
+		}
+		if same, _ := store.CalendarToken(ctx, u.ID, false); same != token {
+			t.Errorf("CalendarToken changed without rotate")
+		}
+		rotated, _ := store.CalendarToken(ctx, u.ID, true)
+		if rotated == token {
+			t.Errorf("rotate kept the old token")
+		}
+		if _, err := store.GetByCalendarToken(ctx, token); err != ErrNotFound {
+			t.Errorf("old calendar token still resolves: %v", err)
+		}
+		if got, err := store.GetByCalendarToken(ctx, rotated); err != nil || got.ID != u.ID {
+			t.Errorf("GetByCalendarToken = %+v, %v", got, err)
+		}
+		if _, err := store.CalendarToken(ctx, u.ID+100, true); err != ErrNotFound {
+			t.Errorf("CalendarToken for missing user = %v", err)
+		}
+
+		verify, err := store.SetEmail(ctx, u.ID, "rider@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.VerifiedEmail(ctx, u.ID); err != ErrNotFound {
+			t.Errorf("unverified address returned by VerifiedEmail: %v", err)
+		}
+		at := day(2025, 2, 3, 4*time.Hour)
+		if id, err := store.VerifyEmail(ctx, verify, at); err != nil || id != u.ID {
+			t.Fatalf("VerifyEmail = %d, %v", id, err)
+		}
+		if _, err := store.VerifyEmail(ctx, verify, at); err != ErrNotFound {
+			t.Errorf("verify token reused: %v", err)
+		}
+		st, _ := store.EmailStatus(ctx, u.ID)
+		if deref(st.Email) != "rider@example.com" || st.VerifiedAt == nil || !st.VerifiedAt.Equal(at) {
+			t.Errorf("EmailStatus = %+v", st)
+		}
+
+		if _, err := store.SetEmail(ctx, u.ID, ""); err != nil {
+			t.Fatal(err)
+		}
+		if st, _ := store.EmailStatus(ctx, u.ID); st.Email != nil || st.VerifiedAt != nil {
+			t.Errorf("cleared address still set: %+v", st)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Webhook struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	URL    string `json:"url"`
+	// Secret is only filled in when the webhook is created; after that
+	// it is never sent back out.
+	Secret    string    `json:"secret,omitempty"`
+	Lines     []string  `json:"lines"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one queued or attempted POST of an alert to a webhook.
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	WebhookID     int64      `json:"webhook_id"`
+	AlertID       int64      `json:"alert_id"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	ResponseCode  *int       `json:"response_code,omitempty"`
+	LastError     *string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// PendingDelivery is a delivery that is due, joined with what the worker
+// needs to send it.
+type PendingDelivery struct {
+	ID       int64
+	Attempts int
+	URL      string
+	Secret   string
+	Alert    Alert
+}
+
+type WebhookStore struct {
+	q Querier
+}
+
+func (d *DB) Webhooks() *WebhookStore { return &WebhookStore{q: d} }
+func (t *Tx) Webhooks() *WebhookStore { return &WebhookStore{q: t} }
+
+// Create registers a webhook for lines with a fresh signing secret. Run it
+// inside WithTx so the webhook and its lines appear together.
+func (s *WebhookStore) Create(ctx context.Context, userID int64, url string, lines []string, at time.Time) (Webhook, error) {
+	w := Webhook{UserID: userID, URL: url, Secret: NewToken(), Lines: lines, Active: true, CreatedAt: at.UTC()}
+
+	err := s.q.QueryRowContext(ctx, `
+		INSERT INTO webhooks (user_id, url, secret, active, created_at)
+		VALUES (?, ?, ?, 1, ?)
+		RETURNING id
+	`, userID, url, w.Secret, at).Scan(&w.ID)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	for _, line := range lines {
+		if _, err := s.q.ExecContext(ctx, `
+			INSERT INTO webhook_lines (webhook_id, line_id) VALUES (?, ?)
+		`, w.ID, line); err != nil {
+			return Webhook{}, err
+		}
+	}
+	return w, nil
+}
+
+func (s *WebhookStore) ListForUser(ctx context.Context, userID int64) ([]Webhook, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT w.id, w.user_id, w.url, w.active, w.created_at, l.line_id
+		FROM webhooks w
+		LEFT JOIN webhook_lines l ON l.webhook_id = w.id
+		WHERE w.user_id = ?
+		ORDER BY w.id, l.line_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Webhook, 0)
+	for rows.Next() {
+		var w Webhook
+		var active int
+		var created sqlTime
+		var line sql.NullString
+		if err := rows.Scan(&w.ID, &w.UserID, &w.URL, &active, &created, &line); err != nil {
+			return nil, err
+		}
+
+		if n := len(out); n > 0 && out[n-1].ID == w.ID {
+			if line.Valid {
+				out[n-1].Lines = append(out[n-1].Lines, line.String)
+			}
+			continue
+		}
+
+		w.Active = active == 1
+		w.CreatedAt = created.Time
+		w.Lines = []string{}
+		if line.Valid {
+			w.Lines = append(w.Lines, line.String)
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// Owned reports whether webhook id exists and belongs to userID.
+func (s *WebhookStore) Owned(ctx context.Context, userID, id int64) (bool, error) {
+	var n int
+	err := s.q.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhooks WHERE id = ? AND user_id = ?`, id, userID).Scan(&n)
+	return n > 0, err
+}
+
+// Delete removes a webhook owned by userID along with its delivery log.
+func (s *WebhookStore) Delete(ctx context.Context, userID, id int64) error {
+	res, err := s.q.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EnqueueForLine queues a delivery of alertID to every active webhook
+// watching lineID or ALL.
+func (s *WebhookStore) EnqueueForLine(ctx context.Context, alertID int64, lineID string, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, alert_id, status, attempts, next_attempt_at, created_at)
+		SELECT DISTINCT w.id, ?, 'pending', 0, ?, ?
+		FROM webhooks w
+		JOIN webhook_lines l ON l.webhook_id = w.id
+		WHERE w.active = 1 AND (l.line_id = ? OR l.line_id = 'ALL')
+	`, alertID, at, at, lineID)
+	return err
+}
+
+// Due returns up to limit pending deliveries whose next attempt is at or
+// before now, oldest first.
+func (s *WebhookStore) Due(ctx context.Context, now time.Time, limit int) ([]PendingDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT d.id, d.attempts, w.url, w.secret, `+prefixed("a", alertColumns)+`
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		JOIN alerts a ON a.id = d.alert_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]PendingDelivery, 0)
+	for rows.Next() {
+		var p PendingDelivery
+		a, err := scanAlert(scanFunc(func(dest ...any) error {
+			return rows.Scan(append([]any{&p.ID, &p.Attempts, &p.URL, &p.Secret}, dest...)...)
+		}))
+		if err != nil {
+			return nil, err
+		}
+		p.Alert = a
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *WebhookStore) MarkDelivered(ctx context.Context, id int64, code int, at time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status='sent', attempts=attempts+1, response_code=?, last_error=NULL, delivered_at=?
+		WHERE id=?
+	`, code, at, id)
+	return err
+}
+
+// MarkAttemptFailed records a failed attempt. The delivery is retried at
+// next unless giveUp is set, in which case it is marked failed for good.
+// code is 0 when no response was received.
+func (s *WebhookStore) MarkAttemptFailed(ctx context.Context, id int64, code int, msg string, next time.Time, giveUp bool) error {
+	msg = strings.TrimSpace(msg)
+	if len(msg) > 400 {
+		msg = msg[:400]
+	}
+	status := "pending"
+	if giveUp {
+		status = "failed"
+	}
+	var respCode any
+	if code != 0 {
+		respCode = code
+	}
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status=?, attempts=attempts+1, response_code=?, last_error=?, next_attempt_at=?
+		WHERE id=?
+	`, status, respCode, msg, next, id)
+	return err
+}
+
+// Deliveries returns the most recent deliveries for a webhook, newest first.
+func (s *WebhookStore) Deliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, webhook_id, alert_id, status, attempts, next_attempt_at, response_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		var d WebhookDelivery
+		var code sql.NullInt64
+		var lastErr sql.NullString
+		var next, created, delivered sqlTime
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.AlertID, &d.Status, &d.Attempts, &next, &code, &lastErr, &created, &delivered); err != nil {
+			return nil, err
+		}
+		if code.Valid {
+			c := int(code.Int64)
+			d.ResponseCode = &c
+		}
+		d.LastError = nullString(lastErr)
+		d.NextAttemptAt = next.Time
+		d.CreatedAt = created.Time
+		d.DeliveredAt = delivered.ptr()
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,79 @@
+// Package email sends alert notifications over SMTP as multipart HTML and
+// plain-text messages.
+package email
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TLS modes for Config.TLS.
+const (
+	TLSStartTLS = "starttls" // plain connection upgraded with STARTTLS (port 587)
+	TLSImplicit = "tls"      // TLS from the first byte (port 465)
+	TLSNone     = "none"     // no encryption; only for local relays
+)
+
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      string
+	// Secret signs unsubscribe links.
+	Secret string
+	// BaseURL is the public API URL that verify and unsubscribe links
+	// point at.
+	BaseURL string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD,
+// SMTP_FROM, SMTP_TLS, NYCTCORD_EMAIL_SECRET and NYCTCORD_PUBLIC_URL.
+func ConfigFromEnv() Config {
+	c := Config{
+		Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     strings.TrimSpace(os.Getenv("SMTP_FROM")),
+		TLS:      strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_TLS"))),
+		Secret:   os.Getenv("NYCTCORD_EMAIL_SECRET"),
+		BaseURL:  strings.TrimRight(strings.TrimSpace(os.Getenv("NYCTCORD_PUBLIC_URL")), "/"),
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SMTP_PORT"))); err == nil && v > 0 {
+		c.Port = v
+	}
+	if c.TLS == "" {
+		c.TLS = TLSStartTLS
+		if c.Port == 465 {
+			c.TLS = TLSImplicit
+		}
+	}
+	if c.From == "" {
+		c.From = "nyctcord@localhost"
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = "http://localhost:8080"
+	}
+	return c
+}
+
+// Check reports why email can't be sent, or nil if it can. Alert emails
+// carry signed unsubscribe links, so a secret is as necessary as a server.
+func (c Config) Check() error {
+	if c.Host == "" {
+		return errors.New("SMTP_HOST is not set")
+	}
+	if c.Secret == "" {
+		return errors.New("NYCTCORD_EMAIL_SECRET is not set")
+	}
+	return nil
+}
+
+// Enabled reports whether email is fully configured.
+func (c Config) Enabled() bool {
+	return c.Check() == nil
+}
@@ -0,0 +1,40 @@
+package email
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/notify"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+// Notifier emails notifications to each user's verified address.
+type Notifier struct {
+	DB        *db.DB
+	Sender    *Sender
+	Templates *templates.Set
+}
+
+func (n *Notifier) Send(ctx context.Context, note notify.Notification) (notify.Receipt, error) {
+	to, err := n.DB.Users().VerifiedEmail(ctx, note.UserID)
+	if err == db.ErrNotFound {
+		return notify.Receipt{}, errors.New("no verified email address")
+	}
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	r, err := n.Templates.Notification(note)
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	msg, err := n.Sender.Config.AlertMessage(to, note, r)
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	id, err := n.Sender.Send(ctx, msg)
+	return notify.Receipt{ExternalID: id}, err
+}
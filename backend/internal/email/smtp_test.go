@@ -0,0 +1,354 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+// smtpServer is a minimal in-process SMTP server that accepts one message
+// per connection and records the envelope and data.
+type smtpServer struct {
+	t  *testing.T
+	ln net.Listener
+	// tls, if set, is advertised with STARTTLS.
+	tls *tls.Config
+	// rcptReply overrides the reply to RCPT TO.
+	rcptReply string
+
+	mu       sync.Mutex
+	auth     string
+	from     string
+	rcpt     string
+	data     string
+	upgraded bool
+	done     chan struct{}
+}
+
+// newSMTPServer starts a server; setup, if given, configures it first.
+func newSMTPServer(t *testing.T, setup ...func(*smtpServer)) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{t: t, ln: ln, done: make(chan struct{})}
+	for _, f := range setup {
+		f(s)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) config() Config {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return Config{
+		Host:    "127.0.0.1",
+		Port:    addr.Port,
+		From:    "NYCTcord <alerts@nyctcord.test>",
+		TLS:     TLSNone,
+		Secret:  "s3cret",
+		BaseURL: "https://nyctcord.test",
+	}
+}
+
+func (s *smtpServer) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer close(s.done)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 fake ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			ext := []string{"250-fake"}
+			s.mu.Lock()
+			if s.tls != nil && !s.upgraded {
+				ext = append(ext, "250-STARTTLS")
+			}
+			s.mu.Unlock()
+			reply(strings.Join(append(ext, "250 AUTH PLAIN"), "\r\n"))
+		case "STARTTLS":
+			reply("220 go ahead")
+			tc := tls.Server(conn, s.tls)
+			if err := tc.Handshake(); err != nil {
+				s.t.Errorf("server handshake: %v", err)
+				return
+			}
+			conn = tc
+			r = bufio.NewReader(conn)
+			s.mu.Lock()
+			s.upgraded = true
+			s.mu.Unlock()
+		case "AUTH":
+			_, cred, _ := strings.Cut(arg, " ")
+			b, _ := base64.StdEncoding.DecodeString(cred)
+			s.mu.Lock()
+			s.auth = string(b)
+			s.mu.Unlock()
+			reply("235 ok")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = arg
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpt = arg
+			s.mu.Unlock()
+			if s.rcptReply != "" {
+				reply(s.rcptReply)
+				continue
+			}
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// wait blocks until the connection is finished and returns the data.
+func (s *smtpServer) wait(t *testing.T) string {
+	t.Helper()
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data
+}
+
+func alertMessage(t *testing.T, cfg Config) Message {
+	t.Helper()
+	effect := "SIGNIFICANT_DELAYS"
+	n := db.PendingNotification{UserID: 42, LineID: "F", Effect: &effect}
+	msg, err := cfg.AlertMessage("Rider <rider@example.com>", n, templates.Rendered{
+		Subject: "F train: délays",
+		Title:   "F delays",
+		Body:    "Trains are running with delays.",
+		Footer:  "nyctcord",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestSendPlain(t *testing.T) {
+	srv := newSMTPServer(t)
+	cfg := srv.config()
+	cfg.Username, cfg.Password = "user", "pass"
+
+	id, err := NewSender(cfg).Send(context.Background(), alertMessage(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := srv.wait(t)
+
+	if srv.auth != "\x00user\x00pass" {
+		t.Errorf("AUTH PLAIN = %q", srv.auth)
+	}
+	if srv.from != "FROM:<alerts@nyctcord.test>" || srv.rcpt != "TO:<rider@example.com>" {
+		t.Errorf("envelope = %q -> %q", srv.from, srv.rcpt)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Header.Get("Message-ID"); got != id {
+		t.Errorf("Message-ID = %q, Send returned %q", got, id)
+	}
+	if !strings.HasSuffix(id, "@nyctcord.test>") {
+		t.Errorf("Message-ID %q should use the sender's domain", id)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != "F train: délays" {
+		t.Errorf("Subject = %q (%v)", subject, err)
+	}
+
+	unsub := cfg.unsubscribeURL(42)
+	if got := m.Header.Get("List-Unsubscribe"); got != "<"+unsub+">" {
+		t.Errorf("List-Unsubscribe = %q, want <%s>", got, unsub)
+	}
+	if got := m.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", m.Header.Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for _, want := range []string{"text/plain", "text/html"} {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %s: %v", want, err)
+		}
+		if ct := p.Header.Get("Content-Type"); !strings.HasPrefix(ct, want) {
+			t.Errorf("part Content-Type = %q, want %s", ct, want)
+		}
+		// multipart decodes quoted-printable parts itself.
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"F delays", "Trains are running with delays.", "SIGNIFICANT_DELAYS"} {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%s part is missing %q", want, s)
+			}
+		}
+		if want == "text/plain" && !strings.Contains(string(body), unsub) {
+			t.Errorf("text part is missing the unsubscribe link")
+		}
+	}
+}
+
+func TestSendStartTLS(t *testing.T) {
+	// httptest's certificate is valid for 127.0.0.1; borrow it.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	srv := newSMTPServer(t, func(s *smtpServer) { s.tls = ts.TLS })
+	cfg := srv.config()
+	cfg.TLS = TLSStartTLS
+
+	sender := NewSender(cfg)
+	sender.TLSConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	sender.TLSConfig.ServerName = cfg.Host
+
+	if _, err := sender.Send(context.Background(), alertMessage(t, cfg)); err != nil {
+		t.Fatal(err)
+	}
+	if data := srv.wait(t); data == "" || !srv.upgraded {
+		t.Errorf("message sent without STARTTLS (upgraded=%v)", srv.upgraded)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	t.Run("no STARTTLS", func(t *testing.T) {
+		srv := newSMTPServer(t)
+		cfg := srv.config()
+		cfg.TLS = TLSStartTLS
+		_, err := NewSender(cfg).Send(context.Background(), alertMessage(t, cfg))
+		if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+			t.Errorf("err = %v, want a STARTTLS error", err)
+		}
+		if srv.wait(t) != "" {
+			t.Error("message sent in the clear")
+		}
+	})
+
+	t.Run("recipient rejected", func(t *testing.T) {
+		srv := newSMTPServer(t, func(s *smtpServer) { s.rcptReply = "550 no such user" })
+		cfg := srv.config()
+		_, err := NewSender(cfg).Send(context.Background(), alertMessage(t, cfg))
+		if err == nil || !strings.Contains(err.Error(), "no such user") {
+			t.Errorf("err = %v, want the server's rejection", err)
+		}
+	})
+
+	t.Run("bad address", func(t *testing.T) {
+		cfg := Config{Host: "127.0.0.1", Port: 1, From: "a@b.test", Secret: "s"}
+		if _, err := NewSender(cfg).Send(context.Background(), Message{To: "not an address"}); err == nil {
+			t.Error("sent to an invalid address")
+		}
+	})
+}
+
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Host: "smtp.test", Secret: "s"}, ""},
+		{Config{Secret: "s"}, "SMTP_HOST"},
+		{Config{Host: "smtp.test"}, "NYCTCORD_EMAIL_SECRET"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Check()
+		if tt.want == "" {
+			if err != nil || !tt.cfg.Enabled() {
+				t.Errorf("%+v: Check() = %v, want enabled", tt.cfg, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) || tt.cfg.Enabled() {
+			t.Errorf("%+v: Check() = %v, want an error naming %s", tt.cfg, err, tt.want)
+		}
+	}
+
+	// Without a secret nothing is sent, so no unverifiable unsubscribe
+	// links go out.
+	_, err := NewSender(Config{Host: "127.0.0.1", Port: 1}).Send(context.Background(), Message{To: "a@b.test"})
+	if err == nil || !strings.Contains(err.Error(), "NYCTCORD_EMAIL_SECRET") {
+		t.Errorf("Send without a secret: %v", err)
+	}
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	token := UnsubscribeToken("s3cret", 42)
+
+	if id, ok := ParseUnsubscribeToken("s3cret", token); !ok || id != 42 {
+		t.Errorf("ParseUnsubscribeToken = %d, %v; want 42, true", id, ok)
+	}
+	if _, ok := ParseUnsubscribeToken("other", token); ok {
+		t.Error("token accepted with the wrong secret")
+	}
+	if _, ok := ParseUnsubscribeToken("", UnsubscribeToken("", 42)); ok {
+		t.Error("token accepted with an empty secret")
+	}
+	_, sig, _ := strings.Cut(token, ".")
+	if _, ok := ParseUnsubscribeToken("s3cret", strconv.Itoa(43)+"."+sig); ok {
+		t.Error("token for 42 accepted for 43")
+	}
+}
@@ -0,0 +1,88 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/lines"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html.tmpl"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt.tmpl"))
+)
+
+type alertData struct {
+	Title          string
+	Rule           string
+	Body           string
+	Effect         string
+	Line           string
+	Color          string
+	Footer         string
+	UnsubscribeURL string
+}
+
+// AlertMessage lays out a rendered notification like the Discord embed:
+// line bullet in the line colour, title, body, effect and footer.
+func (c Config) AlertMessage(to string, n db.PendingNotification, r templates.Rendered) (Message, error) {
+	line := strings.ToUpper(strings.TrimSpace(n.LineID))
+
+	data := alertData{
+		Title:          r.Title,
+		Rule:           strings.Repeat("=", utf8.RuneCountInString(r.Title)),
+		Body:           r.Body,
+		Effect:         deref(n.Effect),
+		Line:           line,
+		Color:          fmt.Sprintf("#%06X", lines.Color(line)),
+		Footer:         r.Footer,
+		UnsubscribeURL: c.unsubscribeURL(n.UserID),
+	}
+
+	msg := Message{
+		To:      to,
+		Subject: r.Subject,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+	return msg, render(&msg, "alert", data)
+}
+
+// VerifyMessage asks the recipient to confirm their address.
+func (c Config) VerifyMessage(to, token string) (Message, error) {
+	msg := Message{To: to, Subject: "Confirm your email for NYCTcord alerts"}
+	data := struct{ VerifyURL string }{c.BaseURL + "/api/email/verify?token=" + token}
+	return msg, render(&msg, "verify", data)
+}
+
+func render(msg *Message, name string, data any) error {
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt.tmpl", data); err != nil {
+		return err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html.tmpl", data); err != nil {
+		return err
+	}
+	msg.Text = text.String()
+	msg.HTML = html.String()
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
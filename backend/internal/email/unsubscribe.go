@@ -0,0 +1,45 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+func unsubscribeMAC(secret string, userID int64) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:" + strconv.FormatInt(userID, 10)))
+	return mac.Sum(nil)[:16]
+}
+
+// UnsubscribeToken signs userID so an unsubscribe link works without
+// logging in and can't be forged for someone else.
+func UnsubscribeToken(secret string, userID int64) string {
+	return strconv.FormatInt(userID, 10) + "." + base64.RawURLEncoding.EncodeToString(unsubscribeMAC(secret, userID))
+}
+
+// ParseUnsubscribeToken returns the user a token was issued for.
+func ParseUnsubscribeToken(secret, token string) (int64, bool) {
+	if secret == "" {
+		return 0, false
+	}
+	idPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return 0, false
+	}
+	return userID, hmac.Equal(sig, unsubscribeMAC(secret, userID))
+}
+
+func (c Config) unsubscribeURL(userID int64) string {
+	return c.BaseURL + "/api/email/unsubscribe?token=" + UnsubscribeToken(c.Secret, userID)
+}
@@ -0,0 +1,63 @@
+// Package lines holds static facts about subway lines shared by the
+// notification senders.
+package lines
+
+// Color is the MTA brand colour of line as 0xRRGGBB.
+func Color(line string) int {
+	// Hex -> int (0xRRGGBB)
+	const (
+		blue     = 0x0062CF // A/C/E
+		orange   = 0xEB6800 // B/D/F/M
+		lightGrn = 0x799534 // G
+		brown    = 0x8E5C33 // J/Z
+		grey     = 0x7C858C // L + Shuttle S
+		yellow   = 0xF6BC26 // N/Q/R/W
+		red      = 0xD82233 // 1/2/3
+		darkGrn  = 0x009952 // 4/5/6
+		purple   = 0x9A38A1 // 7
+		teal     = 0x008EB7 // T
+		mtaBlue  = 0x08179C // SIR
+		fallback = 0x08179C // default to MTA Blue
+	)
+
+	switch line {
+	case "A", "C", "E":
+		return blue
+
+	case "B", "D", "F", "M":
+		return orange
+
+	case "G":
+		return lightGrn
+
+	case "J", "Z":
+		return brown
+
+	case "L", "S", "GS", "FS", "H":
+		return grey
+
+	case "N", "Q", "R", "W":
+		return yellow
+
+	case "1", "2", "3":
+		return red
+
+	case "4", "5", "6":
+		return darkGrn
+
+	case "7":
+		return purple
+
+	case "T":
+		return teal
+
+	case "SI", "SIR":
+		return mtaBlue
+
+	case "ALL":
+		return fallback
+
+	default:
+		return fallback
+	}
+}
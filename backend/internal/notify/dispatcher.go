@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// Dispatcher drains pending notifications for every channel type in its
+// registry. Rows for other channel types are left for whichever process
+// registered them.
+type Dispatcher struct {
+	DB        *db.DB
+	Registry  *Registry
+	BatchSize int
+	Now       func() time.Time
+
+	// unmarked holds notifications that were sent but couldn't be marked
+	// sent, so they are marked rather than sent again.
+	unmarked map[int64]Receipt
+}
+
+func NewDispatcher(database *db.DB, registry *Registry) *Dispatcher {
+	return &Dispatcher{DB: database, Registry: registry, BatchSize: 25, Now: time.Now}
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Now == nil {
+		return time.Now()
+	}
+	return d.Now()
+}
+
+// Run dispatches every interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends one batch per registered channel type, oldest first, and
+// returns how many notifications were sent and how many failed. It must not
+// be called concurrently.
+func (d *Dispatcher) RunOnce(ctx context.Context) (sent, failed int) {
+	store := d.DB.Notifications()
+	d.markUnmarked(ctx)
+
+	for _, channelType := range d.Registry.ChannelTypes() {
+		notifier, _ := d.Registry.Get(channelType)
+
+		// Unmarked rows are still pending and come back first; fetch
+		// enough past them for a full batch.
+		pending, err := store.Pending(ctx, channelType, d.BatchSize+len(d.unmarked), true)
+		if err != nil {
+			log.Printf("notify: load pending %s error: %v", channelType, err)
+			continue
+		}
+
+		batch := 0
+		for _, n := range pending {
+			if ctx.Err() != nil {
+				return sent, failed
+			}
+			if _, ok := d.unmarked[n.ID]; ok {
+				continue
+			}
+			if batch == d.BatchSize {
+				break
+			}
+			batch++
+
+			receipt, err := notifier.Send(ctx, n)
+			if err != nil {
+				log.Printf("notify: %s send failed notif_id=%d user_id=%d err=%v", channelType, n.ID, n.UserID, err)
+				if err := store.MarkFailed(ctx, n.ID, err.Error()); err != nil {
+					log.Printf("notify: mark failed notif_id=%d err=%v", n.ID, err)
+				}
+				failed++
+				continue
+			}
+
+			if receipt.SentAt.IsZero() {
+				receipt.SentAt = d.now()
+			}
+			if err := store.MarkSent(ctx, n.ID, receipt.ExternalID, receipt.SentAt); err != nil {
+				log.Printf("notify: mark sent notif_id=%d err=%v", n.ID, err)
+				if d.unmarked == nil {
+					d.unmarked = map[int64]Receipt{}
+				}
+				d.unmarked[n.ID] = receipt
+			}
+			sent++
+		}
+	}
+	return sent, failed
+}
+
+// markUnmarked retries marking notifications that were sent on an earlier
+// run but couldn't be recorded then.
+func (d *Dispatcher) markUnmarked(ctx context.Context) {
+	store := d.DB.Notifications()
+	for id, receipt := range d.unmarked {
+		if err := store.MarkSent(ctx, id, receipt.ExternalID, receipt.SentAt); err != nil {
+			log.Printf("notify: mark sent notif_id=%d err=%v", id, err)
+			continue
+		}
+		delete(d.unmarked, id)
+	}
+}
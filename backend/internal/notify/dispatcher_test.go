@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// seed subscribes a user to F by DM and Slack and queues one alert, giving
+// one pending notification per channel.
+func seed(t *testing.T, d *db.DB) {
+	t.Helper()
+	ctx := context.Background()
+	u, err := d.Users().Upsert(ctx, "100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := "https://hooks.slack.test/x"
+	if err := d.SlackDestinations().Upsert(ctx, db.SlackDestination{UserID: u.ID, WebhookURL: &hook}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Subscriptions().ReplaceForUser(ctx, u.ID, []string{"F"}, db.Channels{DM: true, Slack: true}); err != nil {
+		t.Fatal(err)
+	}
+	status := "Delays"
+	alertID, err := d.Alerts().Insert(ctx, db.Alert{LineID: "F", NewStatus: &status, CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Notifications().EnqueueForLine(ctx, alertID, "F", now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type row struct {
+	status     string
+	externalID sql.NullString
+	lastError  sql.NullString
+	sentAt     sql.NullString
+}
+
+func notification(t *testing.T, d *db.DB, channelType string) row {
+	t.Helper()
+	var r row
+	err := d.QueryRowContext(context.Background(), `
+		SELECT status, external_id, last_error, sent_at FROM notifications WHERE channel_type = ?
+	`, channelType).Scan(&r.status, &r.externalID, &r.lastError, &r.sentAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func newDispatcher(d *db.DB, notifiers map[string]Notifier) *Dispatcher {
+	registry := NewRegistry()
+	for channelType, n := range notifiers {
+		registry.Register(channelType, n)
+	}
+	disp := NewDispatcher(d, registry)
+	disp.Now = func() time.Time { return now }
+	return disp
+}
+
+func TestDispatcherSends(t *testing.T) {
+	d := openTestDB(t)
+	seed(t, d)
+	dm, slack := &Fake{}, &Fake{}
+
+	sent, failed := newDispatcher(d, map[string]Notifier{db.ChannelDM: dm, db.ChannelSlack: slack}).RunOnce(context.Background())
+	if sent != 2 || failed != 0 {
+		t.Fatalf("RunOnce = %d sent, %d failed; want 2, 0", sent, failed)
+	}
+	if got := dm.Sent(); len(got) != 1 || got[0].ChannelType != db.ChannelDM || got[0].LineID != "F" || got[0].DiscordID != "100" {
+		t.Errorf("dm notifier got %+v", got)
+	}
+	if got := slack.Sent(); len(got) != 1 || got[0].ChannelType != db.ChannelSlack {
+		t.Errorf("slack notifier got %+v", got)
+	}
+
+	r := notification(t, d, db.ChannelDM)
+	if r.status != "sent" || r.externalID.String != "fake-1" || r.lastError.Valid || !r.sentAt.Valid {
+		t.Errorf("dm row = %+v, want sent with the receipt id", r)
+	}
+}
+
+func TestDispatcherFailure(t *testing.T) {
+	d := openTestDB(t)
+	seed(t, d)
+	dm := &Fake{Err: errors.New("cannot DM user")}
+	slack := &Fake{}
+	disp := newDispatcher(d, map[string]Notifier{db.ChannelDM: dm, db.ChannelSlack: slack})
+
+	sent, failed := disp.RunOnce(context.Background())
+	if sent != 1 || failed != 1 {
+		t.Fatalf("RunOnce = %d sent, %d failed; want 1, 1", sent, failed)
+	}
+	r := notification(t, d, db.ChannelDM)
+	if r.status != "failed" || r.lastError.String != "cannot DM user" || r.sentAt.Valid {
+		t.Errorf("dm row = %+v, want failed with the error", r)
+	}
+	if r := notification(t, d, db.ChannelSlack); r.status != "sent" {
+		t.Errorf("slack row = %+v; one channel failing held back another", r)
+	}
+
+	// Failed notifications aren't retried.
+	dm.Err = nil
+	if sent, failed := disp.RunOnce(context.Background()); sent != 0 || failed != 0 || len(dm.Sent()) != 0 {
+		t.Errorf("second run sent %d, failed %d", sent, failed)
+	}
+}
+
+func TestDispatcherUnknownChannel(t *testing.T) {
+	d := openTestDB(t)
+	seed(t, d)
+	dm := &Fake{}
+
+	// Only DM is registered; the Slack row belongs to another process.
+	sent, failed := newDispatcher(d, map[string]Notifier{db.ChannelDM: dm}).RunOnce(context.Background())
+	if sent != 1 || failed != 0 {
+		t.Fatalf("RunOnce = %d sent, %d failed; want 1, 0", sent, failed)
+	}
+	if r := notification(t, d, db.ChannelSlack); r.status != "pending" {
+		t.Errorf("slack row = %+v, want it left pending", r)
+	}
+}
+
+func TestDispatcherMarkSentFailure(t *testing.T) {
+	d := openTestDB(t)
+	seed(t, d)
+	ctx := context.Background()
+
+	// The notifier succeeds, but the database refuses the update that
+	// records it.
+	calls := 0
+	dm := NotifierFunc(func(ctx context.Context, n Notification) (Receipt, error) {
+		calls++
+		_, err := d.ExecContext(ctx, `
+			CREATE TRIGGER block_updates BEFORE UPDATE ON notifications
+			BEGIN SELECT RAISE(ABORT, 'database is read-only'); END
+		`)
+		return Receipt{ExternalID: "msg-1"}, err
+	})
+	disp := newDispatcher(d, map[string]Notifier{db.ChannelDM: dm})
+
+	if sent, _ := disp.RunOnce(ctx); sent != 1 {
+		t.Fatalf("RunOnce sent %d, want 1", sent)
+	}
+	if r := notification(t, d, db.ChannelDM); r.status != "pending" {
+		t.Fatalf("dm row = %+v, want the failed mark to leave it pending", r)
+	}
+
+	// Still unrecordable: the notification isn't sent again.
+	if sent, _ := disp.RunOnce(ctx); sent != 0 || calls != 1 {
+		t.Fatalf("second run sent %d (%d calls), want the notification skipped", sent, calls)
+	}
+
+	if _, err := d.ExecContext(ctx, `DROP TRIGGER block_updates`); err != nil {
+		t.Fatal(err)
+	}
+	disp.RunOnce(ctx)
+	r := notification(t, d, db.ChannelDM)
+	if r.status != "sent" || r.externalID.String != "msg-1" || calls != 1 {
+		t.Errorf("dm row = %+v after %d sends, want it marked sent without resending", r, calls)
+	}
+}
+
+// A notification left unmarked doesn't take up a batch slot, so the queue
+// behind it keeps moving.
+func TestDispatcherUnmarkedDoesNotStall(t *testing.T) {
+	d := openTestDB(t)
+	seed(t, d)
+	ctx := context.Background()
+
+	status := "No Service"
+	second, err := d.Alerts().Insert(ctx, db.Alert{LineID: "F", NewStatus: &status, CreatedAt: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Notifications().EnqueueForLine(ctx, second, "F", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first DM is sent but can't be marked.
+	var first int64
+	if err := d.QueryRowContext(ctx, `SELECT MIN(id) FROM notifications WHERE channel_type = 'dm'`).Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TRIGGER block_first BEFORE UPDATE ON notifications WHEN OLD.id = %d
+		BEGIN SELECT RAISE(ABORT, 'database is read-only'); END
+	`, first)); err != nil {
+		t.Fatal(err)
+	}
+
+	dm := &Fake{}
+	disp := newDispatcher(d, map[string]Notifier{db.ChannelDM: dm})
+	disp.BatchSize = 1
+
+	if sent, _ := disp.RunOnce(ctx); sent != 1 {
+		t.Fatalf("first run sent %d, want 1", sent)
+	}
+	if sent, _ := disp.RunOnce(ctx); sent != 1 {
+		t.Fatalf("second run sent %d, want the next notification", sent)
+	}
+	if got := dm.Sent(); len(got) != 2 || got[0].ID == got[1].ID {
+		t.Errorf("sent %+v, want both notifications once each", got)
+	}
+	if sent, _ := disp.RunOnce(ctx); sent != 0 || len(dm.Sent()) != 2 {
+		t.Errorf("third run sent %d, want nothing left", sent)
+	}
+}
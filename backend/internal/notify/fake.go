@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// Fake is an in-memory Notifier for tests and dry runs. It records every
+// notification and fails with Err when it is set.
+type Fake struct {
+	mu   sync.Mutex
+	Err  error
+	sent []Notification
+}
+
+func (f *Fake) Send(ctx context.Context, n Notification) (Receipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return Receipt{}, f.Err
+	}
+	f.sent = append(f.sent, n)
+	return Receipt{ExternalID: "fake-" + strconv.Itoa(len(f.sent))}, nil
+}
+
+// Sent returns a copy of what has been sent so far.
+func (f *Fake) Sent() []Notification {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Notification(nil), f.sent...)
+}
@@ -0,0 +1,74 @@
+// Package notify routes queued notifications to the channel that delivers
+// them. Each channel implements Notifier and is registered under its
+// notifications.channel_type; a Dispatcher drains the queue through them.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// Notification is one pending row of the notifications queue.
+type Notification = db.PendingNotification
+
+// Receipt describes a successful delivery.
+type Receipt struct {
+	// ExternalID is the provider's id for the sent message, if any.
+	ExternalID string
+	SentAt     time.Time
+}
+
+type Notifier interface {
+	Send(ctx context.Context, n Notification) (Receipt, error)
+}
+
+// NotifierFunc adapts a function to Notifier.
+type NotifierFunc func(ctx context.Context, n Notification) (Receipt, error)
+
+func (f NotifierFunc) Send(ctx context.Context, n Notification) (Receipt, error) {
+	return f(ctx, n)
+}
+
+// Registry maps channel types to notifiers. It is safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+func NewRegistry() *Registry {
+	return &Registry{notifiers: map[string]Notifier{}}
+}
+
+// Register adds n for channelType. Registering a type twice is a bug.
+func (r *Registry) Register(channelType string, n Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.notifiers[channelType]; ok {
+		panic(fmt.Sprintf("notify: channel type %q registered twice", channelType))
+	}
+	r.notifiers[channelType] = n
+}
+
+func (r *Registry) Get(channelType string) (Notifier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.notifiers[channelType]
+	return n, ok
+}
+
+// ChannelTypes returns the registered channel types, sorted.
+func (r *Registry) ChannelTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.notifiers))
+	for t := range r.notifiers {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,80 @@
+package poller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// isPlanned reports whether an entity is planned work. The MTA marks these
+// with ids like "lmm:planned:12345".
+func isPlanned(ent *gtfsrt.FeedEntity) bool {
+	return strings.Contains(ent.GetId(), ":planned:")
+}
+
+// PlannedFromFeeds collects the active periods of planned work that haven't
+// ended by now, one entry per line and period. Periods of other alerts are
+// included too when they start in the future, since that is planned work in
+// all but name; once started they are only passed on as RefreshOnly so
+// the stored period keeps running instead of being cut short.
+func PlannedFromFeeds(msgs []*gtfsrt.FeedMessage, now time.Time) []db.PlannedWork {
+	nowUnix := uint64(now.Unix())
+	seen := map[string]bool{}
+	out := make([]db.PlannedWork, 0)
+
+	for _, msg := range msgs {
+		for _, ent := range msg.GetEntity() {
+			alert := ent.GetAlert()
+			if alert == nil || ent.GetId() == "" {
+				continue
+			}
+			planned := isPlanned(ent)
+
+			effect := alert.GetEffect().String()
+			header := firstTranslation(alert.GetHeaderText())
+			body := firstTranslation(alert.GetDescriptionText())
+
+			for _, ap := range alert.GetActivePeriod() {
+				start, end := ap.GetStart(), ap.GetEnd()
+				if start == 0 || (end != 0 && end <= nowUnix) {
+					continue
+				}
+				refreshOnly := !planned && start <= nowUnix
+
+				var endsAt *time.Time
+				if end != 0 {
+					t := time.Unix(int64(end), 0).UTC()
+					endsAt = &t
+				}
+
+				for _, ie := range alert.GetInformedEntity() {
+					lineID := strings.TrimSpace(ie.GetRouteId())
+					if lineID == "" {
+						continue
+					}
+					key := fmt.Sprintf("%s|%s|%d", ent.GetId(), lineID, start)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+
+					out = append(out, db.PlannedWork{
+						AlertID:  ent.GetId(),
+						LineID:   lineID,
+						Effect:   &effect,
+						Header:   &header,
+						Body:     &body,
+						StartsAt: time.Unix(int64(start), 0).UTC(),
+						EndsAt:   endsAt,
+
+						RefreshOnly: refreshOnly,
+					})
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+)
+
+func TestPlannedFromFeeds(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	unix := uint64(now.Unix())
+
+	got := PlannedFromFeeds([]*gtfsrt.FeedMessage{feed(
+		alertFixture{id: "lmm:planned:1", routes: []string{"F", "G", "F"}, start: unix - 3600, end: unix + 3600},
+		alertFixture{id: "lmm:planned:2", routes: []string{"A"}, start: unix - 7200, end: unix - 60},
+		alertFixture{id: "lmm:alert:3", routes: []string{"C"}, start: unix + 600},
+		alertFixture{id: "lmm:alert:4", routes: []string{"E"}, start: unix - 600},
+	)}, now)
+
+	byKey := map[string]bool{}
+	for _, pw := range got {
+		byKey[pw.AlertID+"|"+pw.LineID] = pw.RefreshOnly
+	}
+	want := map[string]bool{
+		"lmm:planned:1|F": false,
+		"lmm:planned:1|G": false,
+		"lmm:alert:3|C":   false,
+		"lmm:alert:4|E":   true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("PlannedFromFeeds = %+v", got)
+	}
+	for k, refresh := range want {
+		if r, ok := byKey[k]; !ok || r != refresh {
+			t.Errorf("%s: present=%v refreshOnly=%v, want refreshOnly=%v", k, ok, r, refresh)
+		}
+	}
+}
+
+// An ordinary alert announced ahead of time keeps its calendar entry once
+// it starts, rather than ending before it began.
+func TestPlannedAlertKeepsRunning(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+	start := time.Unix(1_700_000_000, 0).UTC()
+	alert := alertFixture{id: "lmm:alert:9", routes: []string{"G"}, start: uint64(start.Unix())}
+
+	sync := func(at time.Time) {
+		t.Helper()
+		items := PlannedFromFeeds([]*gtfsrt.FeedMessage{feed(alert)}, at)
+		if err := database.PlannedWork().Sync(ctx, items, true, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync(start.Add(-time.Hour))
+	sync(start.Add(time.Hour))
+
+	got, err := database.PlannedWork().Overlapping(ctx, nil, start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].EndsAt != nil {
+		t.Fatalf("Overlapping = %+v, want one open period", got)
+	}
+	if !got[0].LastSeenAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("last seen %v, want %v", got[0].LastSeenAt, start.Add(time.Hour))
+	}
+}
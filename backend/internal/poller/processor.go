@@ -0,0 +1,354 @@
+package poller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// Candidate is the most severe active alert seen for a line in one poll.
+type Candidate struct {
+	LineID string
+	// AlertID is the GTFS-RT entity id; empty for resolutions.
+	AlertID string
+	Status  string
+	Effect  string
+	Header  string
+	Body    string
+	Hash    string
+	// Resolution marks a Good Service candidate made up by resolvedLines.
+	Resolution bool
+}
+
+// Transition is a line status change that was written to the database.
+type Transition struct {
+	AlertID   int64
+	LineID    string
+	OldStatus string
+	NewStatus string
+	Header    string
+	Body      string
+	Effect    string
+	At        time.Time
+}
+
+type Processor struct {
+	DB  *db.DB
+	Now func() time.Time
+	// Recorder, if set, saves what Run fetches from each RawSource.
+	Recorder *Recorder
+}
+
+func NewProcessor(database *db.DB) *Processor {
+	return &Processor{DB: database, Now: time.Now}
+}
+
+func (p *Processor) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
+
+// Run fetches every source and applies the result. Sources that fail are
+// logged and skipped so one bad feed doesn't hold back the others, but
+// lines are only marked resolved when every source was read. The poll is
+// stamped once, so recordings and the processing clock agree.
+func (p *Processor) Run(ctx context.Context, sources []FeedSource) ([]Transition, error) {
+	now := p.now()
+	complete := true
+	msgs := make([]*gtfsrt.FeedMessage, 0, len(sources))
+	for i, src := range sources {
+		msg, err := p.fetch(ctx, src, i, now)
+		if err != nil {
+			log.Printf("poller: fetch error (%s): %v", src.Name(), err)
+			if msg == nil {
+				complete = false
+				continue
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return p.process(ctx, msgs, complete, now)
+}
+
+func (p *Processor) fetch(ctx context.Context, src FeedSource, index int, at time.Time) (*gtfsrt.FeedMessage, error) {
+	raw, ok := src.(RawSource)
+	if p.Recorder == nil || !ok {
+		return src.Fetch(ctx)
+	}
+	msg, b, err := raw.FetchRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Recorder.Save(at, index, b); err != nil {
+		log.Printf("poller: record error (%s): %v", src.Name(), err)
+	}
+	return msg, nil
+}
+
+// Process applies msgs as a complete view of the feeds: any line with an
+// open disruption that none of them mention is marked resolved.
+func (p *Processor) Process(ctx context.Context, msgs []*gtfsrt.FeedMessage) ([]Transition, error) {
+	return p.process(ctx, msgs, true, p.now())
+}
+
+func (p *Processor) process(ctx context.Context, msgs []*gtfsrt.FeedMessage, complete bool, now time.Time) ([]Transition, error) {
+	candidates := BestByLine(msgs, now)
+
+	planned := PlannedFromFeeds(msgs, now)
+	err := p.DB.WithTx(ctx, func(tx *db.Tx) error {
+		return tx.PlannedWork().Sync(ctx, planned, complete, now)
+	})
+	if err != nil {
+		log.Printf("poller: planned work sync error: %v", err)
+	}
+
+	if complete {
+		resolved, err := p.resolvedLines(ctx, candidates)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, resolved...)
+	}
+
+	out := make([]Transition, 0)
+	for _, c := range candidates {
+		var t Transition
+		var changed bool
+		err := p.DB.WithTx(ctx, func(tx *db.Tx) error {
+			var err error
+			t, changed, err = upsertLineStatusIfChanged(ctx, tx, c, now)
+			return err
+		})
+		if err != nil {
+			log.Printf("poller: upsert error for line %s: %v", c.LineID, err)
+			continue
+		}
+		if changed {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// resolvedLines returns a Good Service candidate for every line that is
+// currently disrupted but has no active alert any more.
+//
+// A resolution is written like any other transition so it closes the
+// incident in the stats rollups, but subscribers and webhooks aren't told
+// about it. Only guild channels get it, to post it in the incident's thread.
+func (p *Processor) resolvedLines(ctx context.Context, active []Candidate) ([]Candidate, error) {
+	seen := make(map[string]bool, len(active))
+	for _, c := range active {
+		seen[c.LineID] = true
+	}
+
+	lines, err := p.DB.Lines().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Candidate, 0)
+	for _, ls := range lines {
+		if seen[ls.LineID] || ls.Status == db.StatusGoodService {
+			continue
+		}
+		// An empty hash never matches a real alert, so the next alert
+		// on this line always registers as a change.
+		out = append(out, Candidate{
+			LineID: ls.LineID,
+			Status: db.StatusGoodService,
+			Header: "Good service has resumed.",
+
+			Resolution: true,
+		})
+	}
+	return out, nil
+}
+
+// BestByLine picks the most severe alert active at now for every line
+// mentioned in msgs, sorted by line ID.
+func BestByLine(msgs []*gtfsrt.FeedMessage, now time.Time) []Candidate {
+	best := map[string]Candidate{}
+	nowUnix := uint64(now.Unix())
+
+	for _, msg := range msgs {
+		for _, ent := range msg.GetEntity() {
+			alert := ent.GetAlert()
+			if alert == nil {
+				continue
+			}
+			if !isActiveNow(alert, nowUnix) {
+				continue
+			}
+
+			effect := alert.GetEffect().String()
+			header := firstTranslation(alert.GetHeaderText())
+			body := firstTranslation(alert.GetDescriptionText())
+
+			cand := Candidate{
+				AlertID: ent.GetId(),
+				Status:  statusFromEffect(effect),
+				Effect:  effect,
+				Header:  header,
+				Body:    body,
+				Hash:    contentHash(effect, header, body),
+			}
+
+			for _, ie := range alert.GetInformedEntity() {
+				lineID := strings.TrimSpace(ie.GetRouteId())
+				if lineID == "" {
+					continue
+				}
+
+				cur, ok := best[lineID]
+				if !ok || SeverityRank(cand.Effect) > SeverityRank(cur.Effect) {
+					cand.LineID = lineID
+					best[lineID] = cand
+				}
+			}
+		}
+	}
+
+	out := make([]Candidate, 0, len(best))
+	for _, c := range best {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LineID < out[j].LineID })
+	return out
+}
+
+func isActiveNow(a *gtfsrt.Alert, now uint64) bool {
+	aps := a.GetActivePeriod()
+	if len(aps) == 0 {
+		return true
+	}
+	for _, ap := range aps {
+		start := ap.GetStart()
+		end := ap.GetEnd()
+		if (start == 0 || now >= start) && (end == 0 || now <= end) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstTranslation(t *gtfsrt.TranslatedString) string {
+	if t == nil || len(t.GetTranslation()) == 0 {
+		return ""
+	}
+	return t.GetTranslation()[0].GetText()
+}
+
+func contentHash(effect, header, body string) string {
+	sum := sha256.Sum256([]byte(effect + "\n" + header + "\n" + body))
+	return hex.EncodeToString(sum[:])
+}
+
+// SeverityRank orders GTFS-RT effects from 0 (informational) to 5
+// (NO_SERVICE). It picks the alert shown for a line and how loudly
+// notifications about it are delivered.
+func SeverityRank(effect string) int {
+	switch effect {
+	case "NO_SERVICE":
+		return 5
+	case "REDUCED_SERVICE":
+		return 4
+	case "SIGNIFICANT_DELAYS":
+		return 3
+	case "DETOUR":
+		return 2
+	case "MODIFIED_SERVICE":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func statusFromEffect(effect string) string {
+	switch effect {
+	case "NO_SERVICE":
+		return "No Service"
+	case "REDUCED_SERVICE":
+		return "Reduced Service"
+	case "SIGNIFICANT_DELAYS":
+		return "Delays"
+	case "DETOUR", "MODIFIED_SERVICE":
+		return "Service Change"
+	default:
+		return "Alert"
+	}
+}
+
+func upsertLineStatusIfChanged(ctx context.Context, tx *db.Tx, c Candidate, now time.Time) (Transition, bool, error) {
+	existing, err := tx.Lines().Get(ctx, c.LineID)
+	if err != nil && err != db.ErrNotFound {
+		return Transition{}, false, err
+	}
+
+	if err == nil && existing.ContentHash == c.Hash {
+		return Transition{}, false, nil
+	}
+
+	oldStatus := existing.Status
+
+	alertRowID, err := tx.Alerts().Insert(ctx, db.Alert{
+		AlertID:   c.AlertID,
+		LineID:    c.LineID,
+		OldStatus: &oldStatus,
+		NewStatus: &c.Status,
+		Header:    &c.Header,
+		Body:      &c.Body,
+		Effect:    &c.Effect,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return Transition{}, false, err
+	}
+
+	if !c.Resolution {
+		if err := tx.Notifications().EnqueueForLine(ctx, alertRowID, c.LineID, now); err != nil {
+			return Transition{}, false, err
+		}
+
+		if err := tx.Webhooks().EnqueueForLine(ctx, alertRowID, c.LineID, now); err != nil {
+			return Transition{}, false, err
+		}
+	}
+
+	if err := tx.Guilds().EnqueueForLine(ctx, alertRowID, c.LineID, now); err != nil {
+		return Transition{}, false, err
+	}
+
+	err = tx.Lines().Upsert(ctx, db.LineStatus{
+		LineID:      c.LineID,
+		Status:      c.Status,
+		Header:      &c.Header,
+		Body:        &c.Body,
+		Effect:      &c.Effect,
+		ContentHash: c.Hash,
+		UpdatedAt:   now,
+	})
+	if err != nil {
+		return Transition{}, false, err
+	}
+
+	return Transition{
+		AlertID:   alertRowID,
+		LineID:    c.LineID,
+		OldStatus: oldStatus,
+		NewStatus: c.Status,
+		Header:    c.Header,
+		Body:      c.Body,
+		Effect:    c.Effect,
+		At:        now,
+	}, true, nil
+}
@@ -0,0 +1,330 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"google.golang.org/protobuf/proto"
+)
+
+type alertFixture struct {
+	id         string
+	effect     gtfsrt.Alert_Effect
+	header     string
+	routes     []string
+	start, end uint64
+}
+
+func feed(alerts ...alertFixture) *gtfsrt.FeedMessage {
+	msg := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+	}
+	for _, a := range alerts {
+		alert := &gtfsrt.Alert{
+			Effect: a.effect.Enum(),
+			HeaderText: &gtfsrt.TranslatedString{
+				Translation: []*gtfsrt.TranslatedString_Translation{{Text: proto.String(a.header)}},
+			},
+		}
+		for _, r := range a.routes {
+			alert.InformedEntity = append(alert.InformedEntity, &gtfsrt.EntitySelector{RouteId: proto.String(r)})
+		}
+		if a.start != 0 || a.end != 0 {
+			alert.ActivePeriod = []*gtfsrt.TimeRange{{Start: proto.Uint64(a.start), End: proto.Uint64(a.end)}}
+		}
+		msg.Entity = append(msg.Entity, &gtfsrt.FeedEntity{Id: proto.String(a.id), Alert: alert})
+	}
+	return msg
+}
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestBestByLine(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	unix := uint64(now.Unix())
+
+	tests := []struct {
+		name string
+		msgs []*gtfsrt.FeedMessage
+		want map[string]string // line -> alert id
+	}{
+		{
+			name: "empty feed",
+			msgs: []*gtfsrt.FeedMessage{feed()},
+			want: map[string]string{},
+		},
+		{
+			name: "most severe alert wins",
+			msgs: []*gtfsrt.FeedMessage{feed(
+				alertFixture{id: "delay", effect: gtfsrt.Alert_SIGNIFICANT_DELAYS, header: "Delays", routes: []string{"A"}},
+				alertFixture{id: "suspended", effect: gtfsrt.Alert_NO_SERVICE, header: "Suspended", routes: []string{"A", "C"}},
+				alertFixture{id: "detour", effect: gtfsrt.Alert_DETOUR, header: "Detour", routes: []string{"C"}},
+			)},
+			want: map[string]string{"A": "suspended", "C": "suspended"},
+		},
+		{
+			name: "alerts are merged across feeds",
+			msgs: []*gtfsrt.FeedMessage{
+				feed(alertFixture{id: "a", effect: gtfsrt.Alert_DETOUR, header: "Detour", routes: []string{"A"}}),
+				feed(alertFixture{id: "b", effect: gtfsrt.Alert_REDUCED_SERVICE, header: "Reduced", routes: []string{"A", "7"}}),
+			},
+			want: map[string]string{"A": "b", "7": "b"},
+		},
+		{
+			name: "inactive periods are ignored",
+			msgs: []*gtfsrt.FeedMessage{feed(
+				alertFixture{id: "past", effect: gtfsrt.Alert_NO_SERVICE, header: "Over", routes: []string{"A"}, start: unix - 7200, end: unix - 3600},
+				alertFixture{id: "future", effect: gtfsrt.Alert_NO_SERVICE, header: "Later", routes: []string{"A"}, start: unix + 3600},
+				alertFixture{id: "now", effect: gtfsrt.Alert_DETOUR, header: "Now", routes: []string{"A"}, start: unix - 60},
+			)},
+			want: map[string]string{"A": "now"},
+		},
+		{
+			name: "blank route ids are skipped",
+			msgs: []*gtfsrt.FeedMessage{feed(
+				alertFixture{id: "x", effect: gtfsrt.Alert_NO_SERVICE, header: "Station closed", routes: []string{" ", ""}},
+			)},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BestByLine(tt.msgs, now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d candidates, want %d: %+v", len(got), len(tt.want), got)
+			}
+			if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].LineID < got[j].LineID }) {
+				t.Errorf("candidates not sorted by line: %+v", got)
+			}
+			for _, c := range got {
+				if want := tt.want[c.LineID]; c.AlertID != want {
+					t.Errorf("line %s: alert %q, want %q", c.LineID, c.AlertID, want)
+				}
+				if c.Status != statusFromEffect(c.Effect) {
+					t.Errorf("line %s: status %q for effect %s", c.LineID, c.Status, c.Effect)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessorRun(t *testing.T) {
+	suspended := alertFixture{id: "s1", effect: gtfsrt.Alert_NO_SERVICE, header: "No A trains", routes: []string{"A"}}
+	delayed := alertFixture{id: "d1", effect: gtfsrt.Alert_SIGNIFICANT_DELAYS, header: "A trains delayed", routes: []string{"A"}}
+	fetchFailed := &MemorySource{Err: errors.New("timeout")}
+
+	type poll struct {
+		sources []FeedSource
+		want    []string // "line:new status" for each transition
+	}
+	tests := []struct {
+		name  string
+		polls []poll
+		final map[string]string
+	}{
+		{
+			name: "new alert then unchanged",
+			polls: []poll{
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}, want: []string{"A:No Service"}},
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}},
+			},
+			final: map[string]string{"A": "No Service"},
+		},
+		{
+			name: "content change is an update",
+			polls: []poll{
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}, want: []string{"A:No Service"}},
+				{sources: []FeedSource{&MemorySource{Msg: feed(delayed)}}, want: []string{"A:Delays"}},
+			},
+			final: map[string]string{"A": "Delays"},
+		},
+		{
+			name: "cleared alert resolves the line",
+			polls: []poll{
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}, want: []string{"A:No Service"}},
+				{sources: []FeedSource{&MemorySource{Msg: feed()}}, want: []string{"A:" + db.StatusGoodService}},
+				{sources: []FeedSource{&MemorySource{Msg: feed()}}},
+			},
+			final: map[string]string{"A": db.StatusGoodService},
+		},
+		{
+			name: "failed fetch does not resolve",
+			polls: []poll{
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}, want: []string{"A:No Service"}},
+				{sources: []FeedSource{&MemorySource{Msg: feed()}, fetchFailed}},
+			},
+			final: map[string]string{"A": "No Service"},
+		},
+		{
+			name: "alert comes back after resolution",
+			polls: []poll{
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}, want: []string{"A:No Service"}},
+				{sources: []FeedSource{&MemorySource{Msg: feed()}}, want: []string{"A:" + db.StatusGoodService}},
+				{sources: []FeedSource{&MemorySource{Msg: feed(suspended)}}, want: []string{"A:No Service"}},
+			},
+			final: map[string]string{"A": "No Service"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			database := openTestDB(t)
+			proc := NewProcessor(database)
+
+			at := time.Unix(1_700_000_000, 0)
+			for i, p := range tt.polls {
+				at = at.Add(5 * time.Minute)
+				proc.Now = func() time.Time { return at }
+
+				got, err := proc.Run(ctx, p.sources)
+				if err != nil {
+					t.Fatalf("poll %d: %v", i, err)
+				}
+				if len(got) != len(p.want) {
+					t.Fatalf("poll %d: got %d transitions, want %d: %+v", i, len(got), len(p.want), got)
+				}
+				for j, tr := range got {
+					if s := tr.LineID + ":" + tr.NewStatus; s != p.want[j] {
+						t.Errorf("poll %d: transition %d is %s, want %s", i, j, s, p.want[j])
+					}
+					if !tr.At.Equal(at) {
+						t.Errorf("poll %d: transition at %v, want %v", i, tr.At, at)
+					}
+				}
+			}
+
+			for line, want := range tt.final {
+				ls, err := database.Lines().Get(ctx, line)
+				if err != nil {
+					t.Fatalf("get line %s: %v", line, err)
+				}
+				if ls.Status != want {
+					t.Errorf("line %s is %q, want %q", line, ls.Status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessorRecordsRawPayloads(t *testing.T) {
+	src := t.TempDir()
+	payloads := make([][]byte, 2)
+	sources := make([]FeedSource, 0, len(payloads))
+	for i := range payloads {
+		b, err := proto.Marshal(feed(alertFixture{id: "x", effect: gtfsrt.Alert_DETOUR, header: "Detour", routes: []string{"F"}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A repeated header field is valid but merged away by a
+		// re-marshal, so it only survives if the bytes are copied as is.
+		b = append(b, 0x0a, 0x05, 0x0a, 0x03, '2', '.', '0')
+		payloads[i] = b
+		path := filepath.Join(src, fmt.Sprintf("feed%d.bin", i))
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, &FileSource{Path: path})
+	}
+
+	out := t.TempDir()
+	calls := 0
+	proc := NewProcessor(openTestDB(t))
+	proc.Recorder = &Recorder{Dir: out}
+	proc.Now = func() time.Time {
+		calls++
+		return time.Unix(1_700_000_000+int64(calls), 0)
+	}
+
+	if _, err := proc.Run(context.Background(), sources); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, skipped, err := LoadSnapshots(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 || len(groups) != 1 || len(groups[0].Sources) != len(payloads) {
+		t.Fatalf("want one poll of %d feeds, got %d groups (skipped %v)", len(payloads), len(groups), skipped)
+	}
+	for i, s := range groups[0].Sources {
+		got, err := os.ReadFile(s.(*FileSource).Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(payloads[i]) {
+			t.Errorf("feed %d: recorded bytes differ from the fetched payload", i)
+		}
+	}
+}
+
+// TestProcessorQueuesResolutions pins down that a resolution is delivered
+// on every channel, just like the alert that opened the incident.
+func TestProcessorResolutions(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+
+	u, err := database.Users().Upsert(ctx, "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Subscriptions().ReplaceForUser(ctx, u.ID, []string{"A"}, db.Channels{DM: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Webhooks().Create(ctx, u.ID, "https://example.com/hook", []string{"A"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Guilds().SetChannel(ctx, db.GuildChannel{GuildID: "g", ChannelID: "c", AllLines: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	proc := NewProcessor(database)
+	suspended := alertFixture{id: "s1", effect: gtfsrt.Alert_NO_SERVICE, header: "No A trains", routes: []string{"A"}}
+	if _, err := proc.Process(ctx, []*gtfsrt.FeedMessage{feed(suspended)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proc.Process(ctx, []*gtfsrt.FeedMessage{feed()}); err != nil {
+		t.Fatal(err)
+	}
+
+	dms, err := database.Notifications().Pending(ctx, db.ChannelDM, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dms) != 1 || *dms[0].NewStatus != "No Service" {
+		t.Fatalf("queued DMs = %+v, want only the alert", dms)
+	}
+
+	// The resolution is recorded and goes to guild threads, but not to
+	// subscribers or webhooks.
+	ls, err := database.Lines().Get(ctx, "A")
+	if err != nil || ls.Status != db.StatusGoodService {
+		t.Fatalf("line A = %+v, %v; want Good Service", ls, err)
+	}
+	for table, want := range map[string]int{"webhook_deliveries": 1, "guild_deliveries": 2} {
+		var n int
+		if err := database.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("%s has %d rows, want %d", table, n, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package poller
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotGroup is one recorded poll: every feed saved at the same instant.
+type SnapshotGroup struct {
+	At      time.Time
+	Sources []FeedSource
+}
+
+type snapshotFile struct {
+	at    int64
+	index int
+	path  string
+}
+
+// LoadSnapshots reads a directory of <unix seconds>-<feed index>.pb files and
+// groups them into polls in chronological order. Files that don't follow the
+// naming scheme are returned in skipped.
+func LoadSnapshots(dir string) (groups []SnapshotGroup, skipped []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := make([]snapshotFile, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".pb" {
+			continue
+		}
+		at, idx, ok := parseSnapshotName(e.Name())
+		if !ok {
+			skipped = append(skipped, e.Name())
+			continue
+		}
+		files = append(files, snapshotFile{at: at, index: idx, path: filepath.Join(dir, e.Name())})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].at != files[j].at {
+			return files[i].at < files[j].at
+		}
+		return files[i].index < files[j].index
+	})
+
+	for _, f := range files {
+		if len(groups) == 0 || groups[len(groups)-1].At.Unix() != f.at {
+			groups = append(groups, SnapshotGroup{At: time.Unix(f.at, 0)})
+		}
+		g := &groups[len(groups)-1]
+		g.Sources = append(g.Sources, &FileSource{Path: f.path})
+	}
+
+	return groups, skipped, nil
+}
+
+func parseSnapshotName(name string) (int64, int, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	tsPart, idxPart, ok := strings.Cut(base, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	at, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	idx, err := strconv.Atoi(idxPart)
+	if err != nil {
+		return 0, 0, false
+	}
+	return at, idx, true
+}
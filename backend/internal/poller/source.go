@@ -0,0 +1,128 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	gtfsrt "github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// FeedSource yields one GTFS-realtime feed message per call.
+type FeedSource interface {
+	Name() string
+	Fetch(ctx context.Context) (*gtfsrt.FeedMessage, error)
+}
+
+// RawSource is a FeedSource that can also hand back the bytes it decoded,
+// so they can be recorded as they arrived.
+type RawSource interface {
+	FeedSource
+	FetchRaw(ctx context.Context) (*gtfsrt.FeedMessage, []byte, error)
+}
+
+type HTTPSource struct {
+	Client *http.Client
+	URL    string
+}
+
+func (s *HTTPSource) Name() string { return s.URL }
+
+func (s *HTTPSource) Fetch(ctx context.Context) (*gtfsrt.FeedMessage, error) {
+	msg, _, err := s.FetchRaw(ctx)
+	return msg, err
+}
+
+func (s *HTTPSource) FetchRaw(ctx context.Context) (*gtfsrt.FeedMessage, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		snippet := string(b)
+		if len(snippet) > 200 {
+			snippet = snippet[:200]
+		}
+		return nil, nil, fmt.Errorf("HTTP %d from %s: %q", resp.StatusCode, s.URL, snippet)
+	}
+
+	var msg gtfsrt.FeedMessage
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal failed (content-type=%q bytes=%d): %w",
+			resp.Header.Get("Content-Type"), len(b), err)
+	}
+	return &msg, b, nil
+}
+
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Name() string { return s.Path }
+
+func (s *FileSource) Fetch(ctx context.Context) (*gtfsrt.FeedMessage, error) {
+	msg, _, err := s.FetchRaw(ctx)
+	return msg, err
+}
+
+func (s *FileSource) FetchRaw(ctx context.Context) (*gtfsrt.FeedMessage, []byte, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var msg gtfsrt.FeedMessage
+	if err := proto.Unmarshal(b, &msg); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal %s: %w", s.Path, err)
+	}
+	return &msg, b, nil
+}
+
+type MemorySource struct {
+	Msg *gtfsrt.FeedMessage
+	Err error
+}
+
+func (s *MemorySource) Name() string { return "memory" }
+
+func (s *MemorySource) Fetch(ctx context.Context) (*gtfsrt.FeedMessage, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	return s.Msg, nil
+}
+
+// Recorder saves fetched feeds into Dir using the snapshot naming scheme
+// understood by LoadSnapshots. Every feed from one poll is stamped with the
+// same time so a replay sees them as one group.
+type Recorder struct {
+	Dir string
+}
+
+// Save writes raw, the payload exactly as it was fetched, as feed index of
+// the poll taken at at.
+func (r *Recorder) Save(at time.Time, index int, raw []byte) error {
+	name := fmt.Sprintf("%d-%d.pb", at.Unix(), index)
+	return os.WriteFile(filepath.Join(r.Dir, name), raw, 0o644)
+}
@@ -0,0 +1,221 @@
+// Package push delivers notifications to phones through ntfy topics or any
+// HTTP endpoint that accepts a small JSON payload.
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/notify"
+	"github.com/Ryley4/NYCTcord/backend/internal/poller"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+// ntfy priorities.
+const (
+	PriorityMin     = 1
+	PriorityLow     = 2
+	PriorityDefault = 3
+	PriorityHigh    = 4
+	PriorityUrgent  = 5
+)
+
+// Message is also the JSON body sent to generic HTTP destinations.
+type Message struct {
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Tags     []string `json:"tags"`
+	Click    string   `json:"click,omitempty"`
+	LineID   string   `json:"line_id"`
+	Effect   string   `json:"effect,omitempty"`
+}
+
+// Priority maps an effect to an ntfy priority: NO_SERVICE is urgent,
+// reduced service and delays are high, and resolutions (no effect) are low.
+func Priority(effect string) int {
+	if effect == "" {
+		return PriorityLow
+	}
+	switch rank := poller.SeverityRank(effect); {
+	case rank >= 5:
+		return PriorityUrgent
+	case rank >= 3:
+		return PriorityHigh
+	default:
+		return PriorityDefault
+	}
+}
+
+// FrontendURLFromEnv is where push notifications link to, from
+// NYCTCORD_FRONTEND_URL.
+func FrontendURLFromEnv() string {
+	if v := strings.TrimSpace(os.Getenv("NYCTCORD_FRONTEND_URL")); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// BuildMessage formats a rendered notification for push. Tags carry the
+// line (so ntfy clients can filter on it) and an emoji for the severity.
+func BuildMessage(n db.PendingNotification, r templates.Rendered, frontendURL string) Message {
+	line := strings.ToUpper(strings.TrimSpace(n.LineID))
+	effect := deref(n.Effect)
+
+	priority := Priority(effect)
+	tags := []string{}
+	switch {
+	case priority == PriorityUrgent:
+		tags = append(tags, "rotating_light")
+	case priority == PriorityHigh:
+		tags = append(tags, "warning")
+	case effect == "":
+		tags = append(tags, "white_check_mark")
+	}
+	if line != "" {
+		tags = append(tags, "line-"+strings.ToLower(line))
+	}
+
+	msg := Message{
+		Title:    r.Title,
+		Message:  truncate(r.Body, 4096),
+		Priority: priority,
+		Tags:     tags,
+		LineID:   line,
+		Effect:   effect,
+	}
+	if frontendURL != "" {
+		msg.Click = frontendURL + "/?line=" + url.QueryEscape(line)
+	}
+	return msg
+}
+
+type Client struct {
+	// HTTP sends the requests. Destination URLs are user-supplied, so the
+	// default is safehttp's client, which won't reach internal addresses.
+	HTTP *http.Client
+}
+
+func NewClient() *Client {
+	return &Client{HTTP: safehttp.Default}
+}
+
+// Send delivers msg to dest. ntfy destinations get the plain-text body with
+// ntfy's Title/Priority/Tags/Click headers; http destinations get Message
+// as JSON. It returns the message id ntfy assigned, if any.
+func (c *Client) Send(ctx context.Context, dest db.PushDestination, msg Message) (string, error) {
+	var req *http.Request
+	var err error
+
+	switch dest.Kind {
+	case db.PushNtfy:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, dest.URL, strings.NewReader(msg.Message))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		// ntfy decodes RFC 2047 encoded headers, so titles can be UTF-8.
+		req.Header.Set("Title", mime.QEncoding.Encode("utf-8", msg.Title))
+		req.Header.Set("Priority", strconv.Itoa(msg.Priority))
+		if len(msg.Tags) > 0 {
+			req.Header.Set("Tags", strings.Join(msg.Tags, ","))
+		}
+		if msg.Click != "" {
+			req.Header.Set("Click", msg.Click)
+		}
+	case db.PushHTTP:
+		body, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, dest.URL, bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	default:
+		return "", fmt.Errorf("push: unknown destination kind %q", dest.Kind)
+	}
+
+	req.Header.Set("User-Agent", "NYCTcord-Push/1")
+	if token := deref(dest.Token); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = safehttp.Default
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("push: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// ntfy answers with the published message as JSON.
+	var out struct {
+		ID string `json:"id"`
+	}
+	if dest.Kind == db.PushNtfy && json.Unmarshal(body, &out) == nil {
+		return out.ID, nil
+	}
+	return "", nil
+}
+
+// Notifier pushes notifications to each user's push destination.
+type Notifier struct {
+	DB          *db.DB
+	Client      *Client
+	FrontendURL string
+	Templates   *templates.Set
+}
+
+func (n *Notifier) Send(ctx context.Context, note notify.Notification) (notify.Receipt, error) {
+	dest, err := n.DB.PushDestinations().Get(ctx, note.UserID)
+	if err == db.ErrNotFound {
+		return notify.Receipt{}, errors.New("no push destination configured")
+	}
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	r, err := n.Templates.Notification(note)
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	id, err := n.Client.Send(ctx, dest, BuildMessage(note, r, n.FrontendURL))
+	return notify.Receipt{ExternalID: id}, err
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
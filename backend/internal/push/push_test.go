@@ -0,0 +1,170 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+func ptr(s string) *string { return &s }
+
+func TestPriority(t *testing.T) {
+	tests := []struct {
+		effect string
+		want   int
+	}{
+		{"NO_SERVICE", PriorityUrgent},
+		{"REDUCED_SERVICE", PriorityHigh},
+		{"SIGNIFICANT_DELAYS", PriorityHigh},
+		{"DETOUR", PriorityDefault},
+		{"MODIFIED_SERVICE", PriorityDefault},
+		{"OTHER_EFFECT", PriorityDefault},
+		{"", PriorityLow},
+	}
+	for _, tt := range tests {
+		if got := Priority(tt.effect); got != tt.want {
+			t.Errorf("Priority(%q) = %d, want %d", tt.effect, got, tt.want)
+		}
+	}
+	if PriorityUrgent != 5 {
+		t.Errorf("PriorityUrgent = %d; ntfy's max priority is 5", PriorityUrgent)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		effect   *string
+		priority int
+		tags     []string
+	}{
+		{"no service", ptr("NO_SERVICE"), PriorityUrgent, []string{"rotating_light", "line-f"}},
+		{"delays", ptr("SIGNIFICANT_DELAYS"), PriorityHigh, []string{"warning", "line-f"}},
+		{"detour", ptr("DETOUR"), PriorityDefault, []string{"line-f"}},
+		{"resolved", nil, PriorityLow, []string{"white_check_mark", "line-f"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := db.PendingNotification{LineID: " f ", Effect: tt.effect}
+			msg := BuildMessage(n, templates.Rendered{Title: "F", Body: "body"}, "https://nyctcord.test")
+			if msg.Priority != tt.priority || !reflect.DeepEqual(msg.Tags, tt.tags) {
+				t.Errorf("priority %d tags %v, want %d %v", msg.Priority, msg.Tags, tt.priority, tt.tags)
+			}
+			if msg.LineID != "F" || msg.Click != "https://nyctcord.test/?line=F" {
+				t.Errorf("line %q click %q", msg.LineID, msg.Click)
+			}
+		})
+	}
+
+	msg := BuildMessage(db.PendingNotification{LineID: "A"}, templates.Rendered{Body: strings.Repeat("x", 5000)}, "")
+	if msg.Click != "" || len([]rune(msg.Message)) != 4096 {
+		t.Errorf("click %q, message %d runes; want no click and 4096 runes", msg.Click, len([]rune(msg.Message)))
+	}
+}
+
+func TestSendNtfy(t *testing.T) {
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got, body = r, string(b)
+		io.WriteString(w, `{"id":"sPs71M8A2T","topic":"nyct"}`)
+	}))
+	defer srv.Close()
+
+	msg := BuildMessage(
+		db.PendingNotification{LineID: "F", Effect: ptr("NO_SERVICE")},
+		templates.Rendered{Title: "F: no service — Jay St", Body: "No trains between Jay St and Church Av."},
+		"https://nyctcord.test",
+	)
+	c := &Client{HTTP: srv.Client()}
+	id, err := c.Send(context.Background(), db.PushDestination{Kind: db.PushNtfy, URL: srv.URL + "/nyct", Token: ptr("tk_1")}, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "sPs71M8A2T" {
+		t.Errorf("id = %q, want ntfy's message id", id)
+	}
+
+	if got.URL.Path != "/nyct" || body != msg.Message {
+		t.Errorf("posted %q to %s", body, got.URL.Path)
+	}
+	title, err := new(mime.WordDecoder).DecodeHeader(got.Header.Get("Title"))
+	if err != nil || title != msg.Title {
+		t.Errorf("Title = %q (%v), want %q", title, err, msg.Title)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":  "text/plain; charset=utf-8",
+		"Priority":      "5",
+		"Tags":          "rotating_light,line-f",
+		"Click":         "https://nyctcord.test/?line=F",
+		"Authorization": "Bearer tk_1",
+	} {
+		if v := got.Header.Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+}
+
+func TestSendHTTP(t *testing.T) {
+	var got Message
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		io.WriteString(w, `{"id":"ignored"}`)
+	}))
+	defer srv.Close()
+
+	msg := BuildMessage(db.PendingNotification{LineID: "G", Effect: ptr("SIGNIFICANT_DELAYS")}, templates.Rendered{Title: "G", Body: "late"}, "")
+	c := &Client{HTTP: srv.Client()}
+	id, err := c.Send(context.Background(), db.PushDestination{Kind: db.PushHTTP, URL: srv.URL}, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "" {
+		t.Errorf("id = %q; only ntfy ids are read", id)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("posted %+v, want %+v", got, msg)
+	}
+	if auth != "" {
+		t.Errorf("Authorization = %q without a token", auth)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden topic", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	c := &Client{HTTP: srv.Client()}
+	_, err := c.Send(context.Background(), db.PushDestination{Kind: db.PushNtfy, URL: srv.URL + "/t"}, Message{})
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden: forbidden topic") {
+		t.Errorf("err = %v, want the status and body", err)
+	}
+
+	if _, err := c.Send(context.Background(), db.PushDestination{Kind: "carrier-pigeon", URL: srv.URL}, Message{}); err == nil {
+		t.Error("unknown kind accepted")
+	}
+
+	// The default client won't reach a loopback destination.
+	_, err = NewClient().Send(context.Background(), db.PushDestination{Kind: db.PushNtfy, URL: srv.URL + "/t"}, Message{})
+	if !errors.Is(err, safehttp.ErrForbiddenAddress) {
+		t.Errorf("default client: err = %v, want ErrForbiddenAddress", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package safehttp builds HTTP clients for requests to URLs that users
+// supply, such as webhooks and push endpoints. The clients refuse to
+// connect to loopback, private, link-local and other non-public addresses,
+// so a registered URL can't be used to reach services on the host or its
+// network.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a request would connect to an
+// address that isn't publicly routable.
+var ErrForbiddenAddress = errors.New("safehttp: destination address not allowed")
+
+// blockedPrefixes are non-public ranges that netip's predicates don't
+// cover. The two IPv6 translation prefixes can embed any IPv4 address,
+// private ones included.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network" (RFC 791)
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT (RFC 6598)
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking (RFC 2544)
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64 (RFC 6052)
+	netip.MustParsePrefix("2002::/16"),     // 6to4 (RFC 3056)
+}
+
+// Allowed reports whether ip is a public unicast address.
+func Allowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	switch {
+	case !ip.IsValid(),
+		ip.IsUnspecified(),
+		ip.IsLoopback(),
+		ip.IsPrivate(),
+		ip.IsLinkLocalUnicast(),
+		ip.IsLinkLocalMulticast(),
+		ip.IsInterfaceLocalMulticast(),
+		ip.IsMulticast():
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// control runs after DNS resolution and before connecting, so it sees the
+// address actually dialled. That covers hostnames resolving to internal
+// addresses and redirects to them alike.
+func control(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	if !Allowed(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ap.Addr())
+	}
+	return nil
+}
+
+// Default is the client shared by everything that posts to user-supplied
+// URLs.
+var Default = NewClient(10 * time.Second)
+
+// NewClient returns a client that only connects to public addresses. It
+// ignores proxy environment variables, since a proxy would make the
+// dial-time check meaningless, and gives up after a few redirects.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          20,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return errors.New("safehttp: too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// CheckURL rejects URLs that obviously point inside the network: localhost
+// and literal non-public IPs. It is for early feedback when a URL is
+// registered; hostnames are only checked when the client dials them.
+func CheckURL(u *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !Allowed(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package safehttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::6810:85e5", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"198.18.0.1", false},
+		{"198.19.255.254", false},
+		{"198.20.0.1", true},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::808:808", false},
+		{"2002:a00:1::1", false},
+		{"2002:c0a8:101::", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:8.8.8.8", true},
+	}
+	for _, tt := range tests {
+		if got := Allowed(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/x", true},
+		{"https://ntfy.sh/topic", true},
+		{"http://localhost:8080/", false},
+		{"http://LOCALHOST./", false},
+		{"http://api.localhost/", false},
+		{"http://127.0.0.1/", false},
+		{"http://[::1]:9000/", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://8.8.8.8/", true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = CheckURL(u)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckURL(%s) = %v, want ok=%v", tt.url, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckURL(%s) error %v is not ErrForbiddenAddress", tt.url, err)
+		}
+	}
+}
+
+func TestClientRefusesLoopback(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	resp, err := NewClient(5 * time.Second).Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request to loopback server succeeded")
+	}
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("err = %v, want ErrForbiddenAddress", err)
+	}
+	if hit {
+		t.Error("server received the request")
+	}
+}
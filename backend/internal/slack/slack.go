@@ -0,0 +1,220 @@
+// Package slack posts notifications to Slack, either through an incoming
+// webhook or chat.postMessage with a bot token.
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/lines"
+	"github.com/Ryley4/NYCTcord/backend/internal/notify"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+const DefaultBaseURL = "https://slack.com/api"
+
+// Message is a chat.postMessage / incoming webhook body. Blocks sit inside
+// an attachment so the line colour shows as the sidebar, like an embed.
+type Message struct {
+	Channel     string       `json:"channel,omitempty"`
+	Text        string       `json:"text"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+type Attachment struct {
+	Color  string  `json:"color,omitempty"`
+	Blocks []Block `json:"blocks"`
+}
+
+type Block struct {
+	Type     string `json:"type"`
+	Text     *Text  `json:"text,omitempty"`
+	Fields   []Text `json:"fields,omitempty"`
+	Elements []Text `json:"elements,omitempty"`
+}
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// BuildMessage lays out a rendered notification the same way the Discord
+// embed does: title as header, body as description, effect as a field and
+// the footer as context.
+func BuildMessage(n db.PendingNotification, r templates.Rendered) Message {
+	line := strings.ToUpper(strings.TrimSpace(n.LineID))
+
+	blocks := []Block{
+		{Type: "header", Text: &Text{Type: "plain_text", Text: truncate(r.Title, 150)}},
+		{Type: "section", Text: &Text{Type: "mrkdwn", Text: escape(truncate(r.Body, 3000))}},
+	}
+	if v := deref(n.Effect); v != "" {
+		blocks = append(blocks, Block{Type: "section", Fields: []Text{{Type: "mrkdwn", Text: "*Effect*\n" + escape(v)}}})
+	}
+	if r.Footer != "" {
+		blocks = append(blocks, Block{Type: "context", Elements: []Text{{Type: "mrkdwn", Text: escape(r.Footer)}}})
+	}
+
+	return Message{
+		Text: truncate(r.Title, 150),
+		Attachments: []Attachment{{
+			Color:  fmt.Sprintf("#%06X", lines.Color(line)),
+			Blocks: blocks,
+		}},
+	}
+}
+
+type Client struct {
+	// HTTP sends the requests. Incoming webhook URLs are user-supplied, so
+	// NewClient uses a safehttp client that won't reach internal addresses.
+	HTTP *http.Client
+	// BaseURL is the Web API root, overridable to point at a fake Slack.
+	BaseURL string
+}
+
+func NewClient() *Client {
+	return &Client{HTTP: safehttp.Default, BaseURL: DefaultBaseURL}
+}
+
+// Send posts msg to dest, preferring the incoming webhook if one is set.
+// Posts made with a bot token return the message's "channel:ts" id;
+// incoming webhooks don't report one.
+func (c *Client) Send(ctx context.Context, dest db.SlackDestination, msg Message) (string, error) {
+	if url := deref(dest.WebhookURL); url != "" {
+		return "", c.postWebhook(ctx, url, msg)
+	}
+	if token := deref(dest.BotToken); token != "" {
+		msg.Channel = deref(dest.ChannelID)
+		if msg.Channel == "" {
+			return "", errors.New("slack: bot token destination has no channel")
+		}
+		return c.postMessage(ctx, token, msg)
+	}
+	return "", errors.New("slack: destination has neither webhook URL nor bot token")
+}
+
+func (c *Client) postWebhook(ctx context.Context, url string, msg Message) error {
+	resp, err := c.post(ctx, url, "", msg)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Incoming webhooks answer 200 "ok" or an error status with a short
+	// plain-text reason.
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack: webhook %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (c *Client) postMessage(ctx context.Context, token string, msg Message) (string, error) {
+	base := strings.TrimRight(c.BaseURL, "/")
+	if base == "" {
+		base = DefaultBaseURL
+	}
+
+	resp, err := c.post(ctx, base+"/chat.postMessage", token, msg)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", fmt.Errorf("slack: rate limited, retry after %ss", resp.Header.Get("Retry-After"))
+	}
+
+	// The Web API answers 200 with {"ok": false, "error": "..."} on failure.
+	var out struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error"`
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return "", fmt.Errorf("slack: chat.postMessage %s: %w", resp.Status, err)
+	}
+	if !out.OK {
+		return "", fmt.Errorf("slack: chat.postMessage: %s", out.Error)
+	}
+	if out.TS == "" {
+		return "", nil
+	}
+	return out.Channel + ":" + out.TS, nil
+}
+
+func (c *Client) post(ctx context.Context, url, token string, msg Message) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = safehttp.Default
+	}
+	return client.Do(req)
+}
+
+// Notifier delivers notifications to each user's Slack destination.
+type Notifier struct {
+	DB        *db.DB
+	Client    *Client
+	Templates *templates.Set
+}
+
+func (n *Notifier) Send(ctx context.Context, note notify.Notification) (notify.Receipt, error) {
+	dest, err := n.DB.SlackDestinations().Get(ctx, note.UserID)
+	if err == db.ErrNotFound {
+		return notify.Receipt{}, errors.New("no slack destination configured")
+	}
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	r, err := n.Templates.Notification(note)
+	if err != nil {
+		return notify.Receipt{}, err
+	}
+
+	id, err := n.Client.Send(ctx, dest, BuildMessage(note, r))
+	return notify.Receipt{ExternalID: id}, err
+}
+
+// escape applies Slack's mrkdwn escaping for &, < and >.
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
@@ -0,0 +1,226 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/templates"
+)
+
+func ptr(s string) *string { return &s }
+
+func TestBuildMessage(t *testing.T) {
+	n := db.PendingNotification{LineID: " f ", Effect: ptr("SIGNIFICANT_DELAYS")}
+	r := templates.Rendered{
+		Title:  strings.Repeat("T", 200),
+		Body:   "Trains run <slowly> & late",
+		Footer: "nyctcord <F>",
+	}
+	msg := BuildMessage(n, r)
+
+	if got := []rune(msg.Text); len(got) != 150 || got[149] != '…' {
+		t.Errorf("Text is %d runes ending %q, want 150 ending in …", len(got), got[len(got)-1])
+	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(msg.Attachments))
+	}
+	att := msg.Attachments[0]
+	if att.Color != "#EB6800" {
+		t.Errorf("Color = %q, want the F line orange #EB6800", att.Color)
+	}
+
+	want := []struct {
+		typ, text string
+	}{
+		{"header", msg.Text},
+		{"section", "Trains run &lt;slowly&gt; &amp; late"},
+		{"section", "*Effect*\nSIGNIFICANT_DELAYS"},
+		{"context", "nyctcord &lt;F&gt;"},
+	}
+	if len(att.Blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %+v", len(att.Blocks), len(want), att.Blocks)
+	}
+	for i, w := range want {
+		b := att.Blocks[i]
+		var text string
+		switch {
+		case b.Text != nil:
+			text = b.Text.Text
+		case len(b.Fields) == 1:
+			text = b.Fields[0].Text
+		case len(b.Elements) == 1:
+			text = b.Elements[0].Text
+		}
+		if b.Type != w.typ || text != w.text {
+			t.Errorf("block %d = %s %q, want %s %q", i, b.Type, text, w.typ, w.text)
+		}
+	}
+	if att.Blocks[0].Text.Type != "plain_text" {
+		t.Errorf("header text type = %q, want plain_text", att.Blocks[0].Text.Type)
+	}
+
+	// No effect and no footer: just the header and the body.
+	msg = BuildMessage(db.PendingNotification{LineID: "G"}, templates.Rendered{Title: "t", Body: "b"})
+	if n := len(msg.Attachments[0].Blocks); n != 2 {
+		t.Errorf("got %d blocks without effect or footer, want 2", n)
+	}
+}
+
+// fakeSlack serves chat.postMessage and an incoming webhook, recording
+// what it receives.
+type fakeSlack struct {
+	t       *testing.T
+	handler func(w http.ResponseWriter, msg Message)
+	auth    string
+	got     []Message
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		f.t.Errorf("Content-Type = %q, want JSON", ct)
+	}
+	body, _ := io.ReadAll(r.Body)
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		f.t.Errorf("decode body: %v", err)
+	}
+	f.auth = r.Header.Get("Authorization")
+	f.got = append(f.got, msg)
+	f.handler(w, msg)
+}
+
+func newFake(t *testing.T, handler func(w http.ResponseWriter, msg Message)) (*fakeSlack, *Client, string) {
+	t.Helper()
+	fake := &fakeSlack{t: t, handler: handler}
+	mux := http.NewServeMux()
+	mux.Handle("/api/chat.postMessage", fake)
+	mux.Handle("/hooks/T1/B1/x", fake)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return fake, &Client{HTTP: srv.Client(), BaseURL: srv.URL + "/api"}, srv.URL + "/hooks/T1/B1/x"
+}
+
+func TestSendBotToken(t *testing.T) {
+	fake, c, _ := newFake(t, func(w http.ResponseWriter, msg Message) {
+		io.WriteString(w, `{"ok":true,"channel":"C123","ts":"1700000000.000100"}`)
+	})
+
+	dest := db.SlackDestination{BotToken: ptr("xoxb-1"), ChannelID: ptr("C123")}
+	msg := BuildMessage(db.PendingNotification{LineID: "A"}, templates.Rendered{Title: "A delays", Body: "b"})
+	id, err := c.Send(context.Background(), dest, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "C123:1700000000.000100" {
+		t.Errorf("id = %q, want channel:ts", id)
+	}
+	if fake.auth != "Bearer xoxb-1" {
+		t.Errorf("Authorization = %q", fake.auth)
+	}
+	if got := fake.got[0]; got.Channel != "C123" || got.Text != "A delays" || len(got.Attachments) != 1 || got.Attachments[0].Color != "#0062CF" {
+		t.Errorf("posted %+v", got)
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	fake, c, hook := newFake(t, func(w http.ResponseWriter, msg Message) {
+		io.WriteString(w, "ok")
+	})
+
+	// The webhook wins when both are set, and posts without a token.
+	dest := db.SlackDestination{WebhookURL: &hook, BotToken: ptr("xoxb-1"), ChannelID: ptr("C123")}
+	id, err := c.Send(context.Background(), dest, Message{Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "" {
+		t.Errorf("id = %q, want none for webhooks", id)
+	}
+	if fake.auth != "" || fake.got[0].Channel != "" {
+		t.Errorf("webhook post sent auth %q channel %q", fake.auth, fake.got[0].Channel)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook bool
+		handler func(w http.ResponseWriter, msg Message)
+		want    string
+	}{
+		{
+			name: "api error",
+			handler: func(w http.ResponseWriter, msg Message) {
+				io.WriteString(w, `{"ok":false,"error":"channel_not_found"}`)
+			},
+			want: "chat.postMessage: channel_not_found",
+		},
+		{
+			name: "rate limited",
+			handler: func(w http.ResponseWriter, msg Message) {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			want: "rate limited, retry after 30s",
+		},
+		{
+			name: "not json",
+			handler: func(w http.ResponseWriter, msg Message) {
+				http.Error(w, "upstream down", http.StatusBadGateway)
+			},
+			want: "chat.postMessage 502 Bad Gateway",
+		},
+		{
+			name:    "webhook error",
+			webhook: true,
+			handler: func(w http.ResponseWriter, msg Message) {
+				http.Error(w, "no_service", http.StatusNotFound)
+			},
+			want: "webhook 404 Not Found: no_service",
+		},
+		{
+			name:    "webhook rate limited",
+			webhook: true,
+			handler: func(w http.ResponseWriter, msg Message) {
+				http.Error(w, "rate_limited", http.StatusTooManyRequests)
+			},
+			want: "webhook 429 Too Many Requests: rate_limited",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, c, hook := newFake(t, tt.handler)
+			dest := db.SlackDestination{BotToken: ptr("xoxb-1"), ChannelID: ptr("C123")}
+			if tt.webhook {
+				dest = db.SlackDestination{WebhookURL: &hook}
+			}
+			_, err := c.Send(context.Background(), dest, Message{Text: "hi"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendBadDestination(t *testing.T) {
+	fake, c, _ := newFake(t, func(w http.ResponseWriter, msg Message) {})
+
+	for _, dest := range []db.SlackDestination{
+		{BotToken: ptr("xoxb-1")},
+		{BotToken: ptr("xoxb-1"), ChannelID: ptr("  ")},
+		{},
+	} {
+		if _, err := c.Send(context.Background(), dest, Message{Text: "hi"}); err == nil {
+			t.Errorf("Send(%+v) succeeded", dest)
+		}
+	}
+	if len(fake.got) != 0 {
+		t.Errorf("fake Slack received %d requests, want none", len(fake.got))
+	}
+}
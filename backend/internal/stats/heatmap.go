@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// HeatmapCell summarises one line over one bucket: how long it was
+// disrupted, and the status it spent the most time in.
+type HeatmapCell struct {
+	Start            time.Time `json:"start"`
+	Status           string    `json:"status"`
+	DisruptedSeconds int64     `json:"disrupted_seconds"`
+}
+
+// Heatmap folds intervals covering [from, to) into fixed-size buckets
+// starting at from. The last bucket may be shorter than bucket.
+func Heatmap(ivs []Interval, from, to time.Time, bucket time.Duration) []HeatmapCell {
+	cells := make([]HeatmapCell, 0, int(to.Sub(from)/bucket)+1)
+
+	i := 0
+	for start := from; start.Before(to); start = start.Add(bucket) {
+		end := start.Add(bucket)
+		if end.After(to) {
+			end = to
+		}
+
+		seconds := map[string]time.Duration{}
+		cell := HeatmapCell{Start: start, Status: db.StatusGoodService}
+
+		// Intervals are sorted and contiguous; skip the ones already past.
+		for i < len(ivs) && !ivs[i].End.After(start) {
+			i++
+		}
+		for j := i; j < len(ivs) && ivs[j].Start.Before(end); j++ {
+			s, e := ivs[j].Start, ivs[j].End
+			if s.Before(start) {
+				s = start
+			}
+			if e.After(end) {
+				e = end
+			}
+			d := e.Sub(s)
+			seconds[ivs[j].Status] += d
+			if db.IsDisrupted(ivs[j].Status) {
+				cell.DisruptedSeconds += int64(d / time.Second)
+			}
+		}
+
+		var most time.Duration
+		for status, d := range seconds {
+			if d > most || (d == most && status < cell.Status) {
+				most = d
+				cell.Status = status
+			}
+		}
+
+		cells = append(cells, cell)
+	}
+	return cells
+}
@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// Interval is a stretch of time a line spent in one status, started by the
+// transition AlertID (0 when it started before any transition on file).
+type Interval struct {
+	LineID  string    `json:"line_id"`
+	Status  string    `json:"status"`
+	Effect  *string   `json:"effect,omitempty"`
+	Header  *string   `json:"header,omitempty"`
+	AlertID int64     `json:"alert_id,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+func (iv Interval) Duration() time.Duration {
+	return iv.End.Sub(iv.Start)
+}
+
+// Intervals rebuilds the contiguous status intervals of one line over
+// [from, to) from its transitions. initial is the last transition before
+// from, if any; without it the line is assumed to start in good service.
+// transitions must be in the order they happened.
+func Intervals(lineID string, initial *db.Alert, transitions []db.Alert, from, to time.Time) []Interval {
+	cur := Interval{LineID: lineID, Status: db.StatusGoodService, Start: from}
+	if initial != nil {
+		cur = intervalFrom(*initial, from)
+	}
+
+	out := make([]Interval, 0, len(transitions)+1)
+	for _, a := range transitions {
+		if a.CreatedAt.Before(from) || !a.CreatedAt.Before(to) {
+			continue
+		}
+		cur.End = a.CreatedAt
+		if cur.End.After(cur.Start) {
+			out = append(out, cur)
+		}
+		cur = intervalFrom(a, a.CreatedAt)
+	}
+
+	cur.End = to
+	if cur.End.After(cur.Start) {
+		out = append(out, cur)
+	}
+	return out
+}
+
+func intervalFrom(a db.Alert, start time.Time) Interval {
+	status := db.StatusGoodService
+	if a.NewStatus != nil && *a.NewStatus != "" {
+		status = *a.NewStatus
+	}
+	return Interval{
+		LineID:  a.LineID,
+		Status:  status,
+		Effect:  a.Effect,
+		Header:  a.Header,
+		AlertID: a.ID,
+		Start:   start,
+	}
+}
+
+// LineIntervals loads what Intervals needs from the database for one line.
+func LineIntervals(ctx context.Context, database *db.DB, lineID string, from, to time.Time) ([]Interval, error) {
+	var initial *db.Alert
+	state, err := database.Alerts().StateAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := state[lineID]; ok {
+		initial = &a
+	}
+
+	transitions, err := database.Alerts().Between(ctx, lineID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return Intervals(lineID, initial, transitions, from, to), nil
+}
+
+// AllIntervals is LineIntervals for every line with history, keyed by line.
+func AllIntervals(ctx context.Context, database *db.DB, from, to time.Time) (map[string][]Interval, error) {
+	state, err := database.Alerts().StateAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	transitions, err := database.Alerts().Between(ctx, "", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	byLine := map[string][]db.Alert{}
+	for _, a := range transitions {
+		byLine[a.LineID] = append(byLine[a.LineID], a)
+	}
+	for lineID := range state {
+		if _, ok := byLine[lineID]; !ok {
+			byLine[lineID] = nil
+		}
+	}
+
+	out := make(map[string][]Interval, len(byLine))
+	for lineID, ts := range byLine {
+		var initial *db.Alert
+		if a, ok := state[lineID]; ok {
+			initial = &a
+		}
+		out[lineID] = Intervals(lineID, initial, ts, from, to)
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func transition(id int64, line, oldStatus, newStatus, effect string, at time.Time) db.Alert {
+	a := db.Alert{ID: id, LineID: line, OldStatus: &oldStatus, NewStatus: &newStatus, CreatedAt: at}
+	if effect != "" {
+		a.Effect = &effect
+	}
+	return a
+}
+
+func TestIntervals(t *testing.T) {
+	from := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	h := func(n int) time.Time { return from.Add(time.Duration(n) * time.Hour) }
+
+	delays := transition(1, "A", db.StatusGoodService, "Delays", "SIGNIFICANT_DELAYS", h(8))
+	cleared := transition(2, "A", "Delays", db.StatusGoodService, "", h(10))
+	before := transition(3, "A", "", "No Service", "NO_SERVICE", from.Add(-time.Hour))
+
+	type span struct {
+		status     string
+		start, end int
+	}
+	tests := []struct {
+		name        string
+		initial     *db.Alert
+		transitions []db.Alert
+		want        []span
+	}{
+		{"no history is good service", nil, nil, []span{{db.StatusGoodService, 0, 24}}},
+		{"incident inside the window", nil, []db.Alert{delays, cleared}, []span{
+			{db.StatusGoodService, 0, 8}, {"Delays", 8, 10}, {db.StatusGoodService, 10, 24},
+		}},
+		{"state carried in from before", &before, []db.Alert{cleared}, []span{
+			{"No Service", 0, 10}, {db.StatusGoodService, 10, 24},
+		}},
+		{"transitions outside the window are ignored", nil, []db.Alert{
+			transition(4, "A", "", "Delays", "", from.Add(-time.Minute)),
+			transition(5, "A", "", "Delays", "", to),
+		}, []span{{db.StatusGoodService, 0, 24}}},
+		{"transition at the window start", nil, []db.Alert{transition(6, "A", "", "Delays", "", from)}, []span{
+			{"Delays", 0, 24},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Intervals("A", tt.initial, tt.transitions, from, to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d intervals, want %d: %+v", len(got), len(tt.want), got)
+			}
+			var total time.Duration
+			for i, w := range tt.want {
+				iv := got[i]
+				if iv.Status != w.status || !iv.Start.Equal(h(w.start)) || !iv.End.Equal(h(w.end)) {
+					t.Errorf("interval %d = %s %v–%v, want %s %dh–%dh", i, iv.Status, iv.Start, iv.End, w.status, w.start, w.end)
+				}
+				total += iv.Duration()
+			}
+			if total != to.Sub(from) {
+				t.Errorf("intervals cover %v, want %v", total, to.Sub(from))
+			}
+		})
+	}
+}
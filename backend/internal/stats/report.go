@@ -0,0 +1,155 @@
+package stats
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+type LineStats struct {
+	LineID            string             `json:"line_id"`
+	From              string             `json:"from"`
+	To                string             `json:"to"`
+	HoursPerWeek      map[string]float64 `json:"hours_per_week"`
+	IncidentsByEffect map[string]int64   `json:"incidents_by_effect"`
+	Incidents         int64              `json:"incidents"`
+	ResolvedIncidents int64              `json:"resolved_incidents"`
+	MTTRMinutes       *float64           `json:"mttr_minutes"`
+	WorstDays         []DaySummary       `json:"worst_days"`
+	Daily             []DaySummary       `json:"daily,omitempty"`
+}
+
+// DaySummary is how one line did on one UTC day, in hours per status.
+type DaySummary struct {
+	Day            string             `json:"day"`
+	DisruptedHours float64            `json:"disrupted_hours"`
+	Hours          map[string]float64 `json:"hours"`
+	Incidents      int64              `json:"incidents"`
+}
+
+// Options for Report. From and To are UTC days, To exclusive.
+type Options struct {
+	LineID    string
+	From      time.Time
+	To        time.Time
+	WorstDays int
+	Daily     bool
+}
+
+// Report aggregates the daily rollups in [From, To) into per-line numbers.
+// It only reads rollups; the poller computes them with EnsureRollups, so
+// days it hasn't reached yet are missing from the totals.
+func Report(ctx context.Context, database *db.DB, opts Options) ([]LineStats, error) {
+	from, to := startOfDay(opts.From), startOfDay(opts.To)
+	if !from.Before(to) {
+		return []LineStats{}, nil
+	}
+
+	fromDay := from.Format(db.DayLayout)
+	lastDay := to.AddDate(0, 0, -1).Format(db.DayLayout)
+
+	statusDays, err := database.Stats().StatusDays(ctx, opts.LineID, fromDay, lastDay)
+	if err != nil {
+		return nil, err
+	}
+	incidentDays, err := database.Stats().IncidentDays(ctx, opts.LineID, fromDay, lastDay)
+	if err != nil {
+		return nil, err
+	}
+
+	weeks := to.Sub(from).Hours() / (24 * 7)
+
+	byLine := map[string]*LineStats{}
+	days := map[string]map[string]*DaySummary{}
+	get := func(lineID string) *LineStats {
+		if ls, ok := byLine[lineID]; ok {
+			return ls
+		}
+		ls := &LineStats{
+			LineID:            lineID,
+			From:              fromDay,
+			To:                to.Format(db.DayLayout),
+			HoursPerWeek:      map[string]float64{},
+			IncidentsByEffect: map[string]int64{},
+			WorstDays:         []DaySummary{},
+		}
+		byLine[lineID] = ls
+		days[lineID] = map[string]*DaySummary{}
+		return ls
+	}
+	getDay := func(lineID, day string) *DaySummary {
+		get(lineID)
+		if d, ok := days[lineID][day]; ok {
+			return d
+		}
+		d := &DaySummary{Day: day, Hours: map[string]float64{}}
+		days[lineID][day] = d
+		return d
+	}
+
+	for _, sd := range statusDays {
+		ls := get(sd.LineID)
+		hours := float64(sd.Seconds) / 3600
+		ls.HoursPerWeek[sd.Status] += hours / weeks
+
+		d := getDay(sd.LineID, sd.Day)
+		d.Hours[sd.Status] += hours
+		if db.IsDisrupted(sd.Status) {
+			d.DisruptedHours += hours
+		}
+	}
+
+	resolutionSeconds := map[string]int64{}
+	for _, inc := range incidentDays {
+		ls := get(inc.LineID)
+		if inc.Started > 0 {
+			effect := inc.Effect
+			if effect == "" {
+				effect = "UNKNOWN_EFFECT"
+			}
+			ls.IncidentsByEffect[effect] += inc.Started
+			ls.Incidents += inc.Started
+			getDay(inc.LineID, inc.Day).Incidents += inc.Started
+		}
+		ls.ResolvedIncidents += inc.Resolved
+		resolutionSeconds[inc.LineID] += inc.ResolutionSeconds
+	}
+
+	out := make([]LineStats, 0, len(byLine))
+	for lineID, ls := range byLine {
+		if ls.ResolvedIncidents > 0 {
+			m := float64(resolutionSeconds[lineID]) / float64(ls.ResolvedIncidents) / 60
+			ls.MTTRMinutes = &m
+		}
+
+		summaries := make([]DaySummary, 0, len(days[lineID]))
+		for _, d := range days[lineID] {
+			summaries = append(summaries, *d)
+		}
+
+		sort.Slice(summaries, func(i, j int) bool {
+			if summaries[i].DisruptedHours != summaries[j].DisruptedHours {
+				return summaries[i].DisruptedHours > summaries[j].DisruptedHours
+			}
+			return summaries[i].Day > summaries[j].Day
+		})
+		for _, d := range summaries {
+			if len(ls.WorstDays) >= opts.WorstDays || d.DisruptedHours == 0 {
+				break
+			}
+			ls.WorstDays = append(ls.WorstDays, d)
+		}
+
+		if opts.Daily {
+			sort.Slice(summaries, func(i, j int) bool { return summaries[i].Day < summaries[j].Day })
+			ls.Daily = summaries
+		}
+
+		out = append(out, *ls)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].LineID < out[j].LineID })
+	return out, nil
+}
@@ -0,0 +1,175 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// seedIncidents gives line A two incidents over three days starting on
+// day: two hours of delays on the first day, then a suspension from noon
+// on the second day until 06:00 on the third.
+func seedIncidents(t *testing.T, database *db.DB, day time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	for _, a := range []db.Alert{
+		transition(0, "A", "", "Delays", "SIGNIFICANT_DELAYS", day.Add(8*time.Hour)),
+		transition(0, "A", "Delays", db.StatusGoodService, "", day.Add(10*time.Hour)),
+		transition(0, "A", db.StatusGoodService, "No Service", "NO_SERVICE", day.Add(36*time.Hour)),
+		transition(0, "A", "No Service", db.StatusGoodService, "", day.Add(54*time.Hour)),
+	} {
+		if _, err := database.Alerts().Insert(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEnsureRollups(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	seedIncidents(t, database, day)
+
+	// Only completed days are rolled up.
+	if err := EnsureRollups(ctx, database, day.Add(50*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	done, err := database.Stats().RolledUpDays(ctx, "2025-01-01", "2025-01-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || !done["2025-01-06"] || !done["2025-01-07"] {
+		t.Fatalf("rolled up %v, want 2025-01-06 and 2025-01-07", done)
+	}
+
+	if err := EnsureRollups(ctx, database, day.AddDate(0, 0, 3)); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := database.Stats().StatusDays(ctx, "A", "2025-01-06", "2025-01-08")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hours := map[string]float64{}
+	for _, s := range statuses {
+		hours[s.Day+" "+s.Status] = float64(s.Seconds) / 3600
+	}
+	want := map[string]float64{
+		"2025-01-06 Delays":                  2,
+		"2025-01-06 " + db.StatusGoodService: 22,
+		"2025-01-07 No Service":              12,
+		"2025-01-07 " + db.StatusGoodService: 12,
+		"2025-01-08 No Service":              6,
+		"2025-01-08 " + db.StatusGoodService: 18,
+	}
+	if len(hours) != len(want) {
+		t.Errorf("status days = %v, want %v", hours, want)
+	}
+	for k, w := range want {
+		if hours[k] != w {
+			t.Errorf("%s = %vh, want %vh", k, hours[k], w)
+		}
+	}
+
+	incidents, err := database.Stats().IncidentDays(ctx, "A", "2025-01-06", "2025-01-08")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type key struct{ day, effect string }
+	got := map[key]db.DailyIncidents{}
+	for _, inc := range incidents {
+		got[key{inc.Day, inc.Effect}] = inc
+	}
+	if inc := got[key{"2025-01-06", "SIGNIFICANT_DELAYS"}]; inc.Started != 1 || inc.Resolved != 1 || inc.ResolutionSeconds != 2*3600 {
+		t.Errorf("day 1 delays = %+v", inc)
+	}
+	if inc := got[key{"2025-01-07", "NO_SERVICE"}]; inc.Started != 1 || inc.Resolved != 0 {
+		t.Errorf("day 2 suspension = %+v", inc)
+	}
+	// The resolution counts on the day it happens, against the effect
+	// that opened the incident.
+	if inc := got[key{"2025-01-08", "NO_SERVICE"}]; inc.Started != 0 || inc.Resolved != 1 || inc.ResolutionSeconds != 18*3600 {
+		t.Errorf("day 3 resolution = %+v", inc)
+	}
+}
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDB(t)
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	seedIncidents(t, database, day)
+
+	opts := Options{From: day, To: day.AddDate(0, 0, 3), WorstDays: 2, Daily: true}
+
+	// Report only reads rollups, it doesn't compute them.
+	if report, err := Report(ctx, database, opts); err != nil || len(report) != 0 {
+		t.Fatalf("report before rolling up = %+v, %v", report, err)
+	}
+	if err := EnsureRollups(ctx, database, opts.To); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Report(ctx, database, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].LineID != "A" {
+		t.Fatalf("report = %+v, want line A only", report)
+	}
+	ls := report[0]
+
+	weeks := 3.0 / 7
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if !near(ls.HoursPerWeek["Delays"], 2/weeks) || !near(ls.HoursPerWeek["No Service"], 18/weeks) {
+		t.Errorf("hours per week = %v", ls.HoursPerWeek)
+	}
+	if ls.Incidents != 2 || ls.ResolvedIncidents != 2 {
+		t.Errorf("incidents = %d resolved = %d, want 2 and 2", ls.Incidents, ls.ResolvedIncidents)
+	}
+	if ls.IncidentsByEffect["SIGNIFICANT_DELAYS"] != 1 || ls.IncidentsByEffect["NO_SERVICE"] != 1 {
+		t.Errorf("incidents by effect = %v", ls.IncidentsByEffect)
+	}
+	// (2h + 18h) / 2 incidents.
+	if ls.MTTRMinutes == nil || !near(*ls.MTTRMinutes, 600) {
+		t.Errorf("MTTR = %v, want 600 minutes", ls.MTTRMinutes)
+	}
+	if len(ls.WorstDays) != 2 || ls.WorstDays[0].Day != "2025-01-07" || ls.WorstDays[1].Day != "2025-01-08" {
+		t.Errorf("worst days = %+v", ls.WorstDays)
+	}
+	if len(ls.Daily) != 3 || ls.Daily[0].Day != "2025-01-06" || ls.Daily[2].Day != "2025-01-08" {
+		t.Errorf("daily = %+v", ls.Daily)
+	}
+
+	// Rolled-up days are frozen: pruning the log doesn't change them.
+	if _, err := database.Exec(`DELETE FROM alerts`); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Report(ctx, database, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].Incidents != 2 || !near(*again[0].MTTRMinutes, 600) {
+		t.Errorf("report changed after pruning: %+v", again)
+	}
+
+	if other, _ := Report(ctx, database, Options{LineID: "C", From: day, To: day.AddDate(0, 0, 3)}); len(other) != 0 {
+		t.Errorf("report for a quiet line = %+v", other)
+	}
+	if empty, _ := Report(ctx, database, Options{From: day, To: day}); len(empty) != 0 {
+		t.Errorf("empty range = %+v", empty)
+	}
+}
@@ -0,0 +1,132 @@
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// EnsureRollups computes daily rollups for every completed UTC day before
+// through that doesn't have them yet. Days are frozen once rolled up, so
+// pruning old alerts later doesn't change the numbers.
+func EnsureRollups(ctx context.Context, database *db.DB, through time.Time) error {
+	first, ok, err := database.Alerts().FirstCreatedAt(ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	start := startOfDay(first)
+	end := startOfDay(through)
+	if !start.Before(end) {
+		return nil
+	}
+
+	done, err := database.Stats().RolledUpDays(ctx, start.Format(db.DayLayout), end.AddDate(0, 0, -1).Format(db.DayLayout))
+	if err != nil {
+		return err
+	}
+
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		key := day.Format(db.DayLayout)
+		if done[key] {
+			continue
+		}
+
+		statuses, incidents, err := computeDay(ctx, database, day)
+		if err != nil {
+			return err
+		}
+
+		err = database.WithTx(ctx, func(tx *db.Tx) error {
+			return tx.Stats().SaveDay(ctx, key, statuses, incidents, time.Now())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func computeDay(ctx context.Context, database *db.DB, day time.Time) ([]db.DailyStatus, []db.DailyIncidents, error) {
+	key := day.Format(db.DayLayout)
+	from, to := day, day.AddDate(0, 0, 1)
+
+	byLine, err := AllIntervals(ctx, database, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	statuses := make([]db.DailyStatus, 0)
+	for lineID, ivs := range byLine {
+		seconds := map[string]int64{}
+		for _, iv := range ivs {
+			seconds[iv.Status] += int64(iv.Duration() / time.Second)
+		}
+		for status, secs := range seconds {
+			statuses = append(statuses, db.DailyStatus{Day: key, LineID: lineID, Status: status, Seconds: secs})
+		}
+	}
+
+	transitions, err := database.Alerts().Between(ctx, "", from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type incKey struct{ line, effect string }
+	incidents := map[incKey]*db.DailyIncidents{}
+	get := func(line string, effect *string) *db.DailyIncidents {
+		k := incKey{line: line}
+		if effect != nil {
+			k.effect = *effect
+		}
+		if inc, ok := incidents[k]; ok {
+			return inc
+		}
+		inc := &db.DailyIncidents{Day: key, LineID: k.line, Effect: k.effect}
+		incidents[k] = inc
+		return inc
+	}
+
+	for _, a := range transitions {
+		oldDisrupted := db.IsDisrupted(deref(a.OldStatus))
+		newDisrupted := db.IsDisrupted(deref(a.NewStatus))
+
+		switch {
+		case !oldDisrupted && newDisrupted:
+			get(a.LineID, a.Effect).Started++
+
+		case oldDisrupted && !newDisrupted:
+			// Resolutions count on the day they happen, against the
+			// effect of the transition that opened the incident.
+			start, err := database.Alerts().IncidentStart(ctx, a.LineID, a.ID)
+			if err == db.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			inc := get(a.LineID, start.Effect)
+			inc.Resolved++
+			inc.ResolutionSeconds += int64(a.CreatedAt.Sub(start.CreatedAt) / time.Second)
+		}
+	}
+
+	out := make([]db.DailyIncidents, 0, len(incidents))
+	for _, inc := range incidents {
+		out = append(out, *inc)
+	}
+	return statuses, out, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
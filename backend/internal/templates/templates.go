@@ -0,0 +1,343 @@
+// Package templates renders notification text with text/template. Every
+// channel and event kind has a template made of named sections: "title",
+// "body", "footer" and, for email, "subject".
+//
+// A template is assembled from layers, later ones redefining sections of
+// earlier ones:
+//
+//	default.tmpl
+//	<channel>/default.tmpl
+//	<kind>.tmpl
+//	<channel>/<kind>.tmpl
+//
+// Each layer is read from the built-in defaults and then from the override
+// directory (NYCTCORD_TEMPLATES_DIR), so an override file only needs to
+// define the sections it changes. Overrides are reloaded when their
+// modification times change.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+// Event kinds.
+const (
+	KindNew      = "new"
+	KindUpdate   = "update"
+	KindResolved = "resolved"
+)
+
+// ChannelGuild renders posts to Discord server channels, which are queued
+// in guild_deliveries rather than notifications.
+const ChannelGuild = "guild"
+
+var (
+	Kinds    = []string{KindNew, KindUpdate, KindResolved}
+	Channels = []string{db.ChannelDM, db.ChannelSlack, db.ChannelEmail, db.ChannelPush, ChannelGuild}
+)
+
+//go:embed defaults
+var defaults embed.FS
+
+// Data is what templates execute against.
+type Data struct {
+	Kind      string
+	Channel   string
+	Line      string
+	Header    string
+	Body      string
+	Effect    string
+	OldStatus string
+	NewStatus string
+	CreatedAt time.Time
+}
+
+// Rendered is the output of a template. Subject falls back to Title.
+type Rendered struct {
+	Subject string `json:"subject"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Footer  string `json:"footer"`
+}
+
+var funcs = template.FuncMap{
+	"default":  defaultString,
+	"truncate": truncate,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+}
+
+// KindOf classifies a transition: back to good service is a resolution,
+// leaving good service is a new alert, anything else is an update.
+func KindOf(oldStatus, newStatus *string) string {
+	switch {
+	case deref(newStatus) == db.StatusGoodService:
+		return KindResolved
+	case deref(oldStatus) == "" || deref(oldStatus) == db.StatusGoodService:
+		return KindNew
+	default:
+		return KindUpdate
+	}
+}
+
+func FromNotification(n db.PendingNotification) Data {
+	return Data{
+		Kind:      KindOf(n.OldStatus, n.NewStatus),
+		Channel:   n.ChannelType,
+		Line:      strings.ToUpper(strings.TrimSpace(n.LineID)),
+		Header:    deref(n.Header),
+		Body:      deref(n.Body),
+		Effect:    deref(n.Effect),
+		OldStatus: deref(n.OldStatus),
+		NewStatus: deref(n.NewStatus),
+		CreatedAt: n.CreatedAt,
+	}
+}
+
+func FromAlert(a db.Alert) Data {
+	return Data{
+		Kind:      KindOf(a.OldStatus, a.NewStatus),
+		Line:      strings.ToUpper(strings.TrimSpace(a.LineID)),
+		Header:    deref(a.Header),
+		Body:      deref(a.Body),
+		Effect:    deref(a.Effect),
+		OldStatus: deref(a.OldStatus),
+		NewStatus: deref(a.NewStatus),
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+// Set caches parsed templates. A nil *Set renders the built-in defaults.
+type Set struct {
+	// Dir holds override templates; empty means built-in only.
+	Dir string
+	// CheckEvery limits how often Dir is scanned for changes.
+	CheckEvery time.Duration
+
+	mu      sync.Mutex
+	cache   map[string]*template.Template
+	stamp   string
+	checked time.Time
+}
+
+var builtin = New("")
+
+func New(dir string) *Set {
+	return &Set{Dir: dir, CheckEvery: 2 * time.Second, cache: map[string]*template.Template{}}
+}
+
+// FromEnv returns a Set reading overrides from NYCTCORD_TEMPLATES_DIR.
+func FromEnv() *Set {
+	return New(strings.TrimSpace(os.Getenv("NYCTCORD_TEMPLATES_DIR")))
+}
+
+// Notification renders n with the template for its channel and kind.
+func (s *Set) Notification(n db.PendingNotification) (Rendered, error) {
+	d := FromNotification(n)
+	return s.Render(d.Channel, d.Kind, d)
+}
+
+func (s *Set) Render(channel, kind string, d Data) (Rendered, error) {
+	t, err := s.lookup(channel, kind)
+	if err != nil {
+		return Rendered{}, err
+	}
+	d.Channel, d.Kind = channel, kind
+	return execute(t, d)
+}
+
+// ErrNoSections is returned by Preview for source that doesn't define any
+// section. Text outside {{define}} is never rendered, in a preview or in an
+// override file.
+var ErrNoSections = errors.New(`templates: source defines no sections; wrap it in {{define "body"}}…{{end}} or another section`)
+
+var sections = []string{"title", "body", "footer", "subject"}
+
+// Preview renders d with src parsed on top of the usual layers, without
+// caching, so unsaved edits can be tried out.
+func (s *Set) Preview(channel, kind string, d Data, src string) (Rendered, error) {
+	if s == nil {
+		s = builtin
+	}
+	t, err := s.parse(channel, kind, s.Dir != "")
+	if err != nil {
+		return Rendered{}, err
+	}
+	if strings.TrimSpace(src) != "" {
+		p, err := template.New("preview").Funcs(funcs).Parse(src)
+		if err != nil {
+			return Rendered{}, err
+		}
+		if !slices.ContainsFunc(sections, func(name string) bool { return p.Lookup(name) != nil }) {
+			return Rendered{}, ErrNoSections
+		}
+		if _, err := t.New("preview").Parse(src); err != nil {
+			return Rendered{}, err
+		}
+	}
+	d.Channel, d.Kind = channel, kind
+	return execute(t, d)
+}
+
+func (s *Set) lookup(channel, kind string) (*template.Template, error) {
+	if s == nil {
+		s = builtin
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refresh()
+
+	key := channel + "/" + kind
+	if t, ok := s.cache[key]; ok {
+		return t, nil
+	}
+
+	t, err := s.parse(channel, kind, s.Dir != "")
+	if err != nil && s.Dir != "" {
+		// A broken override shouldn't stop notifications going out.
+		log.Printf("templates: %s: %v; using built-in defaults", key, err)
+		t, err = s.parse(channel, kind, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cache[key] = t
+	return t, nil
+}
+
+// refresh drops cached templates when files under Dir have changed.
+// Callers hold s.mu.
+func (s *Set) refresh() {
+	if s.cache == nil {
+		s.cache = map[string]*template.Template{}
+	}
+	if s.Dir == "" || time.Since(s.checked) < s.CheckEvery {
+		return
+	}
+	s.checked = time.Now()
+
+	stamp := s.fingerprint()
+	if stamp == s.stamp {
+		return
+	}
+	if s.stamp != "" || len(s.cache) > 0 {
+		log.Printf("templates: reloading from %s", s.Dir)
+	}
+	s.stamp = stamp
+	s.cache = map[string]*template.Template{}
+}
+
+// fingerprint summarises the name, size and mtime of every template
+// under Dir.
+func (s *Set) fingerprint() string {
+	var b strings.Builder
+	filepath.WalkDir(s.Dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String()
+}
+
+func (s *Set) parse(channel, kind string, useDir bool) (*template.Template, error) {
+	t := template.New(channel + "/" + kind).Funcs(funcs)
+	for _, name := range []string{"default.tmpl", channel + "/default.tmpl", kind + ".tmpl", channel + "/" + kind + ".tmpl"} {
+		src, err := defaults.ReadFile("defaults/" + name)
+		if err == nil {
+			if _, err := t.New("builtin/" + name).Parse(string(src)); err != nil {
+				return nil, err
+			}
+		}
+
+		if !useDir {
+			continue
+		}
+		src, err = os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(name).Parse(string(src)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func execute(t *template.Template, d Data) (Rendered, error) {
+	section := func(name string) (string, error) {
+		if t.Lookup(name) == nil {
+			return "", nil
+		}
+		var b bytes.Buffer
+		if err := t.ExecuteTemplate(&b, name, d); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(b.String()), nil
+	}
+
+	var r Rendered
+	var err error
+	if r.Title, err = section("title"); err != nil {
+		return Rendered{}, err
+	}
+	if r.Body, err = section("body"); err != nil {
+		return Rendered{}, err
+	}
+	if r.Footer, err = section("footer"); err != nil {
+		return Rendered{}, err
+	}
+	if r.Subject, err = section("subject"); err != nil {
+		return Rendered{}, err
+	}
+	if r.Subject == "" {
+		r.Subject = r.Title
+	}
+	return r, nil
+}
+
+func defaultString(def, s string) string {
+	if strings.TrimSpace(s) == "" {
+		return def
+	}
+	return s
+}
+
+func truncate(max int, s string) string {
+	r := []rune(s)
+	if max <= 0 || len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return strings.TrimSpace(*s)
+}
@@ -0,0 +1,242 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func ptr(s string) *string { return &s }
+
+var sample = Data{
+	Line:      "F",
+	Header:    "Signal problems at Jay St",
+	Body:      "Expect delays in both directions.",
+	Effect:    "SIGNIFICANT_DELAYS",
+	OldStatus: db.StatusGoodService,
+	NewStatus: "Delays",
+}
+
+func writeFile(t *testing.T, dir, name, src string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		old, new *string
+		want     string
+	}{
+		{nil, ptr("Delays"), KindNew},
+		{ptr(db.StatusGoodService), ptr("No Service"), KindNew},
+		{ptr("Delays"), ptr("No Service"), KindUpdate},
+		{ptr("Delays"), ptr(db.StatusGoodService), KindResolved},
+		{nil, ptr(db.StatusGoodService), KindResolved},
+	}
+	for _, tt := range tests {
+		if got := KindOf(tt.old, tt.new); got != tt.want {
+			t.Errorf("KindOf(%v, %v) = %s, want %s", deref(tt.old), deref(tt.new), got, tt.want)
+		}
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	var s *Set
+	for _, channel := range Channels {
+		for _, kind := range Kinds {
+			r, err := s.Render(channel, kind, sample)
+			if err != nil {
+				t.Errorf("%s/%s: %v", channel, kind, err)
+				continue
+			}
+			if r.Title == "" || r.Body == "" || r.Subject == "" {
+				t.Errorf("%s/%s rendered empty sections: %+v", channel, kind, r)
+			}
+		}
+	}
+
+	tests := []struct {
+		channel string
+		want    Rendered
+	}{
+		{db.ChannelDM, Rendered{
+			Subject: "Signal problems at Jay St", Title: "Signal problems at Jay St",
+			Body: "Expect delays in both directions.", Footer: "nyctcord • Line F",
+		}},
+		{db.ChannelEmail, Rendered{
+			Subject: "[F] Signal problems at Jay St", Title: "Signal problems at Jay St",
+			Body: "Expect delays in both directions.", Footer: "nyctcord • Line F",
+		}},
+		{db.ChannelPush, Rendered{
+			Subject: "F: Signal problems at Jay St", Title: "F: Signal problems at Jay St",
+			Body: "Expect delays in both directions.", Footer: "nyctcord • Line F",
+		}},
+	}
+	for _, tt := range tests {
+		got, err := s.Render(tt.channel, KindNew, sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.channel, got, tt.want)
+		}
+	}
+
+	// Missing text falls back, and long bodies are cut to the channel's
+	// limit.
+	r, err := s.Render(db.ChannelPush, KindResolved, Data{Line: "A", Body: strings.Repeat("x", 1500)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Title != "A: Service update" {
+		t.Errorf("fallback title = %q", r.Title)
+	}
+	if n := len([]rune(r.Body)); n != 1000 || !strings.HasSuffix(r.Body, "…") {
+		t.Errorf("push body is %d runes, want 1000 ending in …", n)
+	}
+}
+
+// Later layers win section by section: kind over channel default over
+// default, with each override file read after its built-in counterpart.
+func TestOverridePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "default.tmpl", `{{define "footer"}}custom footer{{end}}`)
+	writeFile(t, dir, "resolved.tmpl", `{{define "title"}}All clear on {{.Line}}{{end}}`)
+	writeFile(t, dir, "slack/resolved.tmpl", `{{define "title"}}:white_check_mark: {{.Line}} is back{{end}}`)
+	writeFile(t, dir, "push/update.tmpl", `{{define "body"}}{{.OldStatus}} → {{.NewStatus}}{{end}}`)
+	s := New(dir)
+
+	tests := []struct {
+		channel, kind string
+		title, body   string
+		footer        string
+	}{
+		{db.ChannelDM, KindNew, "Signal problems at Jay St", "Expect delays in both directions.", "custom footer"},
+		{db.ChannelDM, KindResolved, "All clear on F", "Expect delays in both directions.", "custom footer"},
+		{db.ChannelSlack, KindResolved, ":white_check_mark: F is back", "Expect delays in both directions.", "custom footer"},
+		{db.ChannelPush, KindUpdate, "F: Signal problems at Jay St", "Good Service → Delays", "custom footer"},
+		// The built-in email/default.tmpl layers over the override
+		// default.tmpl, so email keeps its own footer.
+		{db.ChannelEmail, KindNew, "Signal problems at Jay St", "Expect delays in both directions.", "nyctcord • Line F"},
+	}
+	for _, tt := range tests {
+		r, err := s.Render(tt.channel, tt.kind, sample)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.channel, tt.kind, err)
+		}
+		if r.Title != tt.title || r.Body != tt.body || r.Footer != tt.footer {
+			t.Errorf("%s/%s = %+v, want title %q body %q footer %q", tt.channel, tt.kind, r, tt.title, tt.body, tt.footer)
+		}
+	}
+}
+
+func TestBrokenOverrideFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "new.tmpl", `{{define "title"}}{{.Header`)
+	r, err := New(dir).Render(db.ChannelDM, KindNew, sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Title != "Signal problems at Jay St" {
+		t.Errorf("title = %q, want the built-in one", r.Title)
+	}
+}
+
+func TestHotReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "new.tmpl", `{{define "title"}}first{{end}}`)
+	s := New(dir)
+	s.CheckEvery = 0
+
+	title := func() string {
+		t.Helper()
+		r, err := s.Render(db.ChannelDM, KindNew, sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Title
+	}
+	if got := title(); got != "first" {
+		t.Fatalf("title = %q, want first", got)
+	}
+
+	path := filepath.Join(dir, "new.tmpl")
+	writeFile(t, dir, "new.tmpl", `{{define "title"}}second{{end}}`)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := title(); got != "second" {
+		t.Errorf("after edit title = %q, want second", got)
+	}
+
+	// A new file is picked up too, and removing it restores the default.
+	writeFile(t, dir, "dm/new.tmpl", `{{define "footer"}}dm footer{{end}}`)
+	r, _ := s.Render(db.ChannelDM, KindNew, sample)
+	if r.Footer != "dm footer" {
+		t.Errorf("footer = %q after adding dm/new.tmpl", r.Footer)
+	}
+	if err := os.Remove(filepath.Join(dir, "dm", "new.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = s.Render(db.ChannelDM, KindNew, sample)
+	if r.Footer != "nyctcord • Line F" {
+		t.Errorf("footer = %q after removing dm/new.tmpl", r.Footer)
+	}
+
+	// Without a check due, the cached template is used.
+	s.CheckEvery = time.Hour
+	writeFile(t, dir, "new.tmpl", `{{define "title"}}third{{end}}`)
+	if err := os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := title(); got != "second" {
+		t.Errorf("title = %q before the next check, want second", got)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "new.tmpl", `{{define "title"}}from disk{{end}}`)
+	s := New(dir)
+
+	r, err := s.Preview(db.ChannelDM, KindNew, sample, `{{define "body"}}{{.Line | lower}} preview{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Title != "from disk" || r.Body != "f preview" {
+		t.Errorf("preview = %+v", r)
+	}
+
+	// Without source it shows the configured templates.
+	if r, err := s.Preview(db.ChannelDM, KindNew, sample, " "); err != nil || r.Body != sample.Body {
+		t.Errorf("empty preview = %+v, %v", r, err)
+	}
+
+	// Source outside {{define}} would never be rendered.
+	if _, err := s.Preview(db.ChannelDM, KindNew, sample, `{{.Header}} preview`); !errors.Is(err, ErrNoSections) {
+		t.Errorf("undefined preview err = %v, want ErrNoSections", err)
+	}
+	if _, err := s.Preview(db.ChannelDM, KindNew, sample, `{{define "body"}}{{.Nope}}{{end}}`); err == nil {
+		t.Error("preview of an unknown field succeeded")
+	}
+	if _, err := s.Preview(db.ChannelDM, KindNew, sample, `{{define "body"}}{{.Body`); err == nil {
+		t.Error("preview of broken source succeeded")
+	}
+
+	// The preview isn't cached.
+	if r, _ := s.Render(db.ChannelDM, KindNew, sample); r.Body != sample.Body {
+		t.Errorf("render after preview = %+v", r)
+	}
+}
@@ -0,0 +1,224 @@
+// Package webhook delivers alert transitions to user-registered URLs as
+// signed JSON POSTs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+	"github.com/Ryley4/NYCTcord/backend/internal/safehttp"
+)
+
+const (
+	EventTransition = "alert.transition"
+
+	HeaderEvent     = "X-NYCTcord-Event"
+	HeaderDelivery  = "X-NYCTcord-Delivery"
+	HeaderTimestamp = "X-NYCTcord-Timestamp"
+	HeaderSignature = "X-NYCTcord-Signature"
+)
+
+// Payload is the JSON body POSTed for each delivery.
+type Payload struct {
+	Event      string    `json:"event"`
+	DeliveryID int64     `json:"delivery_id"`
+	Alert      db.Alert  `json:"alert"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// Sign returns the signature header value for body sent at timestamp:
+// "sha256=" + hex(HMAC-SHA256(secret, "<timestamp>.<body>")). Including the
+// timestamp lets receivers reject replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header in constant time.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+type Worker struct {
+	DB *db.DB
+	// Client sends the POSTs. NewWorker uses a safehttp client so webhook
+	// URLs can't reach internal addresses.
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked failed.
+	MaxAttempts int
+	BatchSize   int
+	Now         func() time.Time
+
+	// delivered holds deliveries that were sent but couldn't be marked,
+	// with their response codes, so they are marked rather than re-sent.
+	delivered map[int64]int
+}
+
+func NewWorker(database *db.DB) *Worker {
+	return &Worker{
+		DB:          database,
+		Client:      safehttp.Default,
+		MaxAttempts: 8,
+		BatchSize:   25,
+		Now:         time.Now,
+	}
+}
+
+func (w *Worker) now() time.Time {
+	if w.Now == nil {
+		return time.Now()
+	}
+	return w.Now()
+}
+
+// Backoff is the delay before retry number attempt (1-based): 30s doubling
+// up to 6h.
+func Backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 6*time.Hour {
+		d = 6 * time.Hour
+	}
+	return d
+}
+
+// Run delivers due webhooks every interval until ctx is done.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Printf("webhook: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce attempts every delivery that is currently due and returns how
+// many were attempted. It must not be called concurrently.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	store := w.DB.Webhooks()
+	w.markDelivered(ctx)
+
+	// Unmarked deliveries are still due; fetch enough past them for a
+	// full batch.
+	due, err := store.Due(ctx, w.now(), w.BatchSize+len(w.delivered))
+	if err != nil {
+		return 0, fmt.Errorf("load due deliveries: %w", err)
+	}
+
+	n := 0
+	for _, d := range due {
+		if _, sent := w.delivered[d.ID]; sent {
+			continue
+		}
+		if n == w.BatchSize {
+			break
+		}
+		n++
+
+		code, err := w.deliver(ctx, d)
+		if err == nil {
+			if err := store.MarkDelivered(ctx, d.ID, code, w.now()); err != nil {
+				log.Printf("webhook: mark delivery %d delivered: %v", d.ID, err)
+				if w.delivered == nil {
+					w.delivered = map[int64]int{}
+				}
+				w.delivered[d.ID] = code
+			}
+			continue
+		}
+
+		attempt := d.Attempts + 1
+		giveUp := attempt >= w.MaxAttempts || !retryable(code)
+		log.Printf("webhook: delivery %d to %s failed (attempt %d): %v", d.ID, d.URL, attempt, err)
+		if err := store.MarkAttemptFailed(ctx, d.ID, code, err.Error(), w.now().Add(Backoff(attempt)), giveUp); err != nil {
+			log.Printf("webhook: mark delivery %d failed: %v", d.ID, err)
+		}
+	}
+	return n, nil
+}
+
+// markDelivered retries marking deliveries that went out on an earlier run
+// but couldn't be recorded then.
+func (w *Worker) markDelivered(ctx context.Context) {
+	store := w.DB.Webhooks()
+	for id, code := range w.delivered {
+		if err := store.MarkDelivered(ctx, id, code, w.now()); err != nil {
+			log.Printf("webhook: mark delivery %d delivered: %v", id, err)
+			continue
+		}
+		delete(w.delivered, id)
+	}
+}
+
+// retryable reports whether a failed response is worth retrying. 0 means
+// no response at all (network error or timeout).
+func retryable(code int) bool {
+	switch {
+	case code == 0, code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) deliver(ctx context.Context, d db.PendingDelivery) (int, error) {
+	sentAt := w.now().UTC()
+	body, err := json.Marshal(Payload{
+		Event:      EventTransition,
+		DeliveryID: d.ID,
+		Alert:      d.Alert,
+		SentAt:     sentAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NYCTcord-Webhook/1")
+	req.Header.Set(HeaderEvent, EventTransition)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(sentAt.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, sentAt.Unix(), body))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
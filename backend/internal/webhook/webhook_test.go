@@ -0,0 +1,338 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ryley4/NYCTcord/backend/internal/db"
+)
+
+func openTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// receiver is a webhook endpoint that checks every signature and answers
+// with the next status in codes, then 200 once they run out.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	codes    []int
+	payloads []Payload
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		rc.t.Errorf("bad %s header: %v", HeaderTimestamp, err)
+	}
+	if !Verify(rc.secret, ts, body, r.Header.Get(HeaderSignature)) {
+		rc.t.Errorf("signature %q does not verify", r.Header.Get(HeaderSignature))
+	}
+	if got := r.Header.Get(HeaderEvent); got != EventTransition {
+		rc.t.Errorf("%s = %q, want %q", HeaderEvent, got, EventTransition)
+	}
+
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		rc.t.Errorf("decode payload: %v", err)
+	}
+	if got := r.Header.Get(HeaderDelivery); got != strconv.FormatInt(p.DeliveryID, 10) {
+		rc.t.Errorf("%s = %q, payload delivery_id = %d", HeaderDelivery, got, p.DeliveryID)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.payloads = append(rc.payloads, p)
+	code := http.StatusOK
+	if len(rc.codes) > 0 {
+		code, rc.codes = rc.codes[0], rc.codes[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.payloads)
+}
+
+type fixture struct {
+	db      *db.DB
+	worker  *Worker
+	rcv     *receiver
+	hookID  int64
+	alertID int64
+	now     time.Time
+}
+
+// setup registers a webhook pointing at a test receiver that answers with
+// codes, and queues one alert for it.
+func setup(t *testing.T, codes ...int) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{db: openTestDB(t), now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	u, err := f.db.Users().Upsert(ctx, "100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.rcv = &receiver{t: t, codes: codes}
+	srv := httptest.NewServer(f.rcv)
+	t.Cleanup(srv.Close)
+
+	var hook db.Webhook
+	err = f.db.WithTx(ctx, func(tx *db.Tx) error {
+		var err error
+		hook, err = tx.Webhooks().Create(ctx, u.ID, srv.URL, []string{"F"}, f.now)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.hookID = hook.ID
+	f.rcv.secret = hook.Secret
+
+	status, header := "Delays", "F trains are delayed"
+	f.alertID, err = f.db.Alerts().Insert(ctx, db.Alert{LineID: "F", NewStatus: &status, Header: &header, CreatedAt: f.now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.db.Webhooks().EnqueueForLine(ctx, f.alertID, "F", f.now); err != nil {
+		t.Fatal(err)
+	}
+
+	// srv.Client() can reach the loopback test server; the default
+	// safehttp client would refuse.
+	f.worker = &Worker{
+		DB:          f.db,
+		Client:      srv.Client(),
+		MaxAttempts: 4,
+		BatchSize:   10,
+		Now:         func() time.Time { return f.now },
+	}
+	return f
+}
+
+func (f *fixture) runOnce(t *testing.T) int {
+	t.Helper()
+	n, err := f.worker.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func (f *fixture) delivery(t *testing.T) db.WebhookDelivery {
+	t.Helper()
+	ds, err := f.db.Webhooks().Deliveries(context.Background(), f.hookID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(ds))
+	}
+	return ds[0]
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"alert.transition"}`)
+	sig := Sign("s3cret", 1700000000, body)
+
+	if !Verify("s3cret", 1700000000, body, sig) {
+		t.Error("signature does not verify")
+	}
+	if Verify("other", 1700000000, body, sig) {
+		t.Error("signature verifies with the wrong secret")
+	}
+	if Verify("s3cret", 1700000001, body, sig) {
+		t.Error("signature verifies with a different timestamp")
+	}
+	if Verify("s3cret", 1700000000, append(body, ' '), sig) {
+		t.Error("signature verifies with a different body")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestWorkerDelivers(t *testing.T) {
+	f := setup(t)
+
+	if n := f.runOnce(t); n != 1 {
+		t.Fatalf("RunOnce attempted %d, want 1", n)
+	}
+	d := f.delivery(t)
+	if d.Status != "sent" || d.Attempts != 1 || d.ResponseCode == nil || *d.ResponseCode != 200 {
+		t.Fatalf("delivery = %+v, want sent after 1 attempt with 200", d)
+	}
+	if p := f.rcv.payloads[0]; p.DeliveryID != d.ID || p.Alert.ID != f.alertID || p.Alert.LineID != "F" {
+		t.Errorf("payload = %+v", p)
+	}
+
+	if n := f.runOnce(t); n != 0 || f.rcv.count() != 1 {
+		t.Errorf("delivered delivery was sent again")
+	}
+}
+
+func TestWorkerRetriesWithBackoff(t *testing.T) {
+	f := setup(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	f.runOnce(t)
+	d := f.delivery(t)
+	if d.Status != "pending" || d.Attempts != 1 || !d.NextAttemptAt.Equal(f.now.Add(30*time.Second)) {
+		t.Fatalf("after 503: %+v, want pending retry in 30s", d)
+	}
+
+	// Not due yet.
+	f.now = f.now.Add(29 * time.Second)
+	if n := f.runOnce(t); n != 0 {
+		t.Fatal("retried before the backoff elapsed")
+	}
+
+	f.now = f.now.Add(time.Second)
+	f.runOnce(t)
+	d = f.delivery(t)
+	if d.Status != "pending" || d.Attempts != 2 || !d.NextAttemptAt.Equal(f.now.Add(time.Minute)) {
+		t.Fatalf("after 429: %+v, want pending retry in 1m", d)
+	}
+
+	f.now = f.now.Add(time.Minute)
+	f.runOnce(t)
+	d = f.delivery(t)
+	if d.Status != "sent" || d.Attempts != 3 || d.LastError != nil {
+		t.Fatalf("after 200: %+v, want sent after 3 attempts", d)
+	}
+	if f.rcv.count() != 3 {
+		t.Errorf("receiver saw %d requests, want 3", f.rcv.count())
+	}
+}
+
+func TestWorkerGivesUp(t *testing.T) {
+	t.Run("client error", func(t *testing.T) {
+		f := setup(t, http.StatusGone)
+		f.runOnce(t)
+		d := f.delivery(t)
+		if d.Status != "failed" || d.Attempts != 1 || *d.ResponseCode != http.StatusGone {
+			t.Fatalf("after 410: %+v, want failed without retry", d)
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		f := setup(t, 500, 500, 500, 500, 500)
+		for i := 0; i < 10; i++ {
+			f.now = f.now.Add(time.Hour)
+			f.runOnce(t)
+		}
+		d := f.delivery(t)
+		if d.Status != "failed" || d.Attempts != f.worker.MaxAttempts {
+			t.Fatalf("delivery = %+v, want failed after %d attempts", d, f.worker.MaxAttempts)
+		}
+		if f.rcv.count() != f.worker.MaxAttempts {
+			t.Errorf("receiver saw %d requests, want %d", f.rcv.count(), f.worker.MaxAttempts)
+		}
+	})
+}
+
+func TestNewWorkerRefusesLoopback(t *testing.T) {
+	f := setup(t)
+	f.worker.Client = NewWorker(f.db).Client
+
+	f.runOnce(t)
+	if f.rcv.count() != 0 {
+		t.Fatal("default client reached a loopback receiver")
+	}
+	d := f.delivery(t)
+	if d.Status != "pending" || d.LastError == nil {
+		t.Fatalf("delivery = %+v, want a recorded failed attempt", d)
+	}
+}
+
+// A delivery that went out but couldn't be marked isn't sent again, and
+// doesn't take up a batch slot while it waits to be marked.
+func TestWorkerUnmarkedDelivery(t *testing.T) {
+	f := setup(t)
+	ctx := context.Background()
+	f.worker.BatchSize = 1
+
+	status := "No Service"
+	second, err := f.db.Alerts().Insert(ctx, db.Alert{LineID: "F", NewStatus: &status, CreatedAt: f.now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.db.Webhooks().EnqueueForLine(ctx, second, "F", f.now); err != nil {
+		t.Fatal(err)
+	}
+
+	var first int64
+	if err := f.db.QueryRowContext(ctx, `SELECT MIN(id) FROM webhook_deliveries`).Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TRIGGER block_first BEFORE UPDATE ON webhook_deliveries WHEN OLD.id = %d
+		BEGIN SELECT RAISE(ABORT, 'database is read-only'); END
+	`, first)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := f.runOnce(t); n != 1 || f.rcv.count() != 1 {
+		t.Fatalf("first run attempted %d, receiver saw %d", n, f.rcv.count())
+	}
+	if n := f.runOnce(t); n != 1 || f.rcv.count() != 2 {
+		t.Fatalf("second run attempted %d, receiver saw %d; want the next delivery sent", n, f.rcv.count())
+	}
+	if n := f.runOnce(t); n != 0 || f.rcv.count() != 2 {
+		t.Fatalf("third run attempted %d, receiver saw %d; want nothing re-sent", n, f.rcv.count())
+	}
+
+	if _, err := f.db.ExecContext(ctx, `DROP TRIGGER block_first`); err != nil {
+		t.Fatal(err)
+	}
+	f.runOnce(t)
+	ds, err := f.db.Webhooks().Deliveries(ctx, f.hookID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ds {
+		if d.Status != "sent" || d.Attempts != 1 {
+			t.Errorf("delivery %d = %s after %d attempts, want sent after 1", d.ID, d.Status, d.Attempts)
+		}
+	}
+	if f.rcv.count() != 2 {
+		t.Errorf("receiver saw %d requests, want 2", f.rcv.count())
+	}
+}
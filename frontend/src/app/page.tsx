@@ -68,6 +68,24 @@ export default function Home() {
     load();
   }, []);
 
+  useEffect(() => {
+    // EventSource reconnects on its own and sends Last-Event-ID, so the
+    // server replays anything we missed while disconnected.
+    const source = new EventSource(`${API_BASE}/api/stream`);
+
+    source.addEventListener("line_status", (e) => {
+      const updated: LineStatus = JSON.parse((e as MessageEvent).data);
+      setLines((prev) => {
+        const next = prev.filter((l) => l.line_id !== updated.line_id);
+        next.push(updated);
+        next.sort((a, b) => a.line_id.localeCompare(b.line_id));
+        return next;
+      });
+    });
+
+    return () => source.close();
+  }, []);
+
   const toggleLine = (lineID: string) => {
     setSelectedLines((prev) => {
       const next = new Set(prev);